@@ -0,0 +1,18 @@
+package cache
+
+import "github.com/spf13/cobra"
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect and prune the cache of parsed documents",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return nil
+	},
+}
+
+func NewCommand() *cobra.Command {
+	cacheCmd.AddCommand(newCacheListCommand())
+	cacheCmd.AddCommand(newCachePruneCommand())
+
+	return cacheCmd
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/spf13/cobra"
+)
+
+type cacheListEntry struct {
+	ID          int64  `json:"id"`
+	FileName    string `json:"file_name"`
+	FileSha256  string `json:"file_sha256"`
+	Settings    string `json:"settings"`
+	Pages       int64  `json:"pages"`
+	CreditsUsed int64  `json:"credits_used"`
+	Size        int64  `json:"size"`
+	CreatedAt   string `json:"created_at"`
+	LastUsedAt  string `json:"last_used_at"`
+}
+
+func newCacheListCommand() *cobra.Command {
+	var jsonOutput bool
+
+	cacheListCommand := &cobra.Command{
+		Use:   "list",
+		Short: "List cached parsing results",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			queries := sqlc.New(db.MainDB)
+
+			rows, err := queries.ListParseCacheEntries(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("failed to list parse cache entries: %w", err)
+			}
+
+			entries := make([]cacheListEntry, 0, len(rows))
+			var pages, credits int64
+			for _, row := range rows {
+				entries = append(entries, cacheListEntry{
+					ID:          row.ID,
+					FileName:    row.FileName,
+					FileSha256:  row.FileSha256,
+					Settings:    row.Settings,
+					Pages:       row.Pages,
+					CreditsUsed: row.CreditsUsed,
+					Size:        row.Size,
+					CreatedAt:   row.CreatedAt.Format("2006-01-02 15:04"),
+					LastUsedAt:  row.LastUsedAt.Format("2006-01-02 15:04"),
+				})
+				pages += row.Pages
+				credits += row.CreditsUsed
+			}
+
+			if jsonOutput {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(entries)
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tFILE\tSHA256\tSETTINGS\tPAGES\tCREDITS\tSIZE\tLAST USED")
+			for _, entry := range entries {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%d\t%d\t%s\n", entry.ID, entry.FileName, entry.FileSha256[:min(len(entry.FileSha256), 12)], entry.Settings, entry.Pages, entry.CreditsUsed, entry.Size, entry.LastUsedAt)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "\n%d entries, %d pages, %d credits\n", len(entries), pages, credits)
+
+			return nil
+		},
+	}
+
+	cacheListCommand.Flags().BoolVar(&jsonOutput, "json", false, "Print the cache entries as JSON")
+
+	return cacheListCommand
+}
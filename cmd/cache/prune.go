@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/spf13/cobra"
+)
+
+func newCachePruneCommand() *cobra.Command {
+	var (
+		olderThan time.Duration
+		orphaned  bool
+		all       bool
+	)
+
+	cachePruneCommand := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove cached parsing results",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if olderThan <= 0 && !orphaned && !all {
+				return errors.New("specify --older_than, --orphaned or --all")
+			}
+
+			queries := sqlc.New(db.MainDB)
+
+			var removed int64
+
+			if all || olderThan > 0 {
+				// CURRENT_TIMESTAMP is stored in UTC.
+				cutoff := time.Now().UTC().Add(-olderThan)
+				if all {
+					cutoff = time.Now().UTC().Add(time.Minute)
+				}
+
+				n, err := queries.DeleteParseCacheEntriesUsedBefore(cmd.Context(), cutoff)
+				if err != nil {
+					return fmt.Errorf("failed to prune parse cache: %w", err)
+				}
+				removed += n
+			}
+
+			if orphaned {
+				n, err := queries.DeleteOrphanedParseCacheEntries(cmd.Context())
+				if err != nil {
+					return fmt.Errorf("failed to prune orphaned parse cache entries: %w", err)
+				}
+				removed += n
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Removed %d cache entries\n", removed)
+
+			return nil
+		},
+	}
+
+	cachePruneCommand.Flags().DurationVar(&olderThan, "older_than", 0, "Remove entries not used for this long, e.g. 720h")
+	cachePruneCommand.Flags().BoolVar(&orphaned, "orphaned", false, "Remove entries of files which aren't in any index")
+	cachePruneCommand.Flags().BoolVar(&all, "all", false, "Remove all entries")
+
+	return cachePruneCommand
+}
@@ -1,134 +1,214 @@
 package document
 
 import (
-	"crypto/sha256"
-	"encoding/base64"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"sync"
+	"syscall"
 
 	"github.com/OptimusePrime/petagpt/internal/db"
-	"github.com/OptimusePrime/petagpt/internal/index"
+	"github.com/OptimusePrime/petagpt/internal/ingest"
 	"github.com/OptimusePrime/petagpt/internal/parser"
 	"github.com/OptimusePrime/petagpt/internal/sqlc"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+type addResult struct {
+	path   string
+	reason string
+}
+
+// addSummary collects the outcome of every file, as jobs finish concurrently.
+type addSummary struct {
+	// jobs are the jobs queued by the command, the worker also processes
+	// others.
+	jobs    map[int64]bool
+	mu      sync.Mutex
+	added   []addResult
+	updated []addResult
+	skipped []addResult
+	failed  []addResult
+}
+
+func (s *addSummary) jobDone(job sqlc.IngestionJob, err error) {
+	if !s.jobs[job.ID] {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		s.failed = append(s.failed, addResult{path: job.FilePath, reason: fmt.Sprintf("job %d: %s", job.ID, err)})
+		return
+	}
+
+	if ingest.UpdatesDocument(job) {
+		s.updated = append(s.updated, addResult{path: job.FilePath})
+		return
+	}
+
+	s.added = append(s.added, addResult{path: job.FilePath})
+}
+
+func (s *addSummary) print(cmd *cobra.Command) {
+	sections := []struct {
+		title   string
+		results []addResult
+	}{
+		{"Added", s.added},
+		{"Updated", s.updated},
+		{"Skipped", s.skipped},
+		{"Failed", s.failed},
+	}
+
+	for _, section := range sections {
+		if len(section.results) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "%s %d file(s):\n", section.title, len(section.results))
+		for _, result := range section.results {
+			if result.reason != "" {
+				fmt.Fprintf(cmd.OutOrStdout(), "  %s: %s\n", result.path, result.reason)
+			} else {
+				fmt.Fprintf(cmd.OutOrStdout(), "  %s\n", result.path)
+			}
+		}
+	}
+}
+
 func newDocumentAddCmd() *cobra.Command {
 	var (
 		numWorkers   int
 		chunkSize    int
 		idxName      string
 		requestDelay int
+		tags         []string
+		recursive    bool
+		filter       ingest.FileFilter
+		parallel     int
+		force        bool
 	)
 
 	documentAddCommand := &cobra.Command{
-		Use:   "add",
+		Use:   "add <path>...",
 		Short: "Add new document(s) to a document index",
+		Long: `Add new document(s) to a document index.
+Files whose content is already in the index are skipped. A document added before from the same path is updated in place,
+only contextualising and embedding the chunks whose content changed. With --force, files are always processed in full.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 {
 				return fmt.Errorf("you must provide at least one document path")
 			}
 
-			dc, err := parser.NewDocumentChunker(cmd.Context(), numWorkers, viper.GetInt("context_llm.max_concurrent_requests"))
+			if err := filter.Validate(); err != nil {
+				return err
+			}
+
+			files, err := ingest.CollectFiles(args, recursive, filter)
 			if err != nil {
-				return fmt.Errorf("failed to create a document chunker: %w", err)
+				return err
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			if err := ingest.Recover(ctx); err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "warning: failed to recover incomplete operations: %s\n", err)
 			}
 
 			queries := sqlc.New(db.MainDB)
 
-			idx, err := queries.GetIndexByName(cmd.Context(), idxName)
+			idx, err := queries.GetIndexByName(ctx, idxName)
 			if err != nil {
 				return fmt.Errorf("failed to find idx: %w", err)
 			}
 
-			for _, docPath := range args {
-				doc, err := os.Open(docPath)
-				if err != nil {
-					return fmt.Errorf("failed to open document: %s: %w", docPath, err)
-				}
-
-				docData, err := io.ReadAll(doc)
-				if err != nil {
-					return fmt.Errorf("failed to read document: %s: %w", docPath, err)
-				}
+			summary := &addSummary{jobs: make(map[int64]bool)}
+			var jobIDs []int64
 
-				checksum := sha256.Sum256(docData)
+			// Files with the same content are only added once.
+			checksums := make(map[string]string)
 
-				docStat, err := doc.Stat()
+			for _, docPath := range files {
+				docData, err := os.ReadFile(docPath)
 				if err != nil {
-					return fmt.Errorf("failed getting file info: %s: %w", docPath, err)
+					summary.failed = append(summary.failed, addResult{path: docPath, reason: err.Error()})
+					continue
 				}
 
-				chunks, err := parser.ProcessDocument(cmd.Context(), docData, filepath.Base(docPath), dc, chunkSize, requestDelay)
-				if err != nil {
-					return fmt.Errorf("failed chunking document: %s: %w", docPath, err)
+				if len(docData) == 0 {
+					summary.skipped = append(summary.skipped, addResult{path: docPath, reason: "empty file"})
+					continue
 				}
 
-				err = index.AddChunksToBleveIndex(idx.Path, chunks...)
-				if err != nil {
-					return fmt.Errorf("failed adding chunks to BM25 index: %s: %w", idx.Path, err)
+				checksum := ingest.FileSHA256(docData)
+				if original, ok := checksums[checksum]; ok {
+					summary.skipped = append(summary.skipped, addResult{path: docPath, reason: "same content as " + original})
+					continue
 				}
-
-				err = index.AddChunksToChromaCollection(cmd.Context(), idxName, chunks...)
-				if err != nil {
-					return fmt.Errorf("failed adding chunks to Chroma collection: %s: %w", idxName, err)
-				}
-
-				document, err := queries.CreateDocument(cmd.Context(), sqlc.CreateDocumentParams{
-					IndexID:    idx.ID,
-					Filepath:   docPath,
-					Filetype:   filepath.Ext(docPath),
-					Filesize:   docStat.Size(),
-					Filesha256: base64.StdEncoding.EncodeToString(checksum[:]),
+				checksums[checksum] = docPath
+
+				job, err := ingest.Enqueue(ctx, ingest.JobParams{
+					IndexID:      idx.ID,
+					FilePath:     docPath,
+					Data:         docData,
+					Tags:         tags,
+					ChunkSize:    chunkSize,
+					RequestDelay: requestDelay,
+					Force:        force,
 				})
+				var duplicate *ingest.DuplicateError
+				if errors.As(err, &duplicate) {
+					summary.skipped = append(summary.skipped, addResult{path: docPath, reason: duplicate.Error()})
+					continue
+				}
 				if err != nil {
-					return fmt.Errorf("failed creating document in database: %s: %w", docPath, err)
+					return err
 				}
 
-				for _, c := range chunks {
-					_, err = queries.CreateChunk(cmd.Context(), sqlc.CreateChunkParams{
-						DocumentID: document.ID,
-						Content:    c.Content,
-						Context:    c.Context,
-						IndexingID: c.ID,
-					})
-					if err != nil {
-						return fmt.Errorf("failed creating chunk in database: %s: %w", docPath, err)
+				summary.jobs[job.ID] = true
+				jobIDs = append(jobIDs, job.ID)
+			}
+
+			dc, err := parser.NewDocumentChunker(ctx, numWorkers, viper.GetInt("context_llm.max_concurrent_requests"))
+			if err != nil {
+				return fmt.Errorf("failed to create a document chunker: %w", err)
+			}
+
+			if addr := viper.GetString("document_parser.webhook.listen"); addr != "" {
+				webhookCtx, cancel := context.WithCancel(ctx)
+				defer cancel()
+
+				go func() {
+					if err := parser.ServeWebhooks(webhookCtx, addr); err != nil {
+						fmt.Fprintf(cmd.ErrOrStderr(), "warning: falling back to polling parsing jobs: %s\n", err)
 					}
-				}
+				}()
 			}
 
-			//dc, err := parser.NewDocumentChunker(cmd.Context(), numWorkers)
-			//if err != nil {
-			//	return fmt.Errorf("failed to create a document chunker: %w", err)
-			//}
-			//defer func() {
-			//	err = errors.Join(err, dc.Shutdown())
-			//}()
-			//
-			//wg := sync.WaitGroup{}
-			//wg.Add(len(args))
-			//
-			//for _, docPath := range args {
-			//	go func() {
-			//		docContent, err := os.ReadFile(docPath)
-			//		if err != nil {
-			//			fmt.Println(err)
-			//		}
-			//
-			//		_, err = parser.parseDocument(cmd.Context(), docContent, dc)
-			//		if err != nil {
-			//			fmt.Println(err)
-			//		}
-			//
-			//		wg.Done()
-			//	}()
-			//}
-			//
-			//wg.Wait()
+			// The worker also resumes jobs which were interrupted before.
+			worker := ingest.NewWorker(dc)
+			worker.OnJobDone = summary.jobDone
+
+			drainErr := worker.DrainJobs(ctx, parallel, jobIDs)
+
+			summary.print(cmd)
+
+			if drainErr != nil {
+				return drainErr
+			}
+			if ctx.Err() != nil {
+				return fmt.Errorf("interrupted, the remaining documents are added by jobs run")
+			}
+			if len(summary.failed) > 0 {
+				return fmt.Errorf("failed to add %d document(s), see jobs list and jobs retry", len(summary.failed))
+			}
 
 			return nil
 		},
@@ -138,6 +218,12 @@ func newDocumentAddCmd() *cobra.Command {
 	documentAddCommand.Flags().IntVarP(&chunkSize, "chunk_size", "c", 50, "Size of the chunks in number of sentences")
 	documentAddCommand.Flags().StringVarP(&idxName, "index", "i", "", "The name of the index to add the document to")
 	documentAddCommand.Flags().IntVarP(&requestDelay, "request_delay", "d", 0, "Delay between requests to the LLM service in milliseconds")
+	documentAddCommand.Flags().StringSliceVarP(&tags, "tag", "t", nil, "Tag(s) to attach to the document(s), usable as search filters")
+	documentAddCommand.Flags().BoolVarP(&recursive, "recursive", "r", false, "Add the documents in directories and their subdirectories")
+	documentAddCommand.Flags().StringSliceVar(&filter.Include, "include", nil, "Only add documents in directories matching these globs, e.g. '*.pdf'")
+	documentAddCommand.Flags().StringSliceVar(&filter.Exclude, "exclude", nil, "Skip documents and directories matching these globs, e.g. 'drafts/**'")
+	documentAddCommand.Flags().IntVarP(&parallel, "parallel", "p", 4, "Number of documents processed at a time")
+	documentAddCommand.Flags().BoolVarP(&force, "force", "f", false, "Process the documents in full, even if their content is already in the index")
 
 	return documentAddCommand
 }
@@ -0,0 +1,88 @@
+package document
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/spf13/cobra"
+)
+
+type documentListEntry struct {
+	ID         int64  `json:"id"`
+	Path       string `json:"path"`
+	FileType   string `json:"file_type"`
+	FileSha256 string `json:"file_sha256"`
+	Size       int64  `json:"size"`
+	Chunks     int64  `json:"chunks"`
+	CreatedAt  string `json:"created_at"`
+	UpdatedAt  string `json:"updated_at"`
+}
+
+func newDocumentListCmd() *cobra.Command {
+	var (
+		idxName    string
+		jsonOutput bool
+	)
+
+	documentListCommand := &cobra.Command{
+		Use:   "list",
+		Short: "List the documents in an index",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			queries := sqlc.New(db.MainDB)
+
+			idx, err := queries.GetIndexByName(cmd.Context(), idxName)
+			if err != nil {
+				return fmt.Errorf("failed to find idx: %w", err)
+			}
+
+			rows, err := queries.ListDocumentSummariesByIndexID(cmd.Context(), idx.ID)
+			if err != nil {
+				return fmt.Errorf("failed to list documents: %w", err)
+			}
+
+			entries := make([]documentListEntry, 0, len(rows))
+			var size, chunks int64
+			for _, row := range rows {
+				entries = append(entries, documentListEntry{
+					ID:         row.ID,
+					Path:       row.Filepath,
+					FileType:   row.Filetype,
+					FileSha256: row.Filesha256,
+					Size:       row.Filesize,
+					Chunks:     row.ChunkCount,
+					CreatedAt:  row.CreatedAt.Format("2006-01-02 15:04"),
+					UpdatedAt:  row.UpdatedAt.Format("2006-01-02 15:04"),
+				})
+				size += row.Filesize
+				chunks += row.ChunkCount
+			}
+
+			if jsonOutput {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(entries)
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tPATH\tSIZE\tCHUNKS\tADDED\tUPDATED")
+			for _, entry := range entries {
+				fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%s\t%s\n", entry.ID, entry.Path, entry.Size, entry.Chunks, entry.CreatedAt, entry.UpdatedAt)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "\n%d documents, %d chunks, %d bytes\n", len(entries), chunks, size)
+
+			return nil
+		},
+	}
+
+	documentListCommand.Flags().StringVarP(&idxName, "index", "i", "", "The name of the index to list the documents of")
+	documentListCommand.Flags().BoolVar(&jsonOutput, "json", false, "Print the documents as JSON")
+
+	return documentListCommand
+}
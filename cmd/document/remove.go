@@ -1,85 +1,140 @@
 package document
 
 import (
-	"crypto/sha256"
+	"database/sql"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
 	"os"
+	"path/filepath"
 
-	chroma "github.com/OptimusePrime/chroma-go/pkg/api/v2"
 	"github.com/OptimusePrime/petagpt/internal/db"
 	"github.com/OptimusePrime/petagpt/internal/index"
+	"github.com/OptimusePrime/petagpt/internal/ingest"
 	"github.com/OptimusePrime/petagpt/internal/sqlc"
 	"github.com/spf13/cobra"
 )
 
 func newDocumentRemoveCmd() *cobra.Command {
 	var (
-		idxName string
+		idxName   string
+		ids       []int64
+		paths     []string
+		globs     []string
+		checksums []string
 	)
 
 	documentRemoveCommand := &cobra.Command{
-		Use:   "remove",
-		Short: "Remove a document from the specified index",
+		Use:   "remove [<path>...]",
+		Short: "Remove document(s) from the specified index",
+		Long: `Remove document(s) from the specified index, selected by ID, path, glob or SHA-256.
+Paths given as arguments are the same as --path. Globs are matched against the stored paths relative to the
+working directory, or against the absolute paths if the glob is absolute, see document list.
+The documents are removed from the vector store, the BM25 index and the database at once.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if len(args) == 0 {
-				return fmt.Errorf("you must provide at least one document path")
+			paths = append(paths, args...)
+			if len(ids) == 0 && len(paths) == 0 && len(globs) == 0 && len(checksums) == 0 {
+				return fmt.Errorf("you must select documents with --id, --path, --glob or --sha256")
+			}
+
+			if err := (ingest.FileFilter{Include: globs}).Validate(); err != nil {
+				return err
 			}
 
 			queries := sqlc.New(db.MainDB)
 
-			var chunkIDs []string
-			var dbDoc sqlc.Document
+			idx, err := queries.GetIndexByName(cmd.Context(), idxName)
+			if err != nil {
+				return fmt.Errorf("failed to find idx: %w", err)
+			}
 
-			for _, docPath := range args {
-				doc, err := os.Open(docPath)
-				if err != nil {
-					return fmt.Errorf("failed to open document: %s: %w", docPath, err)
+			var selected []sqlc.Document
+			seen := make(map[int64]bool)
+			add := func(documents ...sqlc.Document) {
+				for _, document := range documents {
+					if !seen[document.ID] {
+						seen[document.ID] = true
+						selected = append(selected, document)
+					}
 				}
+			}
 
-				defer doc.Close()
+			for _, id := range ids {
+				document, err := queries.GetDocument(cmd.Context(), id)
+				if errors.Is(err, sql.ErrNoRows) || (err == nil && document.IndexID != idx.ID) {
+					return fmt.Errorf("document %d not found in index %s", id, idx.Name)
+				}
+				if err != nil {
+					return fmt.Errorf("failed to find document: %w", err)
+				}
+				add(document)
+			}
 
-				docData, err := io.ReadAll(doc)
+			for _, checksum := range checksums {
+				checksum, err := parseSHA256(checksum)
 				if err != nil {
-					return fmt.Errorf("failed to read document: %s: %w", docPath, err)
+					return err
 				}
 
-				checksum := sha256.Sum256(docData)
+				documents, err := queries.ListDocumentsBySHA256(cmd.Context(), sqlc.ListDocumentsBySHA256Params{
+					IndexID:    idx.ID,
+					Filesha256: checksum,
+				})
+				if err != nil {
+					return fmt.Errorf("failed to find documents: %w", err)
+				}
+				add(documents...)
+			}
 
-				dbDoc, err := queries.GetDocumentBySHA256(cmd.Context(), base64.StdEncoding.EncodeToString(checksum[:]))
+			if len(paths) > 0 || len(globs) > 0 {
+				documents, err := queries.ListDocumentsByIndexID(cmd.Context(), idx.ID)
 				if err != nil {
-					return fmt.Errorf("failed to find document: %w", err)
+					return fmt.Errorf("failed to list documents: %w", err)
 				}
 
-				chunks, err := queries.GetChunksByDocumentID(cmd.Context(), dbDoc.ID)
+				wd, err := os.Getwd()
 				if err != nil {
-					return fmt.Errorf("failed to find chunks: %w", err)
+					return fmt.Errorf("failed to get working directory: %w", err)
 				}
 
-				for _, chunk := range chunks {
-					chunkIDs = append(chunkIDs, chunk.IndexingID)
+				// Paths are compared as absolute paths, so a document added as
+				// ./a.pdf is also found as a.pdf.
+				absPaths := make(map[string]bool)
+				for _, path := range paths {
+					absPath, err := filepath.Abs(path)
+					if err != nil {
+						return err
+					}
+					absPaths[absPath] = true
 				}
 
+				for _, document := range documents {
+					if absPath, err := filepath.Abs(document.Filepath); err == nil && absPaths[absPath] {
+						add(document)
+						continue
+					}
+
+					for _, glob := range globs {
+						if matchDocumentGlob(glob, document.Filepath, wd) {
+							add(document)
+							break
+						}
+					}
+				}
 			}
 
-			// Convert []string to []chroma.DocumentID
-			docIDs := make([]chroma.DocumentID, len(chunkIDs))
-			for i, id := range chunkIDs {
-				docIDs[i] = chroma.DocumentID(id)
+			if len(selected) == 0 {
+				return fmt.Errorf("no documents matched in index %s", idx.Name)
 			}
 
-			err := index.RemoveChunksFromChromaCollection(cmd.Context(), idxName, docIDs)
-			if err != nil {
-				return fmt.Errorf("failed deleting chunks from chroma collection: %w", err)
-			}
-			err = index.RemoveChunksFromBleveIndex(cmd.Context(), idxName, chunkIDs)
-			if err != nil {
-				return fmt.Errorf("failed deleting chunks from bleve index: %w", err)
+			if err := index.RemoveDocuments(cmd.Context(), idx, selected...); err != nil {
+				return err
 			}
 
-			if err := queries.DeleteDocument(cmd.Context(), dbDoc.ID); err != nil {
-				return fmt.Errorf("failed to delete document: %w", err)
+			fmt.Fprintf(cmd.OutOrStdout(), "Removed %d document(s):\n", len(selected))
+			for _, document := range selected {
+				fmt.Fprintf(cmd.OutOrStdout(), "  %d  %s\n", document.ID, document.Filepath)
 			}
 
 			return nil
@@ -87,5 +142,44 @@ func newDocumentRemoveCmd() *cobra.Command {
 	}
 
 	documentRemoveCommand.Flags().StringVarP(&idxName, "index", "i", "", "The name of the index to remove the document from")
+	documentRemoveCommand.Flags().Int64SliceVar(&ids, "id", nil, "ID(s) of the documents to remove, see document list")
+	documentRemoveCommand.Flags().StringSliceVar(&paths, "path", nil, "Path(s) the documents were added with")
+	documentRemoveCommand.Flags().StringSliceVar(&globs, "glob", nil, "Remove the documents whose paths match these globs, e.g. 'drafts/**'")
+	documentRemoveCommand.Flags().StringSliceVar(&checksums, "sha256", nil, "SHA-256 checksum(s) of the documents to remove, in hex or base64")
+
 	return documentRemoveCommand
 }
+
+// matchDocumentGlob reports whether the stored path of a document matches the
+// glob. Relative globs are matched against the path relative to the working
+// directory wd, so 'drafts/**' selects the documents added from ./drafts
+// whether they were stored with a relative or an absolute path.
+func matchDocumentGlob(glob, path, wd string) bool {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(wd, path)
+	}
+
+	if !filepath.IsAbs(glob) {
+		rel, err := filepath.Rel(wd, path)
+		if err != nil {
+			return false
+		}
+		path = rel
+	}
+
+	return ingest.MatchGlob(filepath.ToSlash(glob), filepath.ToSlash(path))
+}
+
+// parseSHA256 converts a hex checksum, as printed by sha256sum, to the base64
+// form stored with documents.
+func parseSHA256(checksum string) (string, error) {
+	if sum, err := hex.DecodeString(checksum); err == nil && len(sum) == 32 {
+		return base64.StdEncoding.EncodeToString(sum), nil
+	}
+
+	if sum, err := base64.StdEncoding.DecodeString(checksum); err == nil && len(sum) == 32 {
+		return checksum, nil
+	}
+
+	return "", fmt.Errorf("invalid sha256 checksum: %s", checksum)
+}
@@ -0,0 +1,76 @@
+package document
+
+import "testing"
+
+func TestParseSHA256(t *testing.T) {
+	// The checksums of "hello\n".
+	const (
+		hexSum    = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+		base64Sum = "WJG1tSLV3whtD/CxEPvZ0hu0/HFjrzTQgoai6Eb2vgM="
+	)
+
+	tests := []struct {
+		name     string
+		checksum string
+		want     string
+		err      bool
+	}{
+		{name: "hex", checksum: hexSum, want: base64Sum},
+		{name: "upper case hex", checksum: "5891B5B522D5DF086D0FF0B110FBD9D21BB4FC7163AF34D08286A2E846F6BE03", want: base64Sum},
+		{name: "base64", checksum: base64Sum, want: base64Sum},
+		{name: "short hex", checksum: hexSum[:62], err: true},
+		{name: "hex of another hash", checksum: hexSum[:40], err: true},
+		{name: "base64 of another hash", checksum: "qUqP5cyxm6YcTAhz05Hph5gvu9M=", err: true},
+		{name: "garbage", checksum: "not a checksum", err: true},
+		{name: "empty", checksum: "", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSHA256(tt.checksum)
+			if tt.err {
+				if err == nil {
+					t.Errorf("parseSHA256(%q) = %q, want an error", tt.checksum, got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parseSHA256(%q) failed: %v", tt.checksum, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseSHA256(%q) = %q, want %q", tt.checksum, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchDocumentGlob(t *testing.T) {
+	const wd = "/home/user/notes"
+
+	tests := []struct {
+		name string
+		glob string
+		path string
+		want bool
+	}{
+		{name: "absolute path under the working directory", glob: "drafts/**", path: "/home/user/notes/drafts/a.md", want: true},
+		{name: "nested absolute path", glob: "drafts/**", path: "/home/user/notes/drafts/2024/a.md", want: true},
+		{name: "absolute path in another directory", glob: "drafts/**", path: "/home/user/notes/final/a.md"},
+		{name: "absolute path outside the working directory", glob: "drafts/**", path: "/srv/drafts/a.md"},
+		{name: "relative path", glob: "drafts/**", path: "drafts/a.md", want: true},
+		{name: "relative path with dot", glob: "drafts/*.md", path: "./drafts/a.md", want: true},
+		{name: "file name glob", glob: "*.md", path: "/srv/drafts/a.md", want: true},
+		{name: "absolute glob", glob: "/srv/**/*.md", path: "/srv/drafts/a.md", want: true},
+		{name: "absolute glob against relative path", glob: "/home/user/notes/drafts/*", path: "drafts/a.md", want: true},
+		{name: "parent directory", glob: "../archive/*.md", path: "/home/user/archive/a.md", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchDocumentGlob(tt.glob, tt.path, wd); got != tt.want {
+				t.Errorf("matchDocumentGlob(%q, %q) = %v, want %v", tt.glob, tt.path, got, tt.want)
+			}
+		})
+	}
+}
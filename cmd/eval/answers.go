@@ -0,0 +1,120 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/OptimusePrime/petagpt/internal/eval"
+	"github.com/OptimusePrime/petagpt/internal/index"
+	"github.com/spf13/cobra"
+)
+
+func newEvalAnswersCommand() *cobra.Command {
+	var (
+		indexNames []string
+		dataset    string
+		topN       int
+		output     string
+		baseline   string
+	)
+
+	evalAnswersCommand := &cobra.Command{
+		Use:   "answers",
+		Short: "Answer a question set with the chat pipeline and score the answers with a judge LLM",
+		Long: `Answer a question set with the chat pipeline and score the answers with a judge LLM.
+The dataset uses the format of "petagpt eval retrieval", and every question needs a reference "answer", or "refuse": true if the assistant should decline it.
+The judge configured under judge_llm scores the correctness against the reference answer and the faithfulness to the retrieved documents from 1 to 5, and whether the answer was refused appropriately.
+The report is written as JSON, and can be compared with the report of an earlier run using --baseline.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if dataset == "" {
+				return fmt.Errorf("you must provide a dataset")
+			}
+
+			questions, err := eval.LoadQuestions(dataset)
+			if err != nil {
+				return err
+			}
+
+			var refs []index.IndexRef
+			for _, name := range indexNames {
+				resolved, err := index.ResolveIndexRefs(name)
+				if err != nil {
+					return err
+				}
+				refs = append(refs, resolved...)
+			}
+
+			report, err := eval.EvaluateAnswers(cmd.Context(), questions, refs, topN, func(done, total int) {
+				fmt.Fprintf(cmd.ErrOrStderr(), "\r%d/%d questions", done, total)
+			})
+			fmt.Fprintln(cmd.ErrOrStderr())
+			if err != nil {
+				return fmt.Errorf("failed to evaluate answers: %w", err)
+			}
+			report.Dataset = dataset
+
+			var previous *eval.AnswersReport
+			if baseline != "" {
+				previous = new(eval.AnswersReport)
+				if err := readReport(baseline, previous); err != nil {
+					return err
+				}
+			}
+
+			if err := printAnswersReport(cmd.OutOrStdout(), report, previous); err != nil {
+				return err
+			}
+
+			if output == "" {
+				output = fmt.Sprintf("answers-%s.json", report.CreatedAt.Format("20060102-150405"))
+			}
+
+			return writeReport(cmd.ErrOrStderr(), output, report)
+		},
+	}
+
+	evalAnswersCommand.Flags().StringSliceVarP(&indexNames, "index", "i", []string{"vgim1"}, "The indexes, or index groups from retrieval.index_groups, used for retrieval")
+	evalAnswersCommand.Flags().StringVarP(&dataset, "dataset", "d", "", "The JSONL file with the questions and reference answers")
+	evalAnswersCommand.Flags().IntVarP(&topN, "top_n", "n", 20, "The number of chunks retrieved per query")
+	evalAnswersCommand.Flags().StringVarP(&output, "output", "o", "", "The file the JSON report is written to (default answers-<time>.json)")
+	evalAnswersCommand.Flags().StringVar(&baseline, "baseline", "", "A report of an earlier run to compare against")
+
+	return evalAnswersCommand
+}
+
+func printAnswersReport(w io.Writer, report *eval.AnswersReport, baseline *eval.AnswersReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tCORRECTNESS\tFAITHFULNESS\tREFUSED\tREFUSAL OK\tERROR")
+	for _, verdict := range report.Verdicts {
+		correctness := "-"
+		if verdict.Correctness > 0 {
+			correctness = fmt.Sprint(verdict.Correctness)
+		}
+
+		if verdict.Error != "" {
+			fmt.Fprintf(tw, "%s\t-\t-\t-\t-\t%s\n", verdict.ID, verdict.Error)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%t\t%t\t\n", verdict.ID, correctness, verdict.Faithfulness, verdict.Refused, verdict.RefusalAppropriate)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	metric := func(name string, value float64, before func(r *eval.AnswersReport) float64) {
+		if baseline != nil {
+			fmt.Fprintf(w, "%s: %.3f (%+.3f)\n", name, value, value-before(baseline))
+			return
+		}
+		fmt.Fprintf(w, "%s: %.3f\n", name, value)
+	}
+
+	fmt.Fprintln(w)
+	metric("correctness", report.Correctness, func(r *eval.AnswersReport) float64 { return r.Correctness })
+	metric("faithfulness", report.Faithfulness, func(r *eval.AnswersReport) float64 { return r.Faithfulness })
+	metric("refusal accuracy", report.RefusalAccuracy, func(r *eval.AnswersReport) float64 { return r.RefusalAccuracy })
+	fmt.Fprintf(w, "failed: %d\n", report.Failed)
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var evalCmd = &cobra.Command{
+	Use:   "eval",
+	Short: "Evaluates retrieval and answer quality against golden question sets",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return nil
+	},
+}
+
+func NewCommand() *cobra.Command {
+	evalCmd.AddCommand(newEvalRetrievalCommand())
+	evalCmd.AddCommand(newEvalGenerateCommand())
+	evalCmd.AddCommand(newEvalAnswersCommand())
+
+	return evalCmd
+}
+
+func readReport(path string, report any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read baseline report: %w", err)
+	}
+
+	if err := json.Unmarshal(data, report); err != nil {
+		return fmt.Errorf("failed to parse baseline report: %w", err)
+	}
+
+	return nil
+}
+
+func writeReport(w io.Writer, path string, report any) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	fmt.Fprintf(w, "report written to %s\n", path)
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package eval
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/eval"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/spf13/cobra"
+)
+
+func newEvalGenerateCommand() *cobra.Command {
+	var (
+		idxName string
+		n       int
+		output  string
+	)
+
+	evalGenerateCommand := &cobra.Command{
+		Use:   "generate",
+		Short: "Generate a question set for the retrieval evaluation from the chunks of an index",
+		Long: `Generate a question set for the retrieval evaluation from the chunks of an index.
+Chunks are sampled at random and the context LLM writes a question each of them answers, using eval.question_prompt.
+Trivial questions, questions which can't be understood on their own and duplicates are rejected.
+Every question expects its source chunk and document, with the answer written by the LLM as the reference answer, so the dataset can be passed to "petagpt eval retrieval" and "petagpt eval answers".`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if n <= 0 {
+				return fmt.Errorf("the number of questions must be positive")
+			}
+
+			idx, err := sqlc.New(db.MainDB).GetIndexByName(cmd.Context(), idxName)
+			if err != nil {
+				return fmt.Errorf("failed to find index: %w", err)
+			}
+
+			questions, stats, err := eval.GenerateQuestions(cmd.Context(), idx, n, func(accepted, total int) {
+				fmt.Fprintf(cmd.ErrOrStderr(), "\r%d/%d questions", accepted, total)
+			})
+			fmt.Fprintln(cmd.ErrOrStderr())
+			if err != nil {
+				return fmt.Errorf("failed to generate questions: %w", err)
+			}
+
+			fmt.Fprintf(cmd.ErrOrStderr(), "%d questions from %d chunks, rejected %d trivial, %d ambiguous, %d duplicate, %d failed; skipped %d short chunks\n",
+				len(questions), stats.Sampled, stats.Trivial, stats.Ambiguous, stats.Duplicate, stats.Failed, stats.TooShort)
+			if len(questions) < n {
+				fmt.Fprintf(cmd.ErrOrStderr(), "warning: only %d of %d questions were generated, every chunk of the index was sampled\n", len(questions), n)
+			}
+
+			if output == "" {
+				output = fmt.Sprintf("%s-questions.jsonl", idxName)
+			}
+
+			file, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to create dataset: %w", err)
+			}
+			defer file.Close()
+
+			w := bufio.NewWriter(file)
+			if err := eval.WriteQuestions(w, questions); err != nil {
+				return err
+			}
+			if err := w.Flush(); err != nil {
+				return fmt.Errorf("failed to write dataset: %w", err)
+			}
+
+			fmt.Fprintf(cmd.ErrOrStderr(), "dataset written to %s\n", output)
+
+			return file.Close()
+		},
+	}
+
+	evalGenerateCommand.Flags().StringVarP(&idxName, "index", "i", "vgim1", "The index whose chunks are sampled")
+	evalGenerateCommand.Flags().IntVarP(&n, "n", "n", 100, "The number of questions to generate")
+	evalGenerateCommand.Flags().StringVarP(&output, "output", "o", "", "The JSONL file the questions are written to (default <index>-questions.jsonl)")
+
+	return evalGenerateCommand
+}
@@ -0,0 +1,151 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/OptimusePrime/petagpt/internal/eval"
+	"github.com/spf13/cobra"
+)
+
+func newEvalRetrievalCommand() *cobra.Command {
+	var (
+		idxName  string
+		dataset  string
+		ks       []int
+		variants []string
+		output   string
+		baseline string
+	)
+
+	evalRetrievalCommand := &cobra.Command{
+		Use:   "retrieval",
+		Short: "Measure recall@k, MRR and nDCG of the BM25, vector and hybrid retrievers",
+		Long: `Measure recall@k, MRR and nDCG of the BM25, vector and hybrid retrievers.
+The dataset is a JSONL file with one question per line:
+  {"id": "q1", "question": "...", "chunk_ids": ["..."], "document_ids": [1], "answers": ["..."]}
+A hit is relevant if it is one of the expected chunks, belongs to one of the expected documents or contains one of the expected answers.
+The report is written as JSON, and can be compared with the report of an earlier run using --baseline.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if dataset == "" {
+				return fmt.Errorf("you must provide a dataset")
+			}
+
+			questions, err := eval.LoadQuestions(dataset)
+			if err != nil {
+				return err
+			}
+
+			var selected []eval.RetrievalVariant
+			for _, name := range variants {
+				i := slices.IndexFunc(eval.RetrievalVariants, func(v eval.RetrievalVariant) bool { return v.Name == name })
+				if i < 0 {
+					return fmt.Errorf("unknown retrieval variant: %s", name)
+				}
+				selected = append(selected, eval.RetrievalVariants[i])
+			}
+
+			report, err := eval.EvaluateRetrieval(cmd.Context(), idxName, questions, ks, selected, func(variant string, done, total int) {
+				fmt.Fprintf(cmd.ErrOrStderr(), "\r%s: %d/%d questions", variant, done, total)
+				if done == total {
+					fmt.Fprintln(cmd.ErrOrStderr())
+				}
+			})
+			if err != nil {
+				return fmt.Errorf("failed to evaluate retrieval: %w", err)
+			}
+			report.Dataset = dataset
+
+			var previous *eval.RetrievalReport
+			if baseline != "" {
+				previous = new(eval.RetrievalReport)
+				if err := readReport(baseline, previous); err != nil {
+					return err
+				}
+			}
+
+			if err := printRetrievalReport(cmd.OutOrStdout(), report, previous); err != nil {
+				return err
+			}
+
+			if output == "" {
+				output = fmt.Sprintf("retrieval-%s-%s.json", idxName, report.CreatedAt.Format("20060102-150405"))
+			}
+
+			return writeReport(cmd.ErrOrStderr(), output, report)
+		},
+	}
+
+	evalRetrievalCommand.Flags().StringVarP(&idxName, "index", "i", "vgim1", "The index to evaluate")
+	evalRetrievalCommand.Flags().StringVarP(&dataset, "dataset", "d", "", "The JSONL file with the golden questions")
+	evalRetrievalCommand.Flags().IntSliceVarP(&ks, "k", "k", []int{1, 5, 10}, "The ranks at which recall and nDCG are measured")
+	evalRetrievalCommand.Flags().StringSliceVar(&variants, "variant", []string{"bm25", "vector", "hybrid"}, "The retrievers to evaluate")
+	evalRetrievalCommand.Flags().StringVarP(&output, "output", "o", "", "The file the JSON report is written to (default retrieval-<index>-<time>.json)")
+	evalRetrievalCommand.Flags().StringVar(&baseline, "baseline", "", "A report of an earlier run to compare against")
+
+	return evalRetrievalCommand
+}
+
+// printRetrievalReport prints the metrics of every variant, followed by the
+// change from the same variant in the baseline, if there is one.
+func printRetrievalReport(w io.Writer, report *eval.RetrievalReport, baseline *eval.RetrievalReport) error {
+	header := []string{"VARIANT"}
+	for _, k := range report.K {
+		header = append(header, fmt.Sprintf("R@%d", k))
+	}
+	for _, k := range report.K {
+		header = append(header, fmt.Sprintf("NDCG@%d", k))
+	}
+	header = append(header, "MRR", "FAILED", "DEGRADED")
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, variant := range report.Variants {
+		var previous *eval.VariantReport
+		if baseline != nil {
+			if i := slices.IndexFunc(baseline.Variants, func(v eval.VariantReport) bool { return v.Name == variant.Name }); i >= 0 {
+				previous = &baseline.Variants[i]
+			}
+		}
+
+		// metric formats a value, with its change if the baseline has it.
+		metric := func(value float64, get func(v *eval.VariantReport) (float64, bool)) string {
+			if previous != nil {
+				if before, ok := get(previous); ok {
+					return fmt.Sprintf("%.3f (%+.3f)", value, value-before)
+				}
+			}
+			return fmt.Sprintf("%.3f", value)
+		}
+
+		row := []string{variant.Name}
+		for _, k := range report.K {
+			key := strconv.Itoa(k)
+			row = append(row, metric(variant.Recall[key], func(v *eval.VariantReport) (float64, bool) {
+				before, ok := v.Recall[key]
+				return before, ok
+			}))
+		}
+		for _, k := range report.K {
+			key := strconv.Itoa(k)
+			row = append(row, metric(variant.NDCG[key], func(v *eval.VariantReport) (float64, bool) {
+				before, ok := v.NDCG[key]
+				return before, ok
+			}))
+		}
+		row = append(row,
+			metric(variant.MRR, func(v *eval.VariantReport) (float64, bool) { return v.MRR, true }),
+			strconv.Itoa(variant.Failed),
+			strconv.Itoa(variant.Degraded),
+		)
+
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
@@ -35,7 +35,8 @@ func newIndexAddCommand() *cobra.Command {
 					String: description,
 					Valid:  true,
 				},
-				Path: filepath.Join(viper.GetString("data_dir"), "bm25", fmt.Sprintf("%s.bleve", name)),
+				Path:       filepath.Join(viper.GetString("data_dir"), "bm25", fmt.Sprintf("%s.bleve", name)),
+				Collection: name,
 			})
 			if err != nil {
 				if errors.Is(err, sqlite3.ErrConstraintUnique) {
@@ -0,0 +1,63 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/index"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/spf13/cobra"
+)
+
+func newIndexExportCommand() *cobra.Command {
+	var (
+		output         string
+		withEmbeddings bool
+	)
+
+	indexExportCommand := &cobra.Command{
+		Use:   "export",
+		Short: "Export an index with its documents, chunks and BM25 index to a .tar.zst archive",
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			if len(args) != 1 {
+				return fmt.Errorf("you must provide exactly one index name")
+			}
+
+			queries := sqlc.New(db.MainDB)
+
+			idx, err := queries.GetIndexByName(cmd.Context(), args[0])
+			if err != nil {
+				return fmt.Errorf("failed to find index: %w", err)
+			}
+
+			if output == "" {
+				output = fmt.Sprintf("%s.tar.zst", idx.Name)
+			}
+
+			file, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to create archive: %s: %w", output, err)
+			}
+			defer func() {
+				err = errors.Join(err, file.Close())
+				if err != nil {
+					os.Remove(output)
+				}
+			}()
+
+			err = index.ExportIndex(cmd.Context(), idx, file, withEmbeddings)
+			if err != nil {
+				return fmt.Errorf("failed to export index: %w", err)
+			}
+
+			return nil
+		},
+	}
+
+	indexExportCommand.Flags().StringVarP(&output, "output", "o", "", "The path of the archive, defaults to <name>.tar.zst")
+	indexExportCommand.Flags().BoolVarP(&withEmbeddings, "embeddings", "e", false, "Include the embeddings stored in Chroma")
+
+	return indexExportCommand
+}
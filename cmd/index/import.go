@@ -0,0 +1,51 @@
+package index
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/OptimusePrime/petagpt/internal/index"
+	"github.com/spf13/cobra"
+)
+
+func newIndexImportCommand() *cobra.Command {
+	var (
+		name    string
+		reembed bool
+	)
+
+	indexImportCommand := &cobra.Command{
+		Use:   "import",
+		Short: "Import an index from an archive created by `petagpt index export`",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("you must provide exactly one archive path")
+			}
+
+			file, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open archive: %s: %w", args[0], err)
+			}
+			defer file.Close()
+
+			idx, err := index.ImportIndex(cmd.Context(), file, index.ImportOptions{
+				Name:     name,
+				Reembed:  reembed,
+				Progress: rebuildProgress(cmd.ErrOrStderr(), "import"),
+			})
+			fmt.Fprintln(cmd.ErrOrStderr())
+			if err != nil {
+				return fmt.Errorf("failed to import index: %w", err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "imported index %s\n", idx.Name)
+
+			return nil
+		},
+	}
+
+	indexImportCommand.Flags().StringVarP(&name, "name", "n", "", "The name of the imported index, defaults to the exported name")
+	indexImportCommand.Flags().BoolVar(&reembed, "reembed", false, "Embed all chunks again even if the archive holds embeddings made with the configured model")
+
+	return indexImportCommand
+}
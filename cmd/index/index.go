@@ -13,6 +13,15 @@ var indexCmd = &cobra.Command{
 func NewCommand() *cobra.Command {
 	indexCmd.AddCommand(newIndexAddCommand())
 	indexCmd.AddCommand(newIndexRemoveCommand())
+	indexCmd.AddCommand(newIndexListCommand())
+	indexCmd.AddCommand(newIndexShowCommand())
+	indexCmd.AddCommand(newIndexUpdateCommand())
+	indexCmd.AddCommand(newIndexVerifyCommand())
+	indexCmd.AddCommand(newIndexRepairCommand())
+	indexCmd.AddCommand(newIndexRebuildCommand())
+	indexCmd.AddCommand(newIndexExportCommand())
+	indexCmd.AddCommand(newIndexImportCommand())
+	indexCmd.AddCommand(newIndexSyncCommand())
 
 	return indexCmd
 }
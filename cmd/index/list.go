@@ -0,0 +1,70 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/spf13/cobra"
+)
+
+type indexListEntry struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Documents   int64  `json:"documents"`
+	Chunks      int64  `json:"chunks"`
+	CreatedAt   string `json:"created_at"`
+}
+
+func newIndexListCommand() *cobra.Command {
+	var jsonOutput bool
+
+	indexListCommand := &cobra.Command{
+		Use:   "list",
+		Short: "List all indexes",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			queries := sqlc.New(db.MainDB)
+
+			indexes, err := queries.ListIndexes(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("failed to list indexes: %w", err)
+			}
+
+			entries := make([]indexListEntry, 0, len(indexes))
+			for _, idx := range indexes {
+				stats, err := queries.GetIndexStats(cmd.Context(), idx.ID)
+				if err != nil {
+					return fmt.Errorf("failed to get index statistics: %s: %w", idx.Name, err)
+				}
+
+				entries = append(entries, indexListEntry{
+					Name:        idx.Name,
+					Description: idx.Description.String,
+					Documents:   stats.DocumentCount,
+					Chunks:      stats.ChunkCount,
+					CreatedAt:   idx.CreatedAt.Format("2006-01-02 15:04"),
+				})
+			}
+
+			if jsonOutput {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(entries)
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tDOCUMENTS\tCHUNKS\tCREATED\tDESCRIPTION")
+			for _, entry := range entries {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n", entry.Name, entry.Documents, entry.Chunks, entry.CreatedAt, entry.Description)
+			}
+
+			return w.Flush()
+		},
+	}
+
+	indexListCommand.Flags().BoolVar(&jsonOutput, "json", false, "Print the indexes as JSON")
+
+	return indexListCommand
+}
@@ -0,0 +1,74 @@
+package index
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/index"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/spf13/cobra"
+)
+
+func newIndexRebuildCommand() *cobra.Command {
+	var (
+		vector   bool
+		bm25     bool
+		analyzer string
+	)
+
+	indexRebuildCommand := &cobra.Command{
+		Use:   "rebuild",
+		Short: "Rebuild the BM25 index and/or Chroma collection of an index from the chunks stored in the database",
+		Long: `Rebuild the BM25 index and/or Chroma collection of an index from the chunks stored in the database.
+Documents are not parsed or contextualized again. Use this after changing the embedding model, the BM25 analyzer or mapping.
+The new stores are built next to the old ones, which keep serving searches until they are swapped.
+Rebuilds both stores unless --vector or --bm25 is given.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("you must provide exactly one index name")
+			}
+
+			if !vector && !bm25 {
+				vector, bm25 = true, true
+			}
+
+			queries := sqlc.New(db.MainDB)
+
+			idx, err := queries.GetIndexByName(cmd.Context(), args[0])
+			if err != nil {
+				return fmt.Errorf("failed to find index: %w", err)
+			}
+
+			if bm25 {
+				err = index.RebuildBleveIndex(cmd.Context(), idx, analyzer, rebuildProgress(cmd.ErrOrStderr(), "bm25"))
+				fmt.Fprintln(cmd.ErrOrStderr())
+				if err != nil {
+					return fmt.Errorf("failed to rebuild BM25 index: %w", err)
+				}
+			}
+
+			if vector {
+				err = index.RebuildChromaCollection(cmd.Context(), idx, rebuildProgress(cmd.ErrOrStderr(), "chroma"))
+				fmt.Fprintln(cmd.ErrOrStderr())
+				if err != nil {
+					return fmt.Errorf("failed to rebuild Chroma collection: %w", err)
+				}
+			}
+
+			return nil
+		},
+	}
+
+	indexRebuildCommand.Flags().BoolVar(&vector, "vector", false, "Rebuild the Chroma collection")
+	indexRebuildCommand.Flags().BoolVar(&bm25, "bm25", false, "Rebuild the BM25 index")
+	indexRebuildCommand.Flags().StringVar(&analyzer, "analyzer", "en", "The Bleve analyzer used for the rebuilt BM25 index")
+
+	return indexRebuildCommand
+}
+
+func rebuildProgress(w io.Writer, store string) index.RebuildProgress {
+	return func(done, total int) {
+		fmt.Fprintf(w, "\r%s: %d/%d chunks", store, done, total)
+	}
+}
@@ -26,11 +26,15 @@ func newIndexRemoveCommand() *cobra.Command {
 					return fmt.Errorf("failed to find index: %w", err)
 				}
 
+				err = index.DefaultManager.Remove(idx.Name)
+				if err != nil {
+					return err
+				}
 				err = index.DeleteBleveIndex(idx.Path)
 				if err != nil {
 					return fmt.Errorf("failed to delete Bleve index: %w", err)
 				}
-				err = index.DeleteChromaCollection(cmd.Context(), idx.Name)
+				err = index.DeleteChromaCollection(cmd.Context(), idx.Collection)
 				if err != nil {
 					return fmt.Errorf("failed to delete Chroma collection: %w", err)
 				}
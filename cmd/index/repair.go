@@ -0,0 +1,67 @@
+package index
+
+import (
+	"fmt"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/index"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/spf13/cobra"
+)
+
+func newIndexRepairCommand() *cobra.Command {
+	var verbose bool
+
+	indexRepairCommand := &cobra.Command{
+		Use:   "repair",
+		Short: "Reconcile the BM25 index and the Chroma collection with the chunks stored in SQLite",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("you must provide at least one index name")
+			}
+
+			queries := sqlc.New(db.MainDB)
+
+			for _, idxName := range args {
+				idx, err := queries.GetIndexByName(cmd.Context(), idxName)
+				if err != nil {
+					return fmt.Errorf("failed to find index: %w", err)
+				}
+
+				report, err := index.VerifyIndex(cmd.Context(), idx)
+				if err != nil {
+					return fmt.Errorf("failed to verify index: %s: %w", idxName, err)
+				}
+
+				printConsistencyReport(cmd.OutOrStdout(), report, verbose)
+
+				if report.Consistent() {
+					continue
+				}
+
+				err = index.RepairIndex(cmd.Context(), idx, report)
+				if err != nil {
+					return fmt.Errorf("failed to repair index: %s: %w", idxName, err)
+				}
+
+				report, err = index.VerifyIndex(cmd.Context(), idx)
+				if err != nil {
+					return fmt.Errorf("failed to verify index: %s: %w", idxName, err)
+				}
+
+				fmt.Fprintln(cmd.OutOrStdout(), "after repair:")
+				printConsistencyReport(cmd.OutOrStdout(), report, verbose)
+
+				if !report.Consistent() {
+					return fmt.Errorf("index is still inconsistent after repair: %s", idxName)
+				}
+			}
+
+			return nil
+		},
+	}
+
+	indexRepairCommand.Flags().BoolVarP(&verbose, "verbose", "v", false, "List the IDs of all missing and orphaned chunks")
+
+	return indexRepairCommand
+}
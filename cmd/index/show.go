@@ -0,0 +1,81 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/index"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/spf13/cobra"
+)
+
+func newIndexShowCommand() *cobra.Command {
+	var jsonOutput bool
+
+	indexShowCommand := &cobra.Command{
+		Use:   "show",
+		Short: "Show the details and statistics of an index",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("you must provide exactly one index name")
+			}
+
+			queries := sqlc.New(db.MainDB)
+
+			idx, err := queries.GetIndexByName(cmd.Context(), args[0])
+			if err != nil {
+				return fmt.Errorf("failed to find index: %w", err)
+			}
+
+			stats, err := index.GetIndexStats(cmd.Context(), idx)
+			if err != nil {
+				return err
+			}
+
+			if jsonOutput {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(stats)
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "Name:\t%s\n", stats.Name)
+			fmt.Fprintf(w, "Description:\t%s\n", stats.Description)
+			fmt.Fprintf(w, "Created:\t%s\n", stats.CreatedAt.Format("2006-01-02 15:04:05"))
+			fmt.Fprintf(w, "Updated:\t%s\n", stats.UpdatedAt.Format("2006-01-02 15:04:05"))
+			fmt.Fprintf(w, "Documents:\t%d (%s)\n", stats.Documents, formatBytes(stats.TotalBytes))
+			fmt.Fprintf(w, "Chunks:\t%d\n", stats.Chunks)
+			fmt.Fprintf(w, "BM25 index:\t%s\n", stats.BlevePath)
+			fmt.Fprintf(w, "BM25 documents:\t%d (%s on disk)\n", stats.BleveDocuments, formatBytes(stats.BleveSize))
+			fmt.Fprintf(w, "Chroma collection:\t%s\n", stats.Collection)
+			fmt.Fprintf(w, "Chroma documents:\t%d\n", stats.ChromaDocuments)
+			fmt.Fprintf(w, "Embedding model:\t%s\n", stats.EmbeddingModel)
+			if stats.EmbeddingDimension > 0 {
+				fmt.Fprintf(w, "Embedding dimension:\t%d\n", stats.EmbeddingDimension)
+			}
+
+			return w.Flush()
+		},
+	}
+
+	indexShowCommand.Flags().BoolVar(&jsonOutput, "json", false, "Print the statistics as JSON")
+
+	return indexShowCommand
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
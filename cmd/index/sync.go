@@ -0,0 +1,144 @@
+package index
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/ingest"
+	"github.com/OptimusePrime/petagpt/internal/parser"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newIndexSyncCommand() *cobra.Command {
+	var (
+		watch        bool
+		debounce     time.Duration
+		opts         ingest.SyncOptions
+		numWorkers   int
+		requestDelay int
+	)
+
+	indexSyncCommand := &cobra.Command{
+		Use:   "sync <name> <dir>",
+		Short: "Mirror a directory to an index",
+		Long: `Mirror a directory to an index.
+New files are added, changed files are updated in place, renamed files are moved and documents whose files are gone are removed,
+matching files with documents by path and SHA-256.
+Documents outside the directory are left alone. With --watch, the index is kept up to date as files change.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("you must provide an index name and a directory")
+			}
+
+			if err := opts.Filter.Validate(); err != nil {
+				return err
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			if err := ingest.Recover(ctx); err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "warning: failed to recover incomplete operations: %s\n", err)
+			}
+
+			queries := sqlc.New(db.MainDB)
+
+			idx, err := queries.GetIndexByName(ctx, args[0])
+			if err != nil {
+				return fmt.Errorf("failed to find index: %w", err)
+			}
+
+			opts.Index = idx
+			opts.Dir = args[1]
+			opts.RequestDelay = requestDelay
+
+			dc, err := parser.NewDocumentChunker(ctx, numWorkers, viper.GetInt("context_llm.max_concurrent_requests"))
+			if err != nil {
+				return fmt.Errorf("failed to create a document chunker: %w", err)
+			}
+
+			if addr := viper.GetString("document_parser.webhook.listen"); addr != "" {
+				go func() {
+					if err := parser.ServeWebhooks(ctx, addr); err != nil {
+						fmt.Fprintf(cmd.ErrOrStderr(), "warning: falling back to polling parsing jobs: %s\n", err)
+					}
+				}()
+			}
+
+			syncer, err := ingest.NewSyncer(dc, opts)
+			if err != nil {
+				return err
+			}
+
+			if watch {
+				return syncer.Watch(ctx, debounce, func(result *ingest.SyncResult, err error) {
+					if result != nil {
+						printSyncResult(cmd.OutOrStdout(), args[1], result)
+					}
+					if err != nil && ctx.Err() == nil {
+						fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s\n", err)
+					}
+				})
+			}
+
+			result, err := syncer.Sync(ctx)
+			if result != nil {
+				printSyncResult(cmd.OutOrStdout(), args[1], result)
+			}
+			if err != nil {
+				return err
+			}
+			if len(result.Failed) > 0 {
+				return fmt.Errorf("failed to sync %d file(s)", len(result.Failed))
+			}
+
+			return nil
+		},
+	}
+
+	indexSyncCommand.Flags().BoolVar(&watch, "watch", false, "Keep syncing as files in the directory change")
+	indexSyncCommand.Flags().DurationVar(&debounce, "debounce", 2*time.Second, "With --watch, how long to wait for changes to settle before syncing")
+	indexSyncCommand.Flags().StringSliceVar(&opts.Filter.Include, "include", nil, "Only sync files matching these globs, e.g. '*.pdf'")
+	indexSyncCommand.Flags().StringSliceVar(&opts.Filter.Exclude, "exclude", nil, "Skip files and directories matching these globs, e.g. 'drafts/**'")
+	indexSyncCommand.Flags().StringSliceVarP(&opts.Tags, "tag", "t", nil, "Tag(s) to attach to added documents, usable as search filters")
+	indexSyncCommand.Flags().IntVarP(&opts.ChunkSize, "chunk_size", "c", 50, "Size of the chunks in number of sentences")
+	indexSyncCommand.Flags().IntVarP(&opts.Parallel, "parallel", "p", 4, "Number of documents processed at a time")
+	indexSyncCommand.Flags().IntVarP(&numWorkers, "num_workers", "w", 8, "Specify the number of workers for sentence segmentation")
+	indexSyncCommand.Flags().IntVarP(&requestDelay, "request_delay", "d", 0, "Delay between requests to the LLM service in milliseconds")
+
+	return indexSyncCommand
+}
+
+func printSyncResult(w io.Writer, dir string, result *ingest.SyncResult) {
+	fmt.Fprintf(w, "Synced %s: %d added, %d updated, %d moved, %d removed, %d unchanged, %d skipped, %d failed\n",
+		dir, len(result.Added), len(result.Updated), len(result.Moved), len(result.Removed), result.Unchanged, len(result.Skipped), len(result.Failed))
+
+	for _, path := range result.Added {
+		fmt.Fprintf(w, "  added    %s\n", path)
+	}
+	for _, path := range result.Updated {
+		fmt.Fprintf(w, "  updated  %s\n", path)
+	}
+	for _, move := range result.Moved {
+		fmt.Fprintf(w, "  moved    %s\n", move)
+	}
+	for _, path := range result.Removed {
+		fmt.Fprintf(w, "  removed  %s\n", path)
+	}
+	for _, path := range result.Queued {
+		fmt.Fprintf(w, "  queued   %s\n", path)
+	}
+	for _, skipped := range result.Skipped {
+		fmt.Fprintf(w, "  skipped  %s: %s\n", skipped.Path, skipped.Err)
+	}
+	for _, failure := range result.Failed {
+		fmt.Fprintf(w, "  failed   %s: %s\n", failure.Path, failure.Err)
+	}
+}
@@ -0,0 +1,70 @@
+package index
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/index"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/spf13/cobra"
+)
+
+func newIndexUpdateCommand() *cobra.Command {
+	var (
+		name,
+		description string
+	)
+
+	indexUpdateCommand := &cobra.Command{
+		Use:   "update",
+		Short: "Change the description of an index or rename it",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("you must provide exactly one index name")
+			}
+
+			queries := sqlc.New(db.MainDB)
+
+			idx, err := queries.GetIndexByName(cmd.Context(), args[0])
+			if err != nil {
+				return fmt.Errorf("failed to find index: %w", err)
+			}
+
+			if cmd.Flags().Changed("description") {
+				idx.Description = sql.NullString{
+					String: description,
+					Valid:  true,
+				}
+
+				err = queries.UpdateIndex(cmd.Context(), sqlc.UpdateIndexParams{
+					Name:        idx.Name,
+					Description: idx.Description,
+					ID:          idx.ID,
+				})
+				if err != nil {
+					return fmt.Errorf("failed to update index: %w", err)
+				}
+			}
+
+			if cmd.Flags().Changed("name") && name != idx.Name {
+				if len(strings.TrimSpace(name)) == 0 {
+					return fmt.Errorf("you must provide a name for the index")
+				}
+
+				err = index.RenameIndex(cmd.Context(), idx, name)
+				if err != nil {
+					return fmt.Errorf("failed to rename index: %w", err)
+				}
+			}
+
+			return nil
+		},
+	}
+
+	indexUpdateCommand.Flags().StringVarP(&name, "name", "n", "", "The new name of the index, must be unique")
+	indexUpdateCommand.Flags().StringVarP(&description, "description", "d", "", "The new description of the index")
+
+	return indexUpdateCommand
+}
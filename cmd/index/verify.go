@@ -0,0 +1,99 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/index"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/spf13/cobra"
+)
+
+func newIndexVerifyCommand() *cobra.Command {
+	var (
+		verbose    bool
+		jsonOutput bool
+	)
+
+	indexVerifyCommand := &cobra.Command{
+		Use:   "verify",
+		Short: "Check that SQLite, the BM25 index and the Chroma collection hold the same chunks",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("you must provide at least one index name")
+			}
+
+			queries := sqlc.New(db.MainDB)
+
+			var reports []*index.ConsistencyReport
+			consistent := true
+
+			for _, idxName := range args {
+				idx, err := queries.GetIndexByName(cmd.Context(), idxName)
+				if err != nil {
+					return fmt.Errorf("failed to find index: %w", err)
+				}
+
+				report, err := index.VerifyIndex(cmd.Context(), idx)
+				if err != nil {
+					return fmt.Errorf("failed to verify index: %s: %w", idxName, err)
+				}
+
+				reports = append(reports, report)
+				consistent = consistent && report.Consistent()
+			}
+
+			if jsonOutput {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(reports); err != nil {
+					return err
+				}
+			} else {
+				for _, report := range reports {
+					printConsistencyReport(cmd.OutOrStdout(), report, verbose)
+				}
+			}
+
+			if !consistent {
+				return fmt.Errorf("found inconsistencies, run `petagpt index repair` to fix them")
+			}
+
+			return nil
+		},
+	}
+
+	indexVerifyCommand.Flags().BoolVarP(&verbose, "verbose", "v", false, "List the IDs of all missing and orphaned chunks")
+	indexVerifyCommand.Flags().BoolVar(&jsonOutput, "json", false, "Print the reports as JSON")
+
+	return indexVerifyCommand
+}
+
+func printConsistencyReport(w io.Writer, report *index.ConsistencyReport, verbose bool) {
+	status := "consistent"
+	if !report.Consistent() {
+		status = "inconsistent"
+	}
+
+	fmt.Fprintf(w, "%s: %s\n", report.Index, status)
+	fmt.Fprintf(w, "  sqlite: %d chunks\n", report.SQLiteChunks)
+	printStoreReport(w, "bm25", report.Bleve, verbose)
+	printStoreReport(w, "chroma", report.Chroma, verbose)
+}
+
+func printStoreReport(w io.Writer, name string, report index.StoreReport, verbose bool) {
+	fmt.Fprintf(w, "  %s: %d chunks, %d missing, %d orphaned\n", name, report.Count, len(report.Missing), len(report.Orphaned))
+
+	if !verbose {
+		return
+	}
+
+	for _, id := range report.Missing {
+		fmt.Fprintf(w, "    missing  %s\n", id)
+	}
+	for _, id := range report.Orphaned {
+		fmt.Fprintf(w, "    orphaned %s\n", id)
+	}
+}
@@ -0,0 +1,35 @@
+package jobs
+
+import (
+	"fmt"
+
+	"github.com/OptimusePrime/petagpt/internal/ingest"
+	"github.com/spf13/cobra"
+)
+
+func newJobsCancelCommand() *cobra.Command {
+	jobsCancelCommand := &cobra.Command{
+		Use:   "cancel <id>...",
+		Short: "Cancel ingestion jobs",
+		Long:  "Cancel ingestion jobs which aren't completed, removing what they already added to the index. Running jobs are stopped by their worker shortly after.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ids, err := parseJobIDs(args)
+			if err != nil {
+				return err
+			}
+
+			for _, id := range ids {
+				if err := ingest.Cancel(cmd.Context(), id); err != nil {
+					return err
+				}
+
+				fmt.Fprintf(cmd.OutOrStdout(), "Cancelled job %d\n", id)
+			}
+
+			return nil
+		},
+	}
+
+	return jobsCancelCommand
+}
@@ -0,0 +1,38 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+var jobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "Manage the queue of documents being ingested",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return nil
+	},
+}
+
+func NewCommand() *cobra.Command {
+	jobsCmd.AddCommand(newJobsListCommand())
+	jobsCmd.AddCommand(newJobsRunCommand())
+	jobsCmd.AddCommand(newJobsRetryCommand())
+	jobsCmd.AddCommand(newJobsCancelCommand())
+
+	return jobsCmd
+}
+
+func parseJobIDs(args []string) ([]int64, error) {
+	ids := make([]int64, len(args))
+	for i, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid job ID: %s", arg)
+		}
+		ids[i] = id
+	}
+
+	return ids, nil
+}
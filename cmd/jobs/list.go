@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/spf13/cobra"
+)
+
+type jobListEntry struct {
+	ID        int64  `json:"id"`
+	Index     string `json:"index"`
+	FilePath  string `json:"file_path"`
+	FileSize  int64  `json:"file_size"`
+	Status    string `json:"status"`
+	Stage     string `json:"stage"`
+	Attempts  int64  `json:"attempts"`
+	Error     string `json:"error,omitempty"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+func newJobsListCommand() *cobra.Command {
+	var (
+		jsonOutput bool
+		status     string
+	)
+
+	jobsListCommand := &cobra.Command{
+		Use:   "list",
+		Short: "List ingestion jobs",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			queries := sqlc.New(db.MainDB)
+
+			rows, err := queries.ListIngestionJobs(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("failed to list ingestion jobs: %w", err)
+			}
+
+			entries := make([]jobListEntry, 0, len(rows))
+			for _, row := range rows {
+				if status != "" && row.Status != status {
+					continue
+				}
+
+				entries = append(entries, jobListEntry{
+					ID:        row.ID,
+					Index:     row.IndexName,
+					FilePath:  row.FilePath,
+					FileSize:  row.FileSize,
+					Status:    row.Status,
+					Stage:     row.Stage,
+					Attempts:  row.Attempts,
+					Error:     row.Error.String,
+					CreatedAt: row.CreatedAt.Format("2006-01-02 15:04"),
+					UpdatedAt: row.UpdatedAt.Format("2006-01-02 15:04"),
+				})
+			}
+
+			if jsonOutput {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(entries)
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tINDEX\tFILE\tSTATUS\tSTAGE\tATTEMPTS\tUPDATED\tERROR")
+			for _, entry := range entries {
+				errMsg := entry.Error
+				if len(errMsg) > 60 {
+					errMsg = errMsg[:57] + "..."
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", entry.ID, entry.Index, entry.FilePath, entry.Status, entry.Stage, entry.Attempts, entry.UpdatedAt, errMsg)
+			}
+
+			return w.Flush()
+		},
+	}
+
+	jobsListCommand.Flags().BoolVar(&jsonOutput, "json", false, "Print the jobs as JSON")
+	jobsListCommand.Flags().StringVarP(&status, "status", "s", "", "Only list jobs with this status: pending, running, failed, cancelled or completed")
+
+	return jobsListCommand
+}
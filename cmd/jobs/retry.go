@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"fmt"
+
+	"github.com/OptimusePrime/petagpt/internal/ingest"
+	"github.com/spf13/cobra"
+)
+
+func newJobsRetryCommand() *cobra.Command {
+	jobsRetryCommand := &cobra.Command{
+		Use:   "retry <id>...",
+		Short: "Queue failed or cancelled ingestion jobs again",
+		Long:  "Queue failed or cancelled ingestion jobs again. They resume after the last stage they completed once jobs run, document add or the server processes the queue.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ids, err := parseJobIDs(args)
+			if err != nil {
+				return err
+			}
+
+			if err := ingest.Recover(cmd.Context()); err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "warning: failed to recover incomplete operations: %s\n", err)
+			}
+
+			for _, id := range ids {
+				if err := ingest.Retry(cmd.Context(), id); err != nil {
+					return err
+				}
+
+				fmt.Fprintf(cmd.OutOrStdout(), "Queued job %d\n", id)
+			}
+
+			return nil
+		},
+	}
+
+	return jobsRetryCommand
+}
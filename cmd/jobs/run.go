@@ -0,0 +1,81 @@
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/OptimusePrime/petagpt/internal/ingest"
+	"github.com/OptimusePrime/petagpt/internal/parser"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newJobsRunCommand() *cobra.Command {
+	var (
+		numWorkers int
+		parallel   int
+	)
+
+	jobsRunCommand := &cobra.Command{
+		Use:   "run",
+		Short: "Process the pending ingestion jobs, resuming interrupted ones",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			if err := ingest.Recover(ctx); err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "warning: failed to recover incomplete operations: %s\n", err)
+			}
+
+			dc, err := parser.NewDocumentChunker(ctx, numWorkers, viper.GetInt("context_llm.max_concurrent_requests"))
+			if err != nil {
+				return fmt.Errorf("failed to create a document chunker: %w", err)
+			}
+
+			if addr := viper.GetString("document_parser.webhook.listen"); addr != "" {
+				go func() {
+					if err := parser.ServeWebhooks(ctx, addr); err != nil {
+						fmt.Fprintf(cmd.ErrOrStderr(), "warning: falling back to polling parsing jobs: %s\n", err)
+					}
+				}()
+			}
+
+			worker := ingest.NewWorker(dc)
+
+			var (
+				mu     sync.Mutex
+				failed int
+			)
+			worker.OnJobDone = func(job sqlc.IngestionJob, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				if err != nil {
+					failed++
+					fmt.Fprintf(cmd.ErrOrStderr(), "job %d failed: %s: %s\n", job.ID, job.FilePath, err)
+					return
+				}
+
+				fmt.Fprintf(cmd.OutOrStdout(), "Added %s\n", job.FilePath)
+			}
+
+			if err := worker.DrainParallel(ctx, parallel); err != nil {
+				return err
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d job(s) failed", failed)
+			}
+
+			return nil
+		},
+	}
+
+	jobsRunCommand.Flags().IntVarP(&numWorkers, "num_workers", "w", 8, "Specify the number of workers for sentence segmentation")
+	jobsRunCommand.Flags().IntVarP(&parallel, "parallel", "p", 4, "Number of jobs processed at a time")
+
+	return jobsRunCommand
+}
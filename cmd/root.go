@@ -4,11 +4,16 @@ import (
 	"context"
 	"os"
 
+	"github.com/OptimusePrime/petagpt/cmd/cache"
 	"github.com/OptimusePrime/petagpt/cmd/document"
+	"github.com/OptimusePrime/petagpt/cmd/eval"
 	"github.com/OptimusePrime/petagpt/cmd/index"
+	"github.com/OptimusePrime/petagpt/cmd/jobs"
+	"github.com/OptimusePrime/petagpt/cmd/search"
 	"github.com/OptimusePrime/petagpt/cmd/serve"
 	"github.com/OptimusePrime/petagpt/configs"
 	"github.com/OptimusePrime/petagpt/internal/db"
+	indexes "github.com/OptimusePrime/petagpt/internal/index"
 	"github.com/spf13/cobra"
 )
 
@@ -30,6 +35,9 @@ var (
 
 			return nil
 		},
+		PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+			return indexes.DefaultManager.Close()
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 
 			return nil
@@ -52,4 +60,8 @@ func init() {
 	rootCmd.AddCommand(serve.NewCommand())
 	rootCmd.AddCommand(index.NewCommand())
 	rootCmd.AddCommand(document.NewCommand())
+	rootCmd.AddCommand(search.NewCommand())
+	rootCmd.AddCommand(eval.NewCommand())
+	rootCmd.AddCommand(cache.NewCommand())
+	rootCmd.AddCommand(jobs.NewCommand())
 }
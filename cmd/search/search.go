@@ -0,0 +1,108 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/OptimusePrime/petagpt/internal/index"
+	"github.com/spf13/cobra"
+)
+
+func NewCommand() *cobra.Command {
+	var (
+		indexNames []string
+		topN       int
+		syntax     bool
+		highlight  string
+		jsonOutput bool
+		filter     index.SearchFilter
+	)
+
+	searchCmd := &cobra.Command{
+		Use:   "search <query>",
+		Short: "Searches the indexes and prints the ranked chunks",
+		Long: `Searches the indexes and prints the ranked chunks.
+
+With --syntax, the query uses the Bleve query string syntax for the BM25 retriever:
+  "exact phrase"    match a phrase
+  +word -word       require or exclude a word
+  context:word      search a specific field
+  word~2            match a word with up to 2 typos`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var refs []index.IndexRef
+			for _, name := range indexNames {
+				resolved, err := index.ResolveIndexRefs(name)
+				if err != nil {
+					return err
+				}
+				refs = append(refs, resolved...)
+			}
+
+			query := strings.Join(args, " ")
+
+			mode := index.QueryModeMatch
+			if syntax {
+				mode = index.QueryModeSyntax
+			}
+
+			result, err := index.SearchIndexes(cmd.Context(), refs, query, topN, &filter, mode)
+			if err != nil {
+				return fmt.Errorf("failed searching: %w", err)
+			}
+
+			documents := result.Documents
+			if len(documents) > topN {
+				documents = documents[:topN]
+			}
+
+			err = index.Highlight(documents, query, mode, highlight)
+			if err != nil {
+				return err
+			}
+
+			if jsonOutput {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(documents)
+			}
+
+			if result.Degraded {
+				fmt.Fprintf(cmd.ErrOrStderr(), "warning: degraded results: %s\n", result.DegradedReason)
+			}
+
+			for _, doc := range documents {
+				fmt.Fprintf(cmd.OutOrStdout(), "%d. %s", doc.Rank, doc.FileName)
+				if doc.Page > 0 {
+					fmt.Fprintf(cmd.OutOrStdout(), " (page %d)", doc.Page)
+				}
+				if len(refs) > 1 {
+					fmt.Fprintf(cmd.OutOrStdout(), " [%s]", doc.Index)
+				}
+				fmt.Fprintln(cmd.OutOrStdout())
+
+				if len(doc.Highlights) == 0 {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s\n\n", strings.TrimSpace(doc.Content))
+					continue
+				}
+				for _, fragment := range doc.Highlights {
+					fmt.Fprintf(cmd.OutOrStdout(), "  %s\n", strings.Join(strings.Fields(fragment), " "))
+				}
+				fmt.Fprintln(cmd.OutOrStdout())
+			}
+
+			return nil
+		},
+	}
+
+	searchCmd.Flags().StringSliceVarP(&indexNames, "index", "i", []string{"vgim1"}, "The indexes, or index groups from retrieval.index_groups, to search")
+	searchCmd.Flags().IntVarP(&topN, "top_n", "n", 10, "The number of results to print")
+	searchCmd.Flags().BoolVar(&syntax, "syntax", false, "Parse the query using the Bleve query string syntax")
+	searchCmd.Flags().StringVar(&highlight, "highlight", index.HighlightStyleANSI, "The style of the highlight markers, either html or ansi")
+	searchCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the results as JSON")
+	searchCmd.Flags().StringSliceVarP(&filter.Tags, "tag", "t", nil, "Only search documents with one of the tags")
+	searchCmd.Flags().StringSliceVar(&filter.FileTypes, "file_type", nil, "Only search documents of one of the file types")
+
+	return searchCmd
+}
@@ -5,7 +5,10 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var port string
+var (
+	port    string
+	idxName string
+)
 
 var serveCmd = &cobra.Command{
 	Use:   "serve",
@@ -45,12 +48,12 @@ var serveCmd = &cobra.Command{
 				}
 				fmt.Println(out.Sentences)*/
 
-		server.StartServer("vgim1", 20)
-
-		return nil
+		return server.StartServer(idxName, 20)
 	},
 }
 
 func NewCommand() *cobra.Command {
+	serveCmd.Flags().StringVarP(&idxName, "index", "i", "vgim1", "The index, or index group from retrieval.index_groups, used for retrieval")
+
 	return serveCmd
 }
@@ -0,0 +1,218 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/OptimusePrime/petagpt/internal/index"
+	"github.com/charmbracelet/log"
+	"github.com/openai/openai-go/v2"
+	"github.com/openai/openai-go/v2/option"
+	"github.com/spf13/viper"
+)
+
+// retrievalFilterSchema describes index.SearchFilter to the model so it can
+// optionally narrow down retrieval.
+var retrievalFilterSchema = map[string]any{
+	"type":        "object",
+	"description": "Optional filter restricting which documents are searched.",
+	"properties": map[string]any{
+		"document_ids": map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": "integer"},
+		},
+		"file_types": map[string]any{
+			"type":        "array",
+			"description": "File extensions, e.g. \".pdf\".",
+			"items":       map[string]any{"type": "string"},
+		},
+		"tags": map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": "string"},
+		},
+		"created_after": map[string]any{
+			"type":   "string",
+			"format": "date-time",
+		},
+		"created_before": map[string]any{
+			"type":   "string",
+			"format": "date-time",
+		},
+	},
+}
+
+// Retrieval searches all queries at once in all indexes and formats the
+// results for the model. degraded is set when some results are missing a
+// retriever or an index, or when retrieval failed completely, in which case
+// no chunks are returned.
+func Retrieval(ctx context.Context, queries []string, filter *index.SearchFilter, refs []index.IndexRef, topN int) (chunks string, degraded bool) {
+	results, err := index.SearchIndexesQueries(ctx, refs, queries, topN, filter, index.QueryModeMatch)
+	if err != nil {
+		log.Errorf("retrieval failed: %s", err.Error())
+		return "", true
+	}
+
+	for _, result := range results {
+		degraded = degraded || result.Degraded
+
+		docs := result.Documents[:min(topN, len(result.Documents))]
+
+		expanded, err := index.ExpandNeighbours(ctx, docs, viper.GetInt("retrieval.neighbours"))
+		if err != nil {
+			log.Errorf("failed to expand retrieved chunks: %s", err.Error())
+		} else {
+			docs = expanded
+		}
+
+		for _, doc := range docs {
+			chunks += fmt.Sprintf("<document>\n%s\n</document>\n", doc.Content)
+		}
+	}
+
+	return chunks, degraded
+}
+
+type retrievalArgs struct {
+	Queries []string
+	Filter  *index.SearchFilter
+	// FilterErr is why the filter sent by the model was dropped, if it was.
+	FilterErr error
+}
+
+// parseRetrievalArgs decodes the arguments of a retrieval tool call. A filter
+// which can't be decoded, e.g. because of a malformed date, is dropped so that
+// the queries are still searched.
+func parseRetrievalArgs(arguments string) (retrievalArgs, error) {
+	var raw struct {
+		Queries []string        `json:"queries"`
+		Filter  json.RawMessage `json:"filter"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &raw); err != nil {
+		return retrievalArgs{}, fmt.Errorf("failed to parse retrieval arguments: %w", err)
+	}
+	if len(raw.Queries) == 0 {
+		return retrievalArgs{}, errors.New("no queries given")
+	}
+
+	args := retrievalArgs{Queries: raw.Queries}
+	if len(raw.Filter) > 0 && string(raw.Filter) != "null" {
+		if err := json.Unmarshal(raw.Filter, &args.Filter); err != nil {
+			args.Filter = nil
+			args.FilterErr = err
+		}
+	}
+
+	return args, nil
+}
+
+// Response is the answer of the main LLM to a user message.
+type Response struct {
+	Content string
+	// Context holds the retrieved chunks as they were given to the model,
+	// empty if it didn't use the retrieval tool.
+	Context  string
+	Degraded bool
+}
+
+// Answer answers a user message with the main LLM, which may call the
+// retrieval tool once to search the indexes before answering.
+func Answer(ctx context.Context, userMessage string, refs []index.IndexRef, topN int) (*Response, error) {
+	client := openai.NewClient(
+		option.WithAPIKey(viper.GetString("main_llm.api_key")),
+		option.WithBaseURL(viper.GetString("main_llm.api_base")),
+	)
+
+	msgs := []openai.ChatCompletionMessageParamUnion{
+		openai.SystemMessage(viper.GetString("main_llm.system_prompt")),
+		openai.UserMessage(userMessage),
+	}
+
+	params := openai.ChatCompletionNewParams{
+		Messages:        msgs,
+		Model:           viper.GetString("main_llm.model"),
+		Temperature:     openai.Float(viper.GetFloat64("main_llm.temperature")),
+		TopP:            openai.Float(viper.GetFloat64("main_llm.top_p")),
+		ReasoningEffort: openai.ReasoningEffort(viper.GetString("main_llm.reasoning_effort")),
+		Tools: []openai.ChatCompletionToolUnionParam{
+			{
+				OfFunction: &openai.ChatCompletionFunctionToolParam{
+					Function: openai.FunctionDefinitionParam{
+						Name:        "retrieval",
+						Description: openai.String("Find information about V. gimnazija and related subjects. You may enter mulitple queries at once. Use the tool when you believe you need additional information to answer the question."),
+						Parameters: openai.FunctionParameters{
+							"type": "object",
+							"properties": map[string]any{
+								"queries": map[string]any{
+									"type": "array",
+									"items": map[string]any{
+										"type": "string",
+									},
+								},
+								"filter": retrievalFilterSchema,
+							},
+							"required": []string{"queries"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	chatCompl, err := client.Chat.Completions.New(
+		ctx, params,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the chat completer: %w", err)
+	}
+	if len(chatCompl.Choices) == 0 {
+		return nil, errors.New("empty response from LLM")
+	}
+
+	toolCalls := chatCompl.Choices[0].Message.ToolCalls
+	if len(toolCalls) == 0 {
+		return &Response{Content: chatCompl.Choices[0].Message.Content}, nil
+	}
+
+	response := new(Response)
+
+	params.Messages = append(params.Messages, chatCompl.Choices[0].Message.ToParam())
+	for _, toolCall := range toolCalls {
+		if toolCall.Function.Name == "retrieval" {
+			// The model is told what was wrong with its arguments rather than
+			// failing the whole answer.
+			args, err := parseRetrievalArgs(toolCall.Function.Arguments)
+			if err != nil {
+				log.Warnf("invalid retrieval arguments: %s", err.Error())
+				params.Messages = append(params.Messages, openai.ToolMessage(fmt.Sprintf("Invalid arguments: %s", err), toolCall.ID))
+				continue
+			}
+
+			chunks, degraded := Retrieval(ctx, args.Queries, args.Filter, refs, topN)
+			response.Degraded = response.Degraded || degraded
+			response.Context += chunks
+
+			if args.FilterErr != nil {
+				log.Warnf("ignoring invalid retrieval filter: %s", args.FilterErr.Error())
+				chunks = fmt.Sprintf("The filter was ignored because it is invalid: %s\n%s", args.FilterErr, chunks)
+			}
+
+			params.Messages = append(params.Messages, openai.ToolMessage(chunks, toolCall.ID))
+		}
+	}
+
+	chatCompl, err = client.Chat.Completions.New(
+		ctx, params,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if chatCompl == nil || len(chatCompl.Choices) == 0 {
+		return nil, errors.New("empty response from LLM")
+	}
+
+	response.Content = chatCompl.Choices[0].Message.Content
+
+	return response, nil
+}
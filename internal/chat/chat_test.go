@@ -0,0 +1,100 @@
+package chat
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseRetrievalArgs(t *testing.T) {
+	after := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		arguments string
+		queries   []string
+		tags      []string
+		after     *time.Time
+		filterErr bool
+		err       bool
+	}{
+		{
+			name:      "queries only",
+			arguments: `{"queries": ["raspored", "ispiti"]}`,
+			queries:   []string{"raspored", "ispiti"},
+		},
+		{
+			name:      "null filter",
+			arguments: `{"queries": ["raspored"], "filter": null}`,
+			queries:   []string{"raspored"},
+		},
+		{
+			name:      "valid filter",
+			arguments: `{"queries": ["raspored"], "filter": {"tags": ["2024"], "created_after": "2024-09-01T00:00:00Z"}}`,
+			queries:   []string{"raspored"},
+			tags:      []string{"2024"},
+			after:     &after,
+		},
+		{
+			name:      "malformed date drops the filter",
+			arguments: `{"queries": ["raspored"], "filter": {"tags": ["2024"], "created_after": "last September"}}`,
+			queries:   []string{"raspored"},
+			filterErr: true,
+		},
+		{
+			name:      "wrongly typed filter is dropped",
+			arguments: `{"queries": ["raspored"], "filter": "pdf only"}`,
+			queries:   []string{"raspored"},
+			filterErr: true,
+		},
+		{
+			name:      "malformed arguments",
+			arguments: `{"queries": "raspored"`,
+			err:       true,
+		},
+		{
+			name:      "no queries",
+			arguments: `{"filter": {"tags": ["2024"]}}`,
+			err:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := parseRetrievalArgs(tt.arguments)
+			if tt.err {
+				if err == nil {
+					t.Errorf("parseRetrievalArgs() = %+v, want an error", args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !slices.Equal(args.Queries, tt.queries) {
+				t.Errorf("Queries = %v, want %v", args.Queries, tt.queries)
+			}
+			if (args.FilterErr != nil) != tt.filterErr {
+				t.Errorf("FilterErr = %v, want an error: %v", args.FilterErr, tt.filterErr)
+			}
+
+			if tt.tags == nil && tt.after == nil {
+				if args.Filter != nil {
+					t.Errorf("Filter = %+v, want nil", args.Filter)
+				}
+				return
+			}
+
+			if args.Filter == nil {
+				t.Fatal("Filter = nil")
+			}
+			if !slices.Equal(args.Filter.Tags, tt.tags) {
+				t.Errorf("Tags = %v, want %v", args.Filter.Tags, tt.tags)
+			}
+			if args.Filter.CreatedAfter == nil || !args.Filter.CreatedAfter.Equal(*tt.after) {
+				t.Errorf("CreatedAfter = %v, want %v", args.Filter.CreatedAfter, tt.after)
+			}
+		})
+	}
+}
@@ -3,13 +3,77 @@ package db
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"path/filepath"
 
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/spf13/viper"
 )
 
-const SQLITE_VERSION = 2
+const SQLITE_VERSION = 11
+
+// migrations upgrade an existing database to the version they are keyed by.
+// Fresh databases are created directly from the full sqlc schema instead.
+var migrations = map[int]string{
+	3: `CREATE TABLE document_tags (
+    document_id INTEGER NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (document_id, tag)
+);`,
+	4: `ALTER TABLE chunks ADD COLUMN page INTEGER NOT NULL DEFAULT 0;`,
+	5: `ALTER TABLE indexes ADD COLUMN collection TEXT NOT NULL DEFAULT '';
+UPDATE indexes SET collection = name;`,
+	6: `ALTER TABLE chunks ADD COLUMN ordinal INTEGER;
+CREATE INDEX chunks_indexing_id ON chunks (indexing_id);
+CREATE INDEX chunks_document_ordinal ON chunks (document_id, ordinal);`,
+	7: `CREATE TABLE parse_cache (
+    id INTEGER PRIMARY KEY,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    file_sha256 TEXT NOT NULL,
+    settings TEXT NOT NULL,
+    file_name TEXT NOT NULL,
+    markdown TEXT NOT NULL,
+    pages INTEGER NOT NULL DEFAULT 0,
+    credits_used INTEGER NOT NULL DEFAULT 0,
+    UNIQUE (file_sha256, settings)
+);`,
+	8: `CREATE TABLE ingestion_jobs (
+    id INTEGER PRIMARY KEY,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    index_id INTEGER NOT NULL REFERENCES indexes (id) ON DELETE CASCADE,
+    file_path TEXT NOT NULL,
+    file_size INTEGER NOT NULL,
+    file_sha256 TEXT NOT NULL,
+    file_data BLOB,
+    tags TEXT NOT NULL DEFAULT '[]',
+    chunk_size INTEGER NOT NULL,
+    request_delay INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'pending',
+    stage TEXT NOT NULL DEFAULT 'queued',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    markdown TEXT,
+    chunks TEXT,
+    document_id INTEGER REFERENCES documents (id) ON DELETE SET NULL
+);
+
+CREATE INDEX ingestion_jobs_status ON ingestion_jobs (status);`,
+	9: `ALTER TABLE ingestion_jobs ADD COLUMN replaces_document_id INTEGER REFERENCES documents (id) ON DELETE SET NULL;
+ALTER TABLE ingestion_jobs ADD COLUMN force BOOLEAN NOT NULL DEFAULT 0;
+CREATE INDEX documents_index_path ON documents (index_id, filePath);
+CREATE INDEX documents_index_sha256 ON documents (index_id, fileSha256);`,
+	10: `CREATE TABLE chunk_removals (
+    id INTEGER PRIMARY KEY,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    index_id INTEGER NOT NULL REFERENCES indexes (id) ON DELETE CASCADE,
+    chunk_ids TEXT NOT NULL,
+    document_ids TEXT NOT NULL DEFAULT '[]'
+);`,
+	11: `ALTER TABLE chunks ADD COLUMN table_sha256 TEXT;`,
+}
 
 var MainDB *sql.DB
 
@@ -35,10 +99,47 @@ func InitDatabase(ctx context.Context) error {
 		return nil
 	}
 
-	/*	_, err = MainDB.ExecContext(ctx, sqlc.DDL)
-		if err != nil {
-			return err
-		}*/
+	var tableCount int
+	row = MainDB.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'indexes'")
+	if err = row.Scan(&tableCount); err != nil {
+		return err
+	}
+
+	if tableCount == 0 {
+		if err = migrate(ctx, SQLITE_VERSION, sqlc.DDL); err != nil {
+			return fmt.Errorf("failed creating database schema: %w", err)
+		}
+
+		return nil
+	}
+
+	for version := dbVersion + 1; version <= SQLITE_VERSION; version++ {
+		if err = migrate(ctx, version, migrations[version]); err != nil {
+			return fmt.Errorf("failed migrating database to version %d: %w", version, err)
+		}
+	}
 
 	return nil
 }
+
+// migrate runs the statements and sets the database version in a single
+// transaction, so that an interrupted migration is run again from the start.
+func migrate(ctx context.Context, version int, statements string) error {
+	tx, err := MainDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if statements != "" {
+		if _, err = tx.ExecContext(ctx, statements); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,240 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// version2Schema is the schema of databases created before migrations were
+// added, which are at version 2.
+const version2Schema = `CREATE TABLE indexes (
+    id INTEGER PRIMARY KEY,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    name TEXT UNIQUE NOT NULL,
+    description TEXT,
+    path TEXT NOT NULL
+);
+
+CREATE TABLE documents (
+    id INTEGER PRIMARY KEY,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    index_id INTEGER NOT NULL REFERENCES indexes (id) ON DELETE CASCADE,
+    filePath TEXT NOT NULL,
+    fileType VARCHAR(50) NOT NULL,
+    fileSize INTEGER NOT NULL,
+    fileSha256 VARCHAR(50) NOT NULL
+);
+
+CREATE TABLE chunks (
+    id INTEGER PRIMARY KEY,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    document_id INTEGER NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+    start_offset INTEGER,
+    end_offset INTEGER,
+    content TEXT NOT NULL,
+    context TEXT NOT NULL,
+    indexing_id TEXT NOT NULL
+);
+
+CREATE TABLE conversations (
+    id INTEGER PRIMARY KEY,
+    session_id TEXT NOT NULL UNIQUE,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE messages (
+    id INTEGER PRIMARY KEY,
+    conversation_id TEXT NOT NULL REFERENCES conversations (session_id) ON DELETE CASCADE,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ipv4_addr VARCHAR(50),
+    user_agent VARCHAR(255),
+    content TEXT NOT NULL,
+    role VARCHAR(50) NOT NULL
+);
+
+PRAGMA user_version = 2;`
+
+// initTestDatabase opens the database in dir after running setup on it.
+func initTestDatabase(t *testing.T, dir string, setup string) {
+	t.Helper()
+
+	if setup != "" {
+		conn, err := sql.Open("sqlite3", filepath.Join(dir, "storage.sqlite"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = conn.Exec(setup); err != nil {
+			t.Fatal(err)
+		}
+		if err = conn.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	viper.Set("data_dir", dir)
+	t.Cleanup(func() { viper.Set("data_dir", "") })
+
+	if err := InitDatabase(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = MainDB.Close() })
+}
+
+// describeSchema lists the columns of every table and the indexes, ignoring
+// the order columns were added in.
+func describeSchema(t *testing.T, conn *sql.DB) []string {
+	t.Helper()
+
+	rows, err := conn.Query("SELECT type, name, tbl_name FROM sqlite_master WHERE name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var schema, tables []string
+	for rows.Next() {
+		var kind, name, table string
+		if err := rows.Scan(&kind, &name, &table); err != nil {
+			t.Fatal(err)
+		}
+		schema = append(schema, fmt.Sprintf("%s %s on %s", kind, name, table))
+		if kind == "table" {
+			tables = append(tables, name)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range tables {
+		columns, err := conn.Query(fmt.Sprintf("SELECT name, type, \"notnull\", coalesce(dflt_value, '') FROM pragma_table_info('%s')", table))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for columns.Next() {
+			var name, kind, dflt string
+			var notNull bool
+			if err := columns.Scan(&name, &kind, &notNull, &dflt); err != nil {
+				t.Fatal(err)
+			}
+			// Columns added as NOT NULL need a default, which columns
+			// created with the table don't.
+			if notNull && dflt == "''" {
+				dflt = ""
+			}
+			schema = append(schema, fmt.Sprintf("column %s.%s %s not null=%v default=%s", table, name, kind, notNull, dflt))
+		}
+		_ = columns.Close()
+	}
+
+	slices.Sort(schema)
+	return schema
+}
+
+func userVersion(t *testing.T) int {
+	t.Helper()
+
+	var version int
+	if err := MainDB.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+
+	return version
+}
+
+func TestMigrationsMatchSchema(t *testing.T) {
+	initTestDatabase(t, t.TempDir(), "")
+	fresh := describeSchema(t, MainDB)
+
+	initTestDatabase(t, t.TempDir(), version2Schema+`
+INSERT INTO indexes (name, path) VALUES ('vgim', 'vgim.bleve');`)
+
+	if got := userVersion(t); got != SQLITE_VERSION {
+		t.Errorf("user_version = %d, want %d", got, SQLITE_VERSION)
+	}
+
+	migrated := describeSchema(t, MainDB)
+	for _, line := range migrated {
+		if !slices.Contains(fresh, line) {
+			t.Errorf("migrated database has %s", line)
+		}
+	}
+	for _, line := range fresh {
+		if !slices.Contains(migrated, line) {
+			t.Errorf("migrated database lacks %s", line)
+		}
+	}
+
+	// Migration 5 names collections after their indexes.
+	var collection string
+	if err := MainDB.QueryRow("SELECT collection FROM indexes WHERE name = 'vgim'").Scan(&collection); err != nil {
+		t.Fatal(err)
+	}
+	if collection != "vgim" {
+		t.Errorf("collection = %q, want %q", collection, "vgim")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name       string
+		statements string
+		version    int
+		tables     []string
+		err        bool
+	}{
+		{
+			name:       "applies statements and version",
+			statements: "CREATE TABLE a (id INTEGER); CREATE TABLE b (id INTEGER);",
+			version:    SQLITE_VERSION + 1,
+			tables:     []string{"a", "b"},
+		},
+		{
+			name:    "version only",
+			version: SQLITE_VERSION + 1,
+		},
+		{
+			name:       "failed statement rolls everything back",
+			statements: "CREATE TABLE a (id INTEGER); ALTER TABLE missing ADD COLUMN x INTEGER;",
+			version:    SQLITE_VERSION,
+			err:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTestDatabase(t, t.TempDir(), "")
+
+			err := migrate(context.Background(), SQLITE_VERSION+1, tt.statements)
+			if (err != nil) != tt.err {
+				t.Fatalf("migrate() error = %v, want an error: %v", err, tt.err)
+			}
+
+			if got := userVersion(t); got != tt.version {
+				t.Errorf("user_version = %d, want %d", got, tt.version)
+			}
+
+			for _, table := range []string{"a", "b"} {
+				var n int
+				err := MainDB.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&n)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := slices.Contains(tt.tables, table); (n == 1) != want {
+					t.Errorf("table %s exists = %v, want %v", table, n == 1, want)
+				}
+			}
+		})
+	}
+}
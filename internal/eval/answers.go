@@ -0,0 +1,226 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OptimusePrime/petagpt/internal/chat"
+	"github.com/OptimusePrime/petagpt/internal/index"
+	"github.com/openai/openai-go/v2"
+	"github.com/openai/openai-go/v2/option"
+	"github.com/openai/openai-go/v2/shared"
+	"github.com/spf13/viper"
+	"golang.org/x/sync/semaphore"
+)
+
+// Verdict is the judgement of one answer. Correctness and faithfulness are
+// scored from 1 to 5. Correctness is 0 when there is no reference answer to
+// compare with, or when the question should have been refused.
+type Verdict struct {
+	ID       string `json:"id"`
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+	Degraded bool   `json:"degraded,omitempty"`
+
+	Correctness  int  `json:"correctness"`
+	Faithfulness int  `json:"faithfulness"`
+	Refused      bool `json:"refused"`
+	// RefusalAppropriate is set if the answer was refused exactly when the
+	// question should have been.
+	RefusalAppropriate bool   `json:"refusal_appropriate"`
+	Explanation        string `json:"explanation"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// AnswersReport holds the verdicts of all questions and their averages.
+// Failed questions are left out of the averages.
+type AnswersReport struct {
+	Dataset   string    `json:"dataset"`
+	Indexes   []string  `json:"indexes"`
+	Model     string    `json:"model"`
+	Judge     string    `json:"judge"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Correctness     float64 `json:"correctness"`
+	Faithfulness    float64 `json:"faithfulness"`
+	RefusalAccuracy float64 `json:"refusal_accuracy"`
+	Failed          int     `json:"failed"`
+
+	Verdicts []Verdict `json:"verdicts"`
+}
+
+type judgement struct {
+	Correctness  int    `json:"correctness"`
+	Faithfulness int    `json:"faithfulness"`
+	Refused      bool   `json:"refused"`
+	Explanation  string `json:"explanation"`
+}
+
+// EvaluateAnswers answers every question with the chat pipeline used by the
+// server and has the judge LLM score the answers. Up to
+// main_llm.max_concurrent_requests questions are evaluated at once.
+func EvaluateAnswers(ctx context.Context, questions []Question, refs []index.IndexRef, topN int, progress func(done, total int)) (*AnswersReport, error) {
+	for _, question := range questions {
+		if question.Answer == "" && !question.Refuse {
+			return nil, fmt.Errorf("question %s has no reference answer and isn't meant to be refused", question.ID)
+		}
+	}
+
+	report := &AnswersReport{
+		Model:     viper.GetString("main_llm.model"),
+		Judge:     viper.GetString("judge_llm.model"),
+		CreatedAt: time.Now(),
+		Verdicts:  make([]Verdict, len(questions)),
+	}
+	for _, ref := range refs {
+		report.Indexes = append(report.Indexes, ref.Name)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		done int
+		sem  = semaphore.NewWeighted(max(viper.GetInt64("main_llm.max_concurrent_requests"), 1))
+	)
+
+	for i, question := range questions {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer sem.Release(1)
+
+			report.Verdicts[i] = evaluateAnswer(ctx, question, refs, topN)
+
+			if progress != nil {
+				mu.Lock()
+				done++
+				progress(done, len(questions))
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var correctnessCount, judgedCount, appropriateCount int
+	for _, verdict := range report.Verdicts {
+		if verdict.Error != "" {
+			report.Failed++
+			continue
+		}
+
+		judgedCount++
+		report.Faithfulness += float64(verdict.Faithfulness)
+		if verdict.RefusalAppropriate {
+			appropriateCount++
+		}
+		if verdict.Correctness > 0 {
+			correctnessCount++
+			report.Correctness += float64(verdict.Correctness)
+		}
+	}
+
+	if judgedCount > 0 {
+		report.Faithfulness /= float64(judgedCount)
+		report.RefusalAccuracy = float64(appropriateCount) / float64(judgedCount)
+	}
+	if correctnessCount > 0 {
+		report.Correctness /= float64(correctnessCount)
+	}
+
+	return report, nil
+}
+
+func evaluateAnswer(ctx context.Context, question Question, refs []index.IndexRef, topN int) Verdict {
+	verdict := Verdict{
+		ID:       question.ID,
+		Question: question.Question,
+	}
+
+	response, err := chat.Answer(ctx, question.Question, refs, topN)
+	if err != nil {
+		verdict.Error = fmt.Sprintf("failed to answer: %s", err.Error())
+		return verdict
+	}
+	verdict.Answer = response.Content
+	verdict.Degraded = response.Degraded
+
+	judged, err := judgeAnswer(ctx, question, response)
+	if err != nil {
+		verdict.Error = err.Error()
+		return verdict
+	}
+
+	verdict.Faithfulness = min(max(judged.Faithfulness, 1), 5)
+	verdict.Refused = judged.Refused
+	verdict.RefusalAppropriate = judged.Refused == question.Refuse
+	verdict.Explanation = judged.Explanation
+	if !question.Refuse && question.Answer != "" {
+		verdict.Correctness = min(max(judged.Correctness, 1), 5)
+	}
+
+	return verdict
+}
+
+func judgeAnswer(ctx context.Context, question Question, response *chat.Response) (judgement, error) {
+	client := openai.NewClient(
+		option.WithAPIKey(viper.GetString("judge_llm.api_key")),
+		option.WithBaseURL(viper.GetString("judge_llm.api_base")),
+	)
+
+	reference := question.Answer
+	if question.Refuse {
+		reference = "The question is out of scope and should be refused."
+	}
+
+	r := strings.NewReplacer(
+		"{{QUESTION}}", question.Question,
+		"{{REFERENCE}}", reference,
+		"{{CONTEXT}}", response.Context,
+		"{{ANSWER}}", response.Content,
+	)
+
+	replacedPrompt := r.Replace(viper.GetString("judge_llm.prompt"))
+
+	chatCompl, err := client.Chat.Completions.New(
+		ctx, openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{
+				openai.UserMessage(replacedPrompt),
+			},
+			Model:       viper.GetString("judge_llm.model"),
+			Temperature: openai.Float(viper.GetFloat64("judge_llm.temperature")),
+			ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
+				OfJSONObject: &shared.ResponseFormatJSONObjectParam{},
+			},
+		},
+	)
+	if err != nil {
+		return judgement{}, fmt.Errorf("failed to judge answer: %w", err)
+	}
+
+	if len(chatCompl.Choices) == 0 {
+		return judgement{}, errors.New("empty response from LLM")
+	}
+
+	var judged judgement
+	err = json.Unmarshal([]byte(chatCompl.Choices[0].Message.Content), &judged)
+	if err != nil {
+		return judgement{}, fmt.Errorf("failed to parse judgement: %w", err)
+	}
+
+	return judged, nil
+}
@@ -0,0 +1,198 @@
+package eval
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/openai/openai-go/v2"
+	"github.com/openai/openai-go/v2/option"
+	"github.com/openai/openai-go/v2/shared"
+	"github.com/spf13/viper"
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	// minQuestionChunkLength is the length in characters below which chunks
+	// are too short to ask a meaningful question about.
+	minQuestionChunkLength = 200
+	minQuestionLength      = 10
+	// questionSampleFactor is how many more chunks are sampled than questions
+	// missing, since some of the generated questions are rejected.
+	questionSampleFactor = 2
+)
+
+// GenerateStats counts the chunks questions were generated for and why
+// questions were rejected.
+type GenerateStats struct {
+	Sampled   int
+	TooShort  int
+	Trivial   int
+	Ambiguous int
+	Duplicate int
+	Failed    int
+}
+
+type generatedQuestion struct {
+	Question   string `json:"question"`
+	Answer     string `json:"answer"`
+	Standalone bool   `json:"standalone"`
+	Trivial    bool   `json:"trivial"`
+}
+
+// GenerateQuestions samples chunks of the index and asks the context LLM for
+// a question each of them answers, in batches until n questions are accepted
+// or every chunk has been sampled. Questions the model marks as trivial or not
+// understandable on their own, as well as duplicates, are rejected.
+func GenerateQuestions(ctx context.Context, idx sqlc.Index, n int, progress func(accepted, total int)) ([]Question, GenerateStats, error) {
+	var stats GenerateStats
+
+	queries := sqlc.New(db.MainDB)
+
+	chunkIDs, err := queries.SampleChunkIDsByIndexID(ctx, idx.ID)
+	if err != nil {
+		return nil, stats, fmt.Errorf("failed to sample chunks: %w", err)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		questions []Question
+		seen      = make(map[string]bool)
+		sem       = semaphore.NewWeighted(max(viper.GetInt64("context_llm.max_concurrent_requests"), 1))
+	)
+
+	for len(chunkIDs) > 0 && len(questions) < n && ctx.Err() == nil {
+		// Every batch samples more chunks than questions are missing, since
+		// some of them are rejected.
+		batch := chunkIDs[:min((n-len(questions))*questionSampleFactor, len(chunkIDs))]
+		chunkIDs = chunkIDs[len(batch):]
+
+		for _, id := range batch {
+			chunk, err := queries.GetChunk(ctx, id)
+			if errors.Is(err, sql.ErrNoRows) {
+				// Removed since it was sampled.
+				continue
+			}
+			if err != nil {
+				wg.Wait()
+				return nil, stats, fmt.Errorf("failed to get chunk: %w", err)
+			}
+
+			if utf8.RuneCountInString(chunk.Content) < minQuestionChunkLength {
+				stats.TooShort++
+				continue
+			}
+
+			if err := sem.Acquire(ctx, 1); err != nil {
+				break
+			}
+
+			mu.Lock()
+			done := len(questions) >= n
+			if !done {
+				stats.Sampled++
+			}
+			mu.Unlock()
+			if done {
+				sem.Release(1)
+				break
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer sem.Release(1)
+
+				generated, err := generateQuestion(ctx, chunk)
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				key := strings.ToLower(strings.TrimSpace(generated.Question))
+
+				switch {
+				case err != nil:
+					stats.Failed++
+				case generated.Trivial || utf8.RuneCountInString(key) < minQuestionLength:
+					stats.Trivial++
+				case !generated.Standalone:
+					stats.Ambiguous++
+				case seen[key]:
+					stats.Duplicate++
+				case len(questions) < n:
+					seen[key] = true
+					questions = append(questions, Question{
+						ID:          chunk.IndexingID,
+						Question:    strings.TrimSpace(generated.Question),
+						ChunkIDs:    []string{chunk.IndexingID},
+						DocumentIDs: []int64{chunk.DocumentID},
+						Answer:      strings.TrimSpace(generated.Answer),
+					})
+
+					if progress != nil {
+						progress(len(questions), n)
+					}
+				}
+			}()
+		}
+
+		wg.Wait()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, stats, err
+	}
+
+	return questions, stats, nil
+}
+
+func generateQuestion(ctx context.Context, chunk sqlc.Chunk) (generatedQuestion, error) {
+	client := openai.NewClient(
+		option.WithAPIKey(viper.GetString("context_llm.api_key")),
+		option.WithBaseURL(viper.GetString("context_llm.api_base")),
+	)
+
+	r := strings.NewReplacer(
+		"{{CONTEXT}}", chunk.Context,
+		"{{CHUNK}}", chunk.Content,
+	)
+
+	replacedPrompt := r.Replace(viper.GetString("eval.question_prompt"))
+
+	chatCompl, err := client.Chat.Completions.New(
+		ctx, openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{
+				openai.UserMessage(replacedPrompt),
+			},
+			Model:       viper.GetString("context_llm.model"),
+			Temperature: openai.Float(viper.GetFloat64("context_llm.temperature")),
+			TopP:        openai.Float(viper.GetFloat64("context_llm.top_p")),
+			ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
+				OfJSONObject: &shared.ResponseFormatJSONObjectParam{},
+			},
+		},
+	)
+	if err != nil {
+		return generatedQuestion{}, fmt.Errorf("failed to generate question: %w", err)
+	}
+
+	if len(chatCompl.Choices) == 0 {
+		return generatedQuestion{}, errors.New("empty response from LLM")
+	}
+
+	var generated generatedQuestion
+	err = json.Unmarshal([]byte(chatCompl.Choices[0].Message.Content), &generated)
+	if err != nil {
+		return generatedQuestion{}, fmt.Errorf("failed to parse generated question: %w", err)
+	}
+
+	return generated, nil
+}
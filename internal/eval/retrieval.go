@@ -0,0 +1,303 @@
+package eval
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OptimusePrime/petagpt/internal/index"
+)
+
+// Question is one line of a golden question set. For the retrieval
+// evaluation, a search hit is relevant if it is one of the expected chunks,
+// belongs to one of the expected documents or contains one of the expected
+// answer substrings. The answer evaluation compares the answer with the
+// reference Answer, or expects a refusal if Refuse is set.
+type Question struct {
+	ID          string   `json:"id"`
+	Question    string   `json:"question"`
+	ChunkIDs    []string `json:"chunk_ids,omitempty"`
+	DocumentIDs []int64  `json:"document_ids,omitempty"`
+	Answers     []string `json:"answers,omitempty"`
+	Answer      string   `json:"answer,omitempty"`
+	Refuse      bool     `json:"refuse,omitempty"`
+}
+
+// expectedItems returns the number of chunks, documents and answers a perfect
+// retriever would find.
+func (q Question) expectedItems() int {
+	return len(q.ChunkIDs) + len(q.DocumentIDs) + len(q.Answers)
+}
+
+// matchedItems returns the indexes of the expected items found in doc, chunks
+// first, then documents and answers.
+func (q Question) matchedItems(doc index.SearchDocument) []int {
+	var items []int
+	for i, chunkID := range q.ChunkIDs {
+		if doc.ID == chunkID {
+			items = append(items, i)
+		}
+	}
+	for i, documentID := range q.DocumentIDs {
+		if doc.DocumentID == documentID {
+			items = append(items, len(q.ChunkIDs)+i)
+		}
+	}
+
+	content := strings.ToLower(doc.Content)
+	for i, answer := range q.Answers {
+		if strings.Contains(content, strings.ToLower(answer)) {
+			items = append(items, len(q.ChunkIDs)+len(q.DocumentIDs)+i)
+		}
+	}
+
+	return items
+}
+
+// LoadQuestions reads a JSONL question set.
+func LoadQuestions(path string) ([]Question, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dataset: %w", err)
+	}
+	defer file.Close()
+
+	var questions []Question
+
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for {
+		var question Question
+		err := decoder.Decode(&question)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse question %d: %w", len(questions)+1, err)
+		}
+
+		if question.Question == "" {
+			return nil, fmt.Errorf("question %d has no question", len(questions)+1)
+		}
+		if question.ID == "" {
+			question.ID = strconv.Itoa(len(questions) + 1)
+		}
+
+		questions = append(questions, question)
+	}
+
+	return questions, nil
+}
+
+// WriteQuestions writes a JSONL question set which LoadQuestions can read.
+func WriteQuestions(w io.Writer, questions []Question) error {
+	encoder := json.NewEncoder(w)
+	for _, question := range questions {
+		if err := encoder.Encode(question); err != nil {
+			return fmt.Errorf("failed to write question: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// RetrievalVariant is a way of searching an index which is evaluated.
+type RetrievalVariant struct {
+	Name   string
+	Search func(ctx context.Context, indexName string, query string, topN int) (*index.SearchResult, error)
+}
+
+// RetrievalVariants are the BM25-only, vector-only and hybrid retrievers.
+var RetrievalVariants = []RetrievalVariant{
+	{
+		Name: "bm25",
+		Search: func(ctx context.Context, indexName string, query string, topN int) (*index.SearchResult, error) {
+			return index.SearchBM25(ctx, indexName, query, topN, nil, index.QueryModeMatch)
+		},
+	},
+	{
+		Name: "vector",
+		Search: func(ctx context.Context, indexName string, query string, topN int) (*index.SearchResult, error) {
+			return index.SearchVector(ctx, indexName, query, topN, nil, index.QueryModeMatch)
+		},
+	},
+	{
+		Name: "hybrid",
+		Search: func(ctx context.Context, indexName string, query string, topN int) (*index.SearchResult, error) {
+			return index.SearchIndex(ctx, indexName, query, topN, nil, index.QueryModeMatch)
+		},
+	},
+}
+
+// RetrievalReport holds the metrics of every variant, averaged over all
+// questions. Failed searches count as finding nothing.
+type RetrievalReport struct {
+	Index     string          `json:"index"`
+	Dataset   string          `json:"dataset"`
+	CreatedAt time.Time       `json:"created_at"`
+	Questions int             `json:"questions"`
+	K         []int           `json:"k"`
+	Variants  []VariantReport `json:"variants"`
+}
+
+type VariantReport struct {
+	Name string `json:"name"`
+	// Recall and NDCG are keyed by k.
+	Recall map[string]float64 `json:"recall"`
+	NDCG   map[string]float64 `json:"ndcg"`
+	MRR    float64            `json:"mrr"`
+	// Failed and Degraded count the questions whose search failed or
+	// returned degraded results.
+	Failed   int              `json:"failed"`
+	Degraded int              `json:"degraded"`
+	Results  []QuestionResult `json:"results"`
+}
+
+// QuestionResult records the rank of the first relevant hit of a question,
+// 0 if none was found, so runs can be compared question by question.
+type QuestionResult struct {
+	ID    string `json:"id"`
+	Rank  int    `json:"rank"`
+	Error string `json:"error,omitempty"`
+}
+
+// EvaluateRetrieval searches every question with every variant, retrieving
+// as many hits as the largest k.
+func EvaluateRetrieval(ctx context.Context, indexName string, questions []Question, ks []int, variants []RetrievalVariant, progress func(variant string, done, total int)) (*RetrievalReport, error) {
+	if len(ks) == 0 {
+		return nil, errors.New("no k to evaluate at")
+	}
+
+	for _, question := range questions {
+		if question.expectedItems() == 0 {
+			return nil, fmt.Errorf("question %s has no expected chunks, documents or answers", question.ID)
+		}
+	}
+
+	ks = slices.Clone(ks)
+	slices.Sort(ks)
+	topN := ks[len(ks)-1]
+
+	report := &RetrievalReport{
+		Index:     indexName,
+		CreatedAt: time.Now(),
+		Questions: len(questions),
+		K:         ks,
+	}
+
+	for _, variant := range variants {
+		variantReport := VariantReport{
+			Name:   variant.Name,
+			Recall: make(map[string]float64),
+			NDCG:   make(map[string]float64),
+		}
+
+		for i, question := range questions {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			if progress != nil {
+				progress(variant.Name, i, len(questions))
+			}
+
+			result, err := variant.Search(ctx, indexName, question.Question, topN)
+			if err != nil {
+				variantReport.Failed++
+				variantReport.Results = append(variantReport.Results, QuestionResult{ID: question.ID, Error: err.Error()})
+				continue
+			}
+			if result.Degraded {
+				variantReport.Degraded++
+			}
+
+			counts := newlyFound(question, result.Documents[:min(topN, len(result.Documents))])
+
+			rank := firstRelevantRank(counts)
+			if rank > 0 {
+				variantReport.MRR += 1 / float64(rank)
+			}
+
+			for _, k := range ks {
+				key := strconv.Itoa(k)
+				variantReport.Recall[key] += recallAt(counts, k, question.expectedItems())
+				variantReport.NDCG[key] += ndcgAt(counts, k, question.expectedItems())
+			}
+
+			variantReport.Results = append(variantReport.Results, QuestionResult{ID: question.ID, Rank: rank})
+		}
+
+		if progress != nil {
+			progress(variant.Name, len(questions), len(questions))
+		}
+
+		if len(questions) > 0 {
+			variantReport.MRR /= float64(len(questions))
+			for _, k := range ks {
+				key := strconv.Itoa(k)
+				variantReport.Recall[key] /= float64(len(questions))
+				variantReport.NDCG[key] /= float64(len(questions))
+			}
+		}
+
+		report.Variants = append(report.Variants, variantReport)
+	}
+
+	return report, nil
+}
+
+// newlyFound returns for every hit the number of expected items it found
+// which no better ranked hit found. Several chunks of an expected document
+// therefore only count once.
+func newlyFound(question Question, docs []index.SearchDocument) []int {
+	found := make(map[int]bool)
+	counts := make([]int, len(docs))
+
+	for i, doc := range docs {
+		for _, item := range question.matchedItems(doc) {
+			if !found[item] {
+				found[item] = true
+				counts[i]++
+			}
+		}
+	}
+
+	return counts
+}
+
+func firstRelevantRank(counts []int) int {
+	return slices.IndexFunc(counts, func(count int) bool { return count > 0 }) + 1
+}
+
+func recallAt(counts []int, k int, expected int) float64 {
+	var found int
+	for _, count := range counts[:min(k, len(counts))] {
+		found += count
+	}
+
+	return float64(found) / float64(expected)
+}
+
+// ndcgAt uses binary relevance, a hit being relevant if it found any new
+// expected item.
+func ndcgAt(counts []int, k int, expected int) float64 {
+	var dcg, idcg float64
+	for i, count := range counts[:min(k, len(counts))] {
+		if count > 0 {
+			dcg += 1 / math.Log2(float64(i+2))
+		}
+	}
+	for i := range min(k, expected) {
+		idcg += 1 / math.Log2(float64(i+2))
+	}
+
+	return dcg / idcg
+}
@@ -2,22 +2,106 @@ package index
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/OptimusePrime/petagpt/internal/parser"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
 	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search"
 )
 
-func CreateBleveIndex(indexPath string, defaultAnalyzer string) (bleve.Index, error) {
-	mapping := bleve.NewIndexMapping()
-	mapping.ScoringModel = "bm25"
-	mapping.TypeField = "type"
-	mapping.DefaultAnalyzer = defaultAnalyzer
+// bleveChunk is the document stored in a Bleve index for every chunk.
+// Field names must match the ones registered in newBleveIndexMapping.
+type bleveChunk struct {
+	Content    string    `json:"content"`
+	Context    string    `json:"context"`
+	DocumentID string    `json:"document_id"`
+	FileName   string    `json:"file_name"`
+	FileType   string    `json:"file_type"`
+	Tags       []string  `json:"tags"`
+	Page       int       `json:"page"`
+	CreatedAt  time.Time `json:"created_at"`
+	IndexedAt  time.Time `json:"indexed_at"`
+}
+
+var bleveStoredFields = []string{"content", "context", "document_id", "file_name", "file_type", "tags", "page", "created_at", "indexed_at"}
+
+func newBleveIndexMapping(defaultAnalyzer string) mapping.IndexMapping {
+	contentField := bleve.NewTextFieldMapping()
+	contentField.Analyzer = defaultAnalyzer
+	contentField.Store = true
+	contentField.IncludeTermVectors = true
+
+	contextField := bleve.NewTextFieldMapping()
+	contextField.Analyzer = defaultAnalyzer
+	contextField.Store = true
+	contextField.IncludeInAll = false
+
+	keywordField := bleve.NewKeywordFieldMapping()
+	keywordField.IncludeInAll = false
+
+	numericField := bleve.NewNumericFieldMapping()
+	numericField.IncludeInAll = false
+
+	dateField := bleve.NewDateTimeFieldMapping()
+	dateField.IncludeInAll = false
+
+	chunkMapping := bleve.NewDocumentStaticMapping()
+	chunkMapping.AddFieldMappingsAt("content", contentField)
+	chunkMapping.AddFieldMappingsAt("context", contextField)
+	chunkMapping.AddFieldMappingsAt("document_id", keywordField)
+	chunkMapping.AddFieldMappingsAt("file_name", keywordField)
+	chunkMapping.AddFieldMappingsAt("file_type", keywordField)
+	chunkMapping.AddFieldMappingsAt("tags", keywordField)
+	chunkMapping.AddFieldMappingsAt("page", numericField)
+	chunkMapping.AddFieldMappingsAt("created_at", dateField)
+	chunkMapping.AddFieldMappingsAt("indexed_at", dateField)
+
+	indexMapping := bleve.NewIndexMapping()
+	indexMapping.ScoringModel = "bm25"
+	indexMapping.TypeField = "type"
+	indexMapping.DefaultAnalyzer = defaultAnalyzer
+	indexMapping.DefaultMapping = chunkMapping
+
+	return indexMapping
+}
+
+// checkBleveMapping fails for indexes created before newBleveIndexMapping,
+// whose dynamic mapping indexed the chunk fields under their Go names, e.g.
+// Content, so that searches and filters on the current fields find nothing.
+func checkBleveMapping(index bleve.Index, indexName string) error {
+	indexMapping, ok := index.Mapping().(*mapping.IndexMappingImpl)
+	if !ok || indexMapping.DefaultMapping == nil {
+		return nil
+	}
 
-	index, err := bleve.New(indexPath, mapping)
+	if _, ok := indexMapping.DefaultMapping.Properties["content"]; ok {
+		return nil
+	}
+
+	return fmt.Errorf("the BM25 index of %s uses an outdated mapping, rebuild it with: petagpt index rebuild --bm25 %s", indexName, indexName)
+}
+
+func newBleveChunk(document sqlc.Document, tags []string, chunk parser.Chunk, indexedAt time.Time) bleveChunk {
+	return bleveChunk{
+		Content:    chunk.Content,
+		Context:    chunk.Context,
+		DocumentID: strconv.FormatInt(document.ID, 10),
+		FileName:   documentFileName(document),
+		FileType:   document.Filetype,
+		Tags:       tags,
+		Page:       chunk.Page,
+		CreatedAt:  document.CreatedAt,
+		IndexedAt:  indexedAt,
+	}
+}
+
+func CreateBleveIndex(indexPath string, defaultAnalyzer string) (bleve.Index, error) {
+	index, err := bleve.New(indexPath, newBleveIndexMapping(defaultAnalyzer))
 	if err != nil {
 		return nil, err
 	}
@@ -39,69 +123,112 @@ func DeleteBleveIndex(indexPath string) error {
 	return nil
 }
 
-func AddChunksToBleveIndex(indexPath string, docs ...parser.Chunk) error {
-	index, err := bleve.Open(indexPath)
-	if err != nil {
-		return fmt.Errorf("failed to open Bleve index: %w", err)
-	}
+func AddChunksToBleveIndex(ctx context.Context, indexName string, document sqlc.Document, tags []string, chunks ...parser.Chunk) error {
+	return DefaultManager.withBleve(ctx, indexName, func(index bleve.Index) error {
+		return indexBleveChunks(index, document, tags, chunks...)
+	})
+}
 
-	defer func() {
-		err = errors.Join(err, index.Close())
-	}()
+func indexBleveChunks(index bleve.Index, document sqlc.Document, tags []string, chunks ...parser.Chunk) error {
+	indexedAt := time.Now()
 
 	batch := index.NewBatch()
-	for _, doc := range docs {
-		err = batch.Index(doc.SHA256(), doc)
+	for _, chunk := range chunks {
+		err := batch.Index(chunk.ID, newBleveChunk(document, tags, chunk, indexedAt))
 		if err != nil {
 			return fmt.Errorf("failed to add chunk to Bleve index: %w", err)
 		}
 	}
-	if err = index.Batch(batch); err != nil {
+	if err := index.Batch(batch); err != nil {
 		return fmt.Errorf("failed to add chunks to Bleve index: %w", err)
 	}
 
 	return nil
 }
 
-func RemoveChunksFromBleveIndex(ctx context.Context, indexPath string, chunksIDs []string) error {
-	index, err := bleve.Open(indexPath)
-	if err != nil {
-		return fmt.Errorf("failed to open Bleve index: %w", err)
-	}
+func RemoveChunksFromBleveIndex(ctx context.Context, indexName string, chunksIDs []string) error {
+	return DefaultManager.withBleve(ctx, indexName, func(index bleve.Index) error {
+		batch := index.NewBatch()
+		for _, docID := range chunksIDs {
+			batch.Delete(docID)
+		}
+		if err := index.Batch(batch); err != nil {
+			return fmt.Errorf("failed to remove chunks from Bleve index: %w", err)
+		}
 
-	defer func() {
-		err = errors.Join(err, index.Close())
-	}()
+		return nil
+	})
+}
 
-	batch := index.NewBatch()
-	for _, docID := range chunksIDs {
-		batch.Delete(docID)
-	}
-	if err = index.Batch(batch); err != nil {
-		return fmt.Errorf("failed to remove chunks from Bleve index: %w", err)
+func newBleveSearchRequest(queryString string, topN int, filter *SearchFilter, mode QueryMode) *bleve.SearchRequest {
+	searchQuery := newBleveQuery(queryString, mode)
+	if filterQuery := filter.bleveQuery(); filterQuery != nil {
+		searchQuery = bleve.NewConjunctionQuery(searchQuery, filterQuery)
 	}
 
-	return nil
+	searchRequest := bleve.NewSearchRequestOptions(searchQuery, max(topN, 100), 0, false)
+	searchRequest.Fields = bleveStoredFields
+	searchRequest.IncludeLocations = true
+
+	return searchRequest
 }
 
-func SearchBleveIndex(indexPath string, queryString string, topN int) (*bleve.SearchResult, error) {
-	index, err := bleve.Open(indexPath)
+// SearchBleveIndex runs a BM25 query built according to mode. In match mode
+// the query is matched against both the chunk content and its generated
+// context. The boosts are read from bm25.content_boost and
+// bm25.context_boost so that the context can be weighted lower than the
+// text it describes. A non-empty filter is added as a conjunction.
+func SearchBleveIndex(ctx context.Context, indexName string, queryString string, topN int, filter *SearchFilter, mode QueryMode) (*bleve.SearchResult, error) {
+	var searchResult *bleve.SearchResult
+
+	err := DefaultManager.withBleve(ctx, indexName, func(index bleve.Index) error {
+		var err error
+		searchResult, err = index.SearchInContext(ctx, newBleveSearchRequest(queryString, topN, filter, mode))
+
+		return err
+	})
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to search Bleve index: %w", err)
 	}
 
-	defer func() {
-		err = errors.Join(err, index.Close())
-	}()
+	return searchResult, nil
+}
 
-	query := bleve.NewMatchQuery(queryString)
+func bleveHitToDocument(hit *search.DocumentMatch) Document {
+	doc := Document{
+		ID:       hit.ID,
+		Content:  hitString(hit, "content"),
+		Context:  hitString(hit, "context"),
+		FileName: hitString(hit, "file_name"),
+		FileType: hitString(hit, "file_type"),
 
-	searchRequest := bleve.NewSearchRequestOptions(query, max(topN, 100), 0, true)
-	searchRequest.Fields = []string{"*"}
-	searchResult, err := index.Search(searchRequest)
-	if err != nil {
-		log.Fatal(err)
+		locations: hit.Locations["content"],
 	}
 
-	return searchResult, nil
+	if documentID, err := strconv.ParseInt(hitString(hit, "document_id"), 10, 64); err == nil {
+		doc.DocumentID = documentID
+	}
+	if page, ok := hit.Fields["page"].(float64); ok {
+		doc.Page = int(page)
+	}
+
+	// Bleve returns a single stored value as-is and multiple ones as a slice.
+	switch tags := hit.Fields["tags"].(type) {
+	case string:
+		doc.Tags = []string{tags}
+	case []interface{}:
+		for _, tag := range tags {
+			if tag, ok := tag.(string); ok {
+				doc.Tags = append(doc.Tags, tag)
+			}
+		}
+	}
+
+	return doc
+}
+
+func hitString(hit *search.DocumentMatch, field string) string {
+	value, _ := hit.Fields[field].(string)
+
+	return value
 }
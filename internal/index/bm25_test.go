@@ -0,0 +1,65 @@
+package index
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+)
+
+func TestCheckBleveMapping(t *testing.T) {
+	tests := []struct {
+		name     string
+		mapping  mapping.IndexMapping
+		outdated bool
+	}{
+		{name: "current mapping", mapping: newBleveIndexMapping("standard")},
+		{name: "dynamic mapping", mapping: bleve.NewIndexMapping(), outdated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexPath := filepath.Join(t.TempDir(), "test.bleve")
+			index, err := bleve.New(indexPath, tt.mapping)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = index.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			manager := NewManager()
+			manager.lookup = func(ctx context.Context, name string) (sqlc.Index, error) {
+				return sqlc.Index{Name: name, Path: indexPath, Collection: name}, nil
+			}
+			t.Cleanup(func() {
+				if err := manager.Close(); err != nil {
+					t.Error(err)
+				}
+			})
+
+			err = manager.withBleve(context.Background(), "test", func(index bleve.Index) error {
+				return nil
+			})
+			switch {
+			case tt.outdated && (err == nil || !strings.Contains(err.Error(), "index rebuild --bm25 test")):
+				t.Errorf("err = %v, want an outdated mapping error", err)
+			case !tt.outdated && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			// The index must have been closed again, so it can be rebuilt.
+			if tt.outdated {
+				index, err := bleve.OpenUsing(indexPath, map[string]interface{}{"bolt_timeout": "1s"})
+				if err != nil {
+					t.Fatalf("index is still locked: %v", err)
+				}
+				_ = index.Close()
+			}
+		})
+	}
+}
@@ -2,149 +2,145 @@ package index
 
 import (
 	"context"
-	"errors"
 	"fmt"
 
 	chroma "github.com/OptimusePrime/chroma-go/pkg/api/v2"
-	"github.com/OptimusePrime/chroma-go/pkg/embeddings/vllm"
+	"github.com/OptimusePrime/chroma-go/pkg/embeddings"
 	"github.com/OptimusePrime/petagpt/internal/parser"
-	"github.com/spf13/viper"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
 )
 
 func CreateChromaCollection(ctx context.Context, name string) error {
-	client, err := chroma.NewHTTPClient(chroma.WithBaseURL(viper.GetString("chroma.base_url")))
-	if err != nil {
-		return err
-	}
-	defer func() {
-		err = errors.Join(err, client.Close())
-	}()
-
-	vllmEf, err := vllm.NewVLLMEmbeddingFunctionFromOptions(
-		vllm.WithModel(viper.GetString("embedding_service.model")),
-		vllm.WithBaseURL(viper.GetString("embedding_service.base_url")),
-		vllm.WithAPIKey(viper.GetString("embedding_service.api_key")),
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create chroma client: %w", err)
-	}
-
-	_, err = client.CreateCollection(ctx, name, chroma.WithEmbeddingFunctionCreate(vllmEf))
-	if err != nil {
-		return fmt.Errorf("failed to create chroma collection: %w", err)
-	}
-
-	return nil
+	return DefaultManager.withChromaClient(func(client chroma.Client, ef embeddings.EmbeddingFunction) error {
+		_, err := client.CreateCollection(ctx, name, chroma.WithEmbeddingFunctionCreate(ef))
+		if err != nil {
+			return fmt.Errorf("failed to create chroma collection: %w", err)
+		}
+
+		return nil
+	})
 }
 
+// DeleteChromaCollection deletes a collection by its Chroma name. Callers must
+// first drop the handles of the index using it with DefaultManager.Remove.
 func DeleteChromaCollection(ctx context.Context, name string) error {
-	client, err := chroma.NewHTTPClient(chroma.WithBaseURL(viper.GetString("chroma.base_url")))
-	if err != nil {
-		return fmt.Errorf("failed to create chroma client: %w", err)
-	}
-	defer func() {
-		err = errors.Join(err, client.Close())
-	}()
+	return DefaultManager.withChromaClient(func(client chroma.Client, ef embeddings.EmbeddingFunction) error {
+		err := client.DeleteCollection(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to delete chroma collection: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func RemoveChunksFromChromaCollection(ctx context.Context, collectionName string, chunksIDs []chroma.DocumentID) error {
+	collection, err := DefaultManager.Collection(ctx, collectionName)
 	if err != nil {
-		return fmt.Errorf("failed to create chroma client: %w", err)
+		return err
 	}
 
-	err = client.DeleteCollection(ctx, name)
+	err = collection.Delete(ctx, chroma.WithIDsDelete(chunksIDs...))
 	if err != nil {
-		return fmt.Errorf("failed to delete chroma collection: %w", err)
+		return fmt.Errorf("failed to delete chunks from collection: %w", err)
 	}
 
 	return nil
 }
 
-func RemoveChunksFromChromaCollection(ctx context.Context, collectionName string, chunksIDs []chroma.DocumentID) error {
-	client, err := chroma.NewHTTPClient(chroma.WithBaseURL(viper.GetString("chroma.base_url")))
-	defer func() {
-		err = errors.Join(err, client.Close())
-	}()
-
-	vllmEf, err := vllm.NewVLLMEmbeddingFunctionFromOptions(
-		vllm.WithModel(viper.GetString("embedding_service.model")),
-		vllm.WithBaseURL(viper.GetString("embedding_service.base_url")),
-		vllm.WithAPIKey(viper.GetString("embedding_service.api_key")),
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create vLLM embedding function: %w", err)
+// chromaChunkMetadata holds the same document-level fields as the Bleve
+// mapping so that search filters can be applied on both sides.
+func chromaChunkMetadata(document sqlc.Document, tags []string, chunk parser.Chunk) chroma.DocumentMetadata {
+	attributes := []*chroma.MetaAttribute{
+		chroma.NewIntAttribute("document_id", document.ID),
+		chroma.NewStringAttribute("file_name", documentFileName(document)),
+		chroma.NewStringAttribute("file_type", document.Filetype),
+		chroma.NewIntAttribute("page", int64(chunk.Page)),
+		chroma.NewIntAttribute("created_at", document.CreatedAt.Unix()),
 	}
 
-	collection, err := client.GetCollection(ctx, collectionName, chroma.WithEmbeddingFunctionGet(vllmEf))
-	if err != nil {
-		return fmt.Errorf("failed to get collection: %w", err)
+	for _, tag := range tags {
+		attributes = append(attributes, chroma.NewBoolAttribute(chromaTagKey(tag), true))
 	}
 
-	err = collection.Delete(ctx, chroma.WithIDsDelete(chunksIDs...))
-	if err != nil {
-		return fmt.Errorf("failed to delete chunks from collection: %w", err)
-	}
-
-	return nil
+	return chroma.NewDocumentMetadata(attributes...)
 }
 
-func AddChunksToChromaCollection(ctx context.Context, collectionName string, chunks ...parser.Chunk) error {
-	client, err := chroma.NewHTTPClient(chroma.WithBaseURL(viper.GetString("chroma.base_url")))
-	defer func() {
-		err = errors.Join(err, client.Close())
-	}()
-
-	vllmEf, err := vllm.NewVLLMEmbeddingFunctionFromOptions(
-		vllm.WithModel(viper.GetString("embedding_service.model")),
-		vllm.WithBaseURL(viper.GetString("embedding_service.base_url")),
-		vllm.WithAPIKey(viper.GetString("embedding_service.api_key")),
-	)
+func AddChunksToChromaCollection(ctx context.Context, collectionName string, document sqlc.Document, tags []string, chunks ...parser.Chunk) error {
+	collection, err := DefaultManager.Collection(ctx, collectionName)
 	if err != nil {
 		return err
 	}
 
-	collection, err := client.GetCollection(ctx, collectionName, chroma.WithEmbeddingFunctionGet(vllmEf))
+	return addChunksToCollection(ctx, collection, document, tags, chunks...)
+}
+
+// UpsertChunksToChromaCollection adds the chunks, replacing the ones already
+// in the collection, so adding them can be retried.
+func UpsertChunksToChromaCollection(ctx context.Context, collectionName string, document sqlc.Document, tags []string, chunks ...parser.Chunk) error {
+	collection, err := DefaultManager.Collection(ctx, collectionName)
 	if err != nil {
 		return err
 	}
 
+	return collection.Upsert(ctx, chromaAddOptions(document, tags, chunks)...)
+}
+
+func addChunksToCollection(ctx context.Context, collection chroma.Collection, document sqlc.Document, tags []string, chunks ...parser.Chunk) error {
+	return collection.Add(ctx, chromaAddOptions(document, tags, chunks)...)
+}
+
+func chromaAddOptions(document sqlc.Document, tags []string, chunks []parser.Chunk) []chroma.CollectionAddOption {
 	ids := make([]chroma.DocumentID, len(chunks))
 	texts := make([]string, len(chunks))
+	metadatas := make([]chroma.DocumentMetadata, len(chunks))
 
 	for i, doc := range chunks {
-		ids[i] = chroma.DocumentID(doc.SHA256())
+		ids[i] = chroma.DocumentID(doc.ID)
 		texts[i] = doc.String()
+		metadatas[i] = chromaChunkMetadata(document, tags, doc)
 	}
 
-	err = collection.Add(ctx, chroma.WithIDs(ids...), chroma.WithTexts(texts...))
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return []chroma.CollectionAddOption{chroma.WithIDs(ids...), chroma.WithTexts(texts...), chroma.WithMetadatas(metadatas...)}
 }
 
-func SearchChromaCollection(ctx context.Context, collectionName string, topN int, queryStrings ...string) (chroma.QueryResult, error) {
-	client, err := chroma.NewHTTPClient(chroma.WithBaseURL(viper.GetString("chroma.base_url")))
-	//defer func() {
-	//	err = errors.Join(err, fmt.Errorf("failed closing Chroma client: %w", client.Close()))
-	//}()
-
-	vllmEf, err := vllm.NewVLLMEmbeddingFunctionFromOptions(
-		vllm.WithModel("Qwen/Qwen3-Embedding-4B"),
-		vllm.WithBaseURL(viper.GetString("embedding_service.base_url")),
-		vllm.WithAPIKey(viper.GetString("embedding_service.api_key")),
-	)
+func SearchChromaCollection(ctx context.Context, collectionName string, topN int, filter *SearchFilter, queryStrings ...string) (chroma.QueryResult, error) {
+	collection, err := DefaultManager.Collection(ctx, collectionName)
 	if err != nil {
-		return nil, fmt.Errorf("failed creating vLLM embedding function: %w", err)
+		return nil, err
 	}
 
-	collection, err := client.GetCollection(ctx, collectionName, chroma.WithEmbeddingFunctionGet(vllmEf))
-	if err != nil {
-		return nil, err
+	queryOptions := []chroma.CollectionQueryOption{
+		chroma.WithQueryTexts(queryStrings...),
+		chroma.WithNResults(max(100, topN)),
+	}
+	if where := filter.chromaWhere(); where != nil {
+		queryOptions = append(queryOptions, chroma.WithWhereQuery(where))
 	}
 
-	queryResult, err := collection.Query(ctx, chroma.WithQueryTexts(queryStrings...), chroma.WithNResults(max(100, topN)))
+	queryResult, err := collection.Query(ctx, queryOptions...)
 	if err != nil {
 		return nil, err
 	}
 
 	return queryResult, nil
 }
+
+func chromaMetadataToDocument(doc *Document, metadata chroma.DocumentMetadata) {
+	if metadata == nil {
+		return
+	}
+
+	if documentID, ok := metadata.GetInt("document_id"); ok {
+		doc.DocumentID = documentID
+	}
+	if fileName, ok := metadata.GetString("file_name"); ok {
+		doc.FileName = fileName
+	}
+	if fileType, ok := metadata.GetString("file_type"); ok {
+		doc.FileType = fileType
+	}
+	if page, ok := metadata.GetInt("page"); ok {
+		doc.Page = int(page)
+	}
+}
@@ -0,0 +1,316 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	chroma "github.com/OptimusePrime/chroma-go/pkg/api/v2"
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/parser"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/blevesearch/bleve/v2"
+)
+
+const listIDsBatchSize = 1000
+
+// StoreReport compares the chunk IDs held by a search store with the chunks
+// recorded in SQLite.
+type StoreReport struct {
+	Count int `json:"count"`
+	// Missing chunks are recorded in SQLite but absent from the store.
+	Missing []string `json:"missing"`
+	// Orphaned chunks are in the store but not recorded in SQLite.
+	Orphaned []string `json:"orphaned"`
+}
+
+func (r StoreReport) Consistent() bool {
+	return len(r.Missing) == 0 && len(r.Orphaned) == 0
+}
+
+type ConsistencyReport struct {
+	Index        string      `json:"index"`
+	SQLiteChunks int         `json:"sqlite_chunks"`
+	Bleve        StoreReport `json:"bleve"`
+	Chroma       StoreReport `json:"chroma"`
+}
+
+func (r *ConsistencyReport) Consistent() bool {
+	return r.Bleve.Consistent() && r.Chroma.Consistent()
+}
+
+// newStoreReport compares the IDs in a store with the expected ones. Chunks
+// of active ingestion jobs aren't orphaned, they're committed to SQLite once
+// the job finishes.
+func newStoreReport(expected, active map[string]struct{}, actual []string) StoreReport {
+	report := StoreReport{Count: len(actual)}
+
+	actualSet := make(map[string]struct{}, len(actual))
+	for _, id := range actual {
+		actualSet[id] = struct{}{}
+
+		if _, ok := expected[id]; ok {
+			continue
+		}
+		if _, ok := active[id]; !ok {
+			report.Orphaned = append(report.Orphaned, id)
+		}
+	}
+
+	for id := range expected {
+		if _, ok := actualSet[id]; !ok {
+			report.Missing = append(report.Missing, id)
+		}
+	}
+	slices.Sort(report.Missing)
+	slices.Sort(report.Orphaned)
+
+	return report
+}
+
+func listBleveIDs(ctx context.Context, indexName string) ([]string, error) {
+	var ids []string
+
+	err := DefaultManager.withBleve(ctx, indexName, func(index bleve.Index) error {
+		var searchAfter []string
+
+		for {
+			req := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), listIDsBatchSize, 0, false)
+			req.SortBy([]string{"_id"})
+			if searchAfter != nil {
+				req.SetSearchAfter(searchAfter)
+			}
+
+			result, err := index.SearchInContext(ctx, req)
+			if err != nil {
+				return err
+			}
+
+			for _, hit := range result.Hits {
+				ids = append(ids, hit.ID)
+			}
+
+			if len(result.Hits) < listIDsBatchSize {
+				return nil
+			}
+			searchAfter = []string{result.Hits[len(result.Hits)-1].ID}
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed listing Bleve documents: %w", err)
+	}
+
+	return ids, nil
+}
+
+func listChromaIDs(ctx context.Context, collectionName string) ([]string, error) {
+	collection, err := DefaultManager.Collection(ctx, collectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+
+	for offset := 0; ; offset += listIDsBatchSize {
+		result, err := collection.Get(ctx,
+			chroma.WithLimitGet(listIDsBatchSize),
+			chroma.WithOffsetGet(offset),
+			chroma.WithIncludeGet(chroma.IncludeMetadatas),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed listing Chroma documents: %w", err)
+		}
+
+		for _, id := range result.GetIDs() {
+			ids = append(ids, string(id))
+		}
+
+		if len(result.GetIDs()) < listIDsBatchSize {
+			return ids, nil
+		}
+	}
+}
+
+// chunkFromRow turns a stored chunk back into the chunk it was indexed as.
+func chunkFromRow(row sqlc.Chunk) parser.Chunk {
+	return parser.Chunk{
+		ID:          row.IndexingID,
+		Content:     row.Content,
+		Context:     row.Context,
+		Page:        int(row.Page),
+		Ordinal:     int(row.Ordinal.Int64),
+		StartOffset: int(row.StartOffset.Int64),
+		EndOffset:   int(row.EndOffset.Int64),
+		TableSHA256: row.TableSha256.String,
+	}
+}
+
+// activeJobChunkIDs returns the IDs of the chunks which pending and running
+// ingestion jobs of the index may have written to the search stores without
+// committing them to SQLite yet.
+func activeJobChunkIDs(ctx context.Context, queries *sqlc.Queries, indexID int64) (map[string]struct{}, error) {
+	jobChunks, err := queries.ListActiveIngestionJobChunksByIndexID(ctx, indexID)
+	if err != nil {
+		return nil, fmt.Errorf("failed listing ingestion jobs: %w", err)
+	}
+
+	ids := make(map[string]struct{})
+	for _, encoded := range jobChunks {
+		var chunks []parser.Chunk
+		if err := json.Unmarshal([]byte(encoded.String), &chunks); err != nil {
+			return nil, fmt.Errorf("failed to read chunks of ingestion job: %w", err)
+		}
+
+		for _, chunk := range chunks {
+			ids[chunk.ID] = struct{}{}
+		}
+	}
+
+	return ids, nil
+}
+
+// VerifyIndex compares the chunks of an index recorded in SQLite with the
+// ones in its Bleve index and Chroma collection. Chunks of ingestion jobs
+// which are still running aren't reported as orphaned.
+func VerifyIndex(ctx context.Context, idx sqlc.Index) (*ConsistencyReport, error) {
+	queries := sqlc.New(db.MainDB)
+
+	// The stores are listed first, so every chunk in them either belongs to a
+	// job which is still active below, or was committed before SQLite is read.
+	bleveIDs, err := listBleveIDs(ctx, idx.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	chromaIDs, err := listChromaIDs(ctx, idx.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	active, err := activeJobChunkIDs(ctx, queries, idx.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := queries.ListChunksByIndexID(ctx, idx.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed listing chunks: %w", err)
+	}
+
+	expected := make(map[string]struct{}, len(rows))
+	for _, row := range rows {
+		expected[row.IndexingID] = struct{}{}
+	}
+
+	return &ConsistencyReport{
+		Index:        idx.Name,
+		SQLiteChunks: len(rows),
+		Bleve:        newStoreReport(expected, active, bleveIDs),
+		Chroma:       newStoreReport(expected, active, chromaIDs),
+	}, nil
+}
+
+// RepairIndex reconciles the search stores of an index with SQLite, which is
+// treated as the source of truth. Orphaned chunks are deleted from the stores
+// and missing chunks are indexed again from their stored content and context.
+// Orphaned chunks of ingestion jobs which started since the report was made
+// are left to the jobs.
+func RepairIndex(ctx context.Context, idx sqlc.Index, report *ConsistencyReport) error {
+	queries := sqlc.New(db.MainDB)
+
+	active, err := activeJobChunkIDs(ctx, queries, idx.ID)
+	if err != nil {
+		return err
+	}
+
+	isActive := func(id string) bool {
+		_, ok := active[id]
+		return ok
+	}
+
+	if orphaned := slices.DeleteFunc(slices.Clone(report.Bleve.Orphaned), isActive); len(orphaned) > 0 {
+		err := RemoveChunksFromBleveIndex(ctx, idx.Name, orphaned)
+		if err != nil {
+			return err
+		}
+	}
+
+	if orphaned := slices.DeleteFunc(slices.Clone(report.Chroma.Orphaned), isActive); len(orphaned) > 0 {
+		ids := make([]chroma.DocumentID, len(orphaned))
+		for i, id := range orphaned {
+			ids[i] = chroma.DocumentID(id)
+		}
+
+		err := RemoveChunksFromChromaCollection(ctx, idx.Name, ids)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(report.Bleve.Missing) == 0 && len(report.Chroma.Missing) == 0 {
+		return nil
+	}
+
+	rows, err := queries.ListChunksByIndexID(ctx, idx.ID)
+	if err != nil {
+		return fmt.Errorf("failed listing chunks: %w", err)
+	}
+
+	bleveMissing := make(map[string]struct{}, len(report.Bleve.Missing))
+	for _, id := range report.Bleve.Missing {
+		bleveMissing[id] = struct{}{}
+	}
+	chromaMissing := make(map[string]struct{}, len(report.Chroma.Missing))
+	for _, id := range report.Chroma.Missing {
+		chromaMissing[id] = struct{}{}
+	}
+
+	var errs []error
+	for documentID, documentRows := range groupChunksByDocument(rows) {
+		var bleveChunks, chromaChunks []parser.Chunk
+		for _, row := range documentRows {
+			if _, ok := bleveMissing[row.IndexingID]; ok {
+				bleveChunks = append(bleveChunks, chunkFromRow(row))
+			}
+			if _, ok := chromaMissing[row.IndexingID]; ok {
+				chromaChunks = append(chromaChunks, chunkFromRow(row))
+			}
+		}
+
+		if len(bleveChunks) == 0 && len(chromaChunks) == 0 {
+			continue
+		}
+
+		document, err := queries.GetDocument(ctx, documentID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to find document: %d: %w", documentID, err))
+			continue
+		}
+
+		tags, err := queries.GetTagsByDocumentID(ctx, documentID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get document tags: %d: %w", documentID, err))
+			continue
+		}
+
+		if len(bleveChunks) > 0 {
+			errs = append(errs, AddChunksToBleveIndex(ctx, idx.Name, document, tags, bleveChunks...))
+		}
+		if len(chromaChunks) > 0 {
+			errs = append(errs, AddChunksToChromaCollection(ctx, idx.Name, document, tags, chromaChunks...))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func groupChunksByDocument(rows []sqlc.Chunk) map[int64][]sqlc.Chunk {
+	groups := make(map[int64][]sqlc.Chunk)
+	for _, row := range rows {
+		groups[row.DocumentID] = append(groups[row.DocumentID], row)
+	}
+
+	return groups
+}
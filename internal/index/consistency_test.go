@@ -0,0 +1,158 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/parser"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/spf13/viper"
+)
+
+func idSet(ids ...string) map[string]struct{} {
+	set := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+
+	return set
+}
+
+func TestNewStoreReport(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected []string
+		active   []string
+		actual   []string
+		missing  []string
+		orphaned []string
+	}{
+		{
+			name:     "consistent",
+			expected: []string{"a", "b"},
+			actual:   []string{"b", "a"},
+		},
+		{
+			name:     "missing and orphaned",
+			expected: []string{"a", "b"},
+			actual:   []string{"a", "c"},
+			missing:  []string{"b"},
+			orphaned: []string{"c"},
+		},
+		{
+			name:     "chunks of active jobs aren't orphaned",
+			expected: []string{"a"},
+			active:   []string{"c", "d"},
+			actual:   []string{"a", "c", "e"},
+			orphaned: []string{"e"},
+		},
+		{
+			name:     "chunks of active jobs aren't missing either",
+			expected: []string{"a"},
+			active:   []string{"c"},
+			missing:  []string{"a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := newStoreReport(idSet(tt.expected...), idSet(tt.active...), tt.actual)
+
+			if report.Count != len(tt.actual) {
+				t.Errorf("Count = %d, want %d", report.Count, len(tt.actual))
+			}
+			if !slices.Equal(report.Missing, tt.missing) {
+				t.Errorf("Missing = %v, want %v", report.Missing, tt.missing)
+			}
+			if !slices.Equal(report.Orphaned, tt.orphaned) {
+				t.Errorf("Orphaned = %v, want %v", report.Orphaned, tt.orphaned)
+			}
+		})
+	}
+}
+
+// newTestDB creates a fresh database with the named indexes, returning the
+// first one.
+func newTestDB(t *testing.T, names ...string) sqlc.Index {
+	t.Helper()
+
+	viper.Set("data_dir", t.TempDir())
+	t.Cleanup(func() { viper.Set("data_dir", "") })
+
+	ctx := context.Background()
+	if err := db.InitDatabase(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.MainDB.Close() })
+
+	for _, name := range names {
+		_, err := db.MainDB.ExecContext(ctx, "INSERT INTO indexes (name, path, collection) VALUES (?, ?, ?)", name, name+".bleve", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	idx, err := sqlc.New(db.MainDB).GetIndexByName(ctx, names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return idx
+}
+
+func TestActiveJobChunkIDs(t *testing.T) {
+	idx := newTestDB(t, "test", "other")
+	ctx := context.Background()
+
+	jobs := []struct {
+		indexID int64
+		status  string
+		stage   string
+		chunks  []string
+	}{
+		{indexID: 1, status: "running", stage: "embedded", chunks: []string{"running-1", "running-2"}},
+		{indexID: 1, status: "pending", stage: "contextualised", chunks: []string{"pending"}},
+		{indexID: 1, status: "running", stage: "parsed"},
+		{indexID: 1, status: "completed", stage: "committed", chunks: []string{"completed"}},
+		{indexID: 1, status: "failed", stage: "embedded", chunks: []string{"failed"}},
+		{indexID: 2, status: "running", stage: "embedded", chunks: []string{"other"}},
+	}
+	for _, job := range jobs {
+		var chunks any
+		if job.chunks != nil {
+			var parsed []parser.Chunk
+			for _, id := range job.chunks {
+				parsed = append(parsed, parser.Chunk{ID: id, Content: id})
+			}
+
+			encoded, err := json.Marshal(parsed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chunks = string(encoded)
+		}
+
+		_, err := db.MainDB.ExecContext(ctx,
+			"INSERT INTO ingestion_jobs (index_id, file_path, file_size, file_sha256, chunk_size, status, stage, chunks) VALUES (?, 'a.pdf', 1, 'sum', 50, ?, ?, ?)",
+			job.indexID, job.status, job.stage, chunks,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	active, err := activeJobChunkIDs(ctx, sqlc.New(db.MainDB), idx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := slices.Sorted(maps.Keys(active))
+	want := []string{"pending", "running-1", "running-2"}
+	if !slices.Equal(got, want) {
+		t.Errorf("activeJobChunkIDs() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,245 @@
+package index
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	chroma "github.com/OptimusePrime/chroma-go/pkg/api/v2"
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/parser"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+)
+
+// RemoveDocument removes the document and its chunks from the Chroma
+// collection, the BM25 index and the database.
+func RemoveDocument(ctx context.Context, idx sqlc.Index, document sqlc.Document) error {
+	return RemoveDocuments(ctx, idx, document)
+}
+
+// MoveDocument changes the path of a document whose file was renamed or moved,
+// updating the file name its chunks are indexed with instead of adding them
+// again. The stores are updated first, so a failed move can be repeated.
+func MoveDocument(ctx context.Context, idx sqlc.Index, document sqlc.Document, path string) error {
+	queries := sqlc.New(db.MainDB)
+
+	rows, err := queries.GetChunksByDocumentID(ctx, document.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find chunks: %w", err)
+	}
+
+	tags, err := queries.GetTagsByDocumentID(ctx, document.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get document tags: %w", err)
+	}
+
+	document.Filepath = path
+	document.Filetype = filepath.Ext(path)
+
+	if len(rows) > 0 {
+		chunks := make([]parser.Chunk, len(rows))
+		ids := make([]chroma.DocumentID, len(rows))
+		metadatas := make([]chroma.DocumentMetadata, len(rows))
+		for i, row := range rows {
+			chunks[i] = chunkFromRow(row)
+			ids[i] = chroma.DocumentID(row.IndexingID)
+			metadatas[i] = chromaChunkMetadata(document, tags, chunks[i])
+		}
+
+		collection, err := DefaultManager.Collection(ctx, idx.Name)
+		if err != nil {
+			return err
+		}
+
+		// Without texts the chunks aren't embedded again.
+		err = collection.Update(ctx, chroma.WithIDsUpdate(ids...), chroma.WithMetadatasUpdate(metadatas...))
+		if err != nil {
+			return fmt.Errorf("failed updating chunks in chroma collection: %w", err)
+		}
+
+		if err = AddChunksToBleveIndex(ctx, idx.Name, document, tags, chunks...); err != nil {
+			return fmt.Errorf("failed updating chunks in bleve index: %w", err)
+		}
+	}
+
+	err = queries.UpdateDocument(ctx, sqlc.UpdateDocumentParams{
+		Filepath: document.Filepath,
+		Filetype: document.Filetype,
+		Filesize: document.Filesize,
+		ID:       document.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update document: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveDocuments removes the documents and their chunks from the Chroma
+// collection, the BM25 index and the database. The removal is recorded first,
+// so if it fails partway it's finished by RecoverChunkRemovals. Documents an
+// ingestion job is still writing to aren't removed.
+func RemoveDocuments(ctx context.Context, idx sqlc.Index, documents ...sqlc.Document) error {
+	queries := sqlc.New(db.MainDB)
+
+	var chunkIDs []string
+	documentIDs := make([]int64, len(documents))
+	for i, document := range documents {
+		job, err := queries.GetActiveIngestionJobByDocumentID(ctx, sql.NullInt64{Int64: document.ID, Valid: true})
+		if err == nil {
+			return fmt.Errorf("document %d is being updated by ingestion job %d, cancel it first: %s", document.ID, job.ID, document.Filepath)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to find ingestion jobs: %w", err)
+		}
+
+		chunks, err := queries.GetChunksByDocumentID(ctx, document.ID)
+		if err != nil {
+			return fmt.Errorf("failed to find chunks: %w", err)
+		}
+
+		for _, chunk := range chunks {
+			chunkIDs = append(chunkIDs, chunk.IndexingID)
+		}
+		documentIDs[i] = document.ID
+	}
+
+	removal, err := RecordChunkRemoval(ctx, queries, idx, chunkIDs, documentIDs)
+	if err != nil {
+		return err
+	}
+
+	return FinishChunkRemoval(ctx, idx, removal)
+}
+
+// RecordChunkRemoval records that the chunks are to be removed from the
+// Chroma collection and the BM25 index, and then the rows of the documents
+// from the database.
+func RecordChunkRemoval(ctx context.Context, queries *sqlc.Queries, idx sqlc.Index, chunkIDs []string, documentIDs []int64) (sqlc.ChunkRemoval, error) {
+	chunkData, err := json.Marshal(chunkIDs)
+	if err != nil {
+		return sqlc.ChunkRemoval{}, err
+	}
+
+	documentData, err := json.Marshal(documentIDs)
+	if err != nil {
+		return sqlc.ChunkRemoval{}, err
+	}
+
+	removal, err := queries.CreateChunkRemoval(ctx, sqlc.CreateChunkRemovalParams{
+		IndexID:     idx.ID,
+		ChunkIds:    string(chunkData),
+		DocumentIds: string(documentData),
+	})
+	if err != nil {
+		return sqlc.ChunkRemoval{}, fmt.Errorf("failed to record removal: %w", err)
+	}
+
+	return removal, nil
+}
+
+// FinishChunkRemoval carries out a recorded removal. Every step can be
+// repeated, so a removal which failed partway is finished by doing it again.
+func FinishChunkRemoval(ctx context.Context, idx sqlc.Index, removal sqlc.ChunkRemoval) error {
+	var chunkIDs []string
+	if err := json.Unmarshal([]byte(removal.ChunkIds), &chunkIDs); err != nil {
+		return fmt.Errorf("failed to read removal %d: %w", removal.ID, err)
+	}
+
+	var documentIDs []int64
+	if err := json.Unmarshal([]byte(removal.DocumentIds), &documentIDs); err != nil {
+		return fmt.Errorf("failed to read removal %d: %w", removal.ID, err)
+	}
+
+	if len(chunkIDs) > 0 {
+		chromaIDs := make([]chroma.DocumentID, len(chunkIDs))
+		for i, chunkID := range chunkIDs {
+			chromaIDs[i] = chroma.DocumentID(chunkID)
+		}
+
+		err := RemoveChunksFromChromaCollection(ctx, idx.Name, chromaIDs)
+		if err != nil {
+			return fmt.Errorf("failed deleting chunks from chroma collection: %w", err)
+		}
+
+		err = RemoveChunksFromBleveIndex(ctx, idx.Name, chunkIDs)
+		if err != nil {
+			return fmt.Errorf("failed deleting chunks from bleve index: %w", err)
+		}
+	}
+
+	tx, err := db.MainDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := sqlc.New(db.MainDB).WithTx(tx)
+	for _, id := range documentIDs {
+		if err = DeleteDocumentRows(ctx, queries, id); err != nil {
+			return err
+		}
+	}
+
+	if err = queries.DeleteChunkRemoval(ctx, removal.ID); err != nil {
+		return fmt.Errorf("failed to delete removal %d: %w", removal.ID, err)
+	}
+
+	return tx.Commit()
+}
+
+// RecoverChunkRemovals finishes the removals which were interrupted, by a
+// failure or by the process stopping.
+func RecoverChunkRemovals(ctx context.Context) error {
+	queries := sqlc.New(db.MainDB)
+
+	removals, err := queries.ListChunkRemovals(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list removals: %w", err)
+	}
+
+	var errs []error
+	for _, removal := range removals {
+		idx, err := queries.GetIndex(ctx, removal.IndexID)
+		if errors.Is(err, sql.ErrNoRows) {
+			// The index was deleted with everything in it.
+			errs = append(errs, queries.DeleteChunkRemoval(ctx, removal.ID))
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to find index of removal %d: %w", removal.ID, err))
+			continue
+		}
+
+		errs = append(errs, FinishChunkRemoval(ctx, idx, removal))
+	}
+
+	return errors.Join(errs...)
+}
+
+// DeleteDocumentRows deletes the document with its chunks and tags from the
+// database. Foreign keys aren't enforced, so they aren't deleted by cascade,
+// and ingestion jobs referring to the document are detached from it here, as
+// its ID can be given to the next new document.
+func DeleteDocumentRows(ctx context.Context, queries *sqlc.Queries, id int64) error {
+	if err := queries.DetachIngestionJobsFromDocument(ctx, sql.NullInt64{Int64: id, Valid: true}); err != nil {
+		return fmt.Errorf("failed to detach ingestion jobs: %w", err)
+	}
+
+	if err := queries.DeleteChunksByDocumentID(ctx, id); err != nil {
+		return fmt.Errorf("failed to delete chunks: %w", err)
+	}
+
+	if err := queries.DeleteDocumentTags(ctx, id); err != nil {
+		return fmt.Errorf("failed to delete document tags: %w", err)
+	}
+
+	if err := queries.DeleteDocument(ctx, id); err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// IndexRef selects an index for a federated search. Hits from the index are
+// weighted by Weight when fused with the other indexes, 0 meaning 1.
+type IndexRef struct {
+	Name   string  `json:"name" mapstructure:"name"`
+	Weight float64 `json:"weight,omitempty" mapstructure:"weight"`
+}
+
+func (r IndexRef) weight() float64 {
+	if r.Weight <= 0 {
+		return 1
+	}
+
+	return r.Weight
+}
+
+// ResolveIndexRefs returns the members of the index group configured under
+// retrieval.index_groups.<name>, or the index itself if there is no such group.
+func ResolveIndexRefs(name string) ([]IndexRef, error) {
+	key := "retrieval.index_groups." + name
+	if !viper.IsSet(key) {
+		return []IndexRef{{Name: name}}, nil
+	}
+
+	var refs []IndexRef
+	if err := viper.UnmarshalKey(key, &refs); err != nil {
+		return nil, fmt.Errorf("failed to parse index group: %s: %w", name, err)
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("index group is empty: %s", name)
+	}
+
+	return refs, nil
+}
+
+// SearchIndexes searches a single query in several indexes, see SearchIndexesQueries.
+func SearchIndexes(ctx context.Context, refs []IndexRef, query string, topN int, filter *SearchFilter, mode QueryMode) (*SearchResult, error) {
+	results, err := SearchIndexesQueries(ctx, refs, []string{query}, topN, filter, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	return results[0], nil
+}
+
+// SearchIndexesQueries searches all indexes concurrently with SearchIndexQueries
+// and fuses the results of each query across indexes using RRF weighted by the
+// index weights. Every document is tagged with the index it came from.
+//
+// An index which fails completely makes the results degraded, an error is
+// only returned when all of them fail.
+func SearchIndexesQueries(ctx context.Context, refs []IndexRef, queries []string, topN int, filter *SearchFilter, mode QueryMode) ([]*SearchResult, error) {
+	if len(refs) == 0 {
+		return nil, errors.New("no indexes to search")
+	}
+
+	var (
+		wg           sync.WaitGroup
+		errs         = make([]error, len(refs))
+		indexResults = make([][]*SearchResult, len(refs))
+	)
+
+	for i, ref := range refs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			results, err := SearchIndexQueries(ctx, ref.Name, queries, topN, filter, mode)
+			if err != nil {
+				errs[i] = fmt.Errorf("search in index %s failed: %w", ref.Name, err)
+				return
+			}
+
+			for _, result := range results {
+				for j := range result.Documents {
+					result.Documents[j].Index = ref.Name
+				}
+			}
+			indexResults[i] = results
+		}()
+	}
+
+	wg.Wait()
+
+	if !slices.ContainsFunc(indexResults, func(results []*SearchResult) bool { return results != nil }) {
+		return nil, errors.Join(errs...)
+	}
+
+	if len(refs) == 1 {
+		return indexResults[0], nil
+	}
+
+	results := make([]*SearchResult, len(queries))
+	for q := range queries {
+		var (
+			weights []float64
+			group   []*SearchResult
+			reasons []string
+		)
+
+		for i, ref := range refs {
+			if errs[i] != nil {
+				reasons = append(reasons, errs[i].Error())
+				continue
+			}
+
+			result := indexResults[i][q]
+			if result.Degraded {
+				reasons = append(reasons, fmt.Sprintf("%s: %s", ref.Name, result.DegradedReason))
+			}
+
+			weights = append(weights, ref.weight())
+			group = append(group, result)
+		}
+
+		results[q] = weightedRRF(weights, group)
+		if len(reasons) > 0 {
+			results[q].Degraded = true
+			results[q].DegradedReason = strings.Join(reasons, "; ")
+		}
+	}
+
+	return results, nil
+}
+
+// weightedRRF fuses already ranked results, scoring each document by the
+// weight of its result over RRF_K plus its rank.
+func weightedRRF(weights []float64, results []*SearchResult) *SearchResult {
+	var fused []SearchDocument
+	scores := make(map[string]float64)
+
+	key := func(doc SearchDocument) string {
+		return doc.Index + "/" + doc.key()
+	}
+
+	for i, result := range results {
+		for rank, doc := range result.Documents {
+			if _, ok := scores[key(doc)]; !ok {
+				fused = append(fused, doc)
+			}
+			scores[key(doc)] += weights[i] / (RRF_K + float64(rank+1))
+		}
+	}
+
+	slices.SortStableFunc(fused, func(a, b SearchDocument) int {
+		if scores[key(a)] > scores[key(b)] {
+			return -1
+		} else if scores[key(a)] < scores[key(b)] {
+			return 1
+		} else {
+			return 0
+		}
+	})
+
+	for i := range fused {
+		fused[i].Rank = i + 1
+	}
+
+	return &SearchResult{Documents: fused}
+}
@@ -0,0 +1,83 @@
+package index
+
+import (
+	"slices"
+	"testing"
+)
+
+// rankedResult returns a result of the documents with the given IDs, in order.
+func rankedResult(index string, ids ...string) *SearchResult {
+	result := new(SearchResult)
+	for i, id := range ids {
+		result.Documents = append(result.Documents, SearchDocument{
+			Rank:     i + 1,
+			Document: Document{ID: id, Index: index},
+		})
+	}
+
+	return result
+}
+
+func TestWeightedRRF(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []float64
+		results []*SearchResult
+		want    []string
+	}{
+		{
+			name:    "single result keeps its order",
+			weights: []float64{1},
+			results: []*SearchResult{rankedResult("a", "1", "2", "3")},
+			want:    []string{"a/1", "a/2", "a/3"},
+		},
+		{
+			name:    "equal weights interleave by rank",
+			weights: []float64{1, 1},
+			results: []*SearchResult{rankedResult("a", "1", "2"), rankedResult("b", "1", "2")},
+			want:    []string{"a/1", "b/1", "a/2", "b/2"},
+		},
+		{
+			name:    "higher weight ranks first",
+			weights: []float64{1, 2},
+			results: []*SearchResult{rankedResult("a", "1", "2"), rankedResult("b", "1", "2")},
+			want:    []string{"b/1", "b/2", "a/1", "a/2"},
+		},
+		{
+			name:    "same document in several results adds up",
+			weights: []float64{1, 1},
+			results: []*SearchResult{rankedResult("a", "1", "2"), rankedResult("a", "3", "2")},
+			want:    []string{"a/2", "a/1", "a/3"},
+		},
+		{
+			name:    "same chunk ID in different indexes is kept apart",
+			weights: []float64{1, 1},
+			results: []*SearchResult{rankedResult("a", "1"), rankedResult("b", "1")},
+			want:    []string{"a/1", "b/1"},
+		},
+		{
+			name:    "empty results",
+			weights: []float64{1, 1},
+			results: []*SearchResult{rankedResult("a"), rankedResult("b", "1")},
+			want:    []string{"b/1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fused := weightedRRF(tt.weights, tt.results)
+
+			var got []string
+			for i, doc := range fused.Documents {
+				got = append(got, doc.Index+"/"+doc.ID)
+				if doc.Rank != i+1 {
+					t.Errorf("rank of %s = %d, want %d", doc.ID, doc.Rank, i+1)
+				}
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("weightedRRF() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
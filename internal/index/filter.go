@@ -0,0 +1,159 @@
+package index
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	chroma "github.com/OptimusePrime/chroma-go/pkg/api/v2"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// SearchFilter restricts search results to chunks of matching documents.
+// Values within a field are ORed together, while the fields themselves are
+// ANDed. Empty fields do not restrict anything.
+type SearchFilter struct {
+	DocumentIDs   []int64    `json:"document_ids,omitempty"`
+	FileTypes     []string   `json:"file_types,omitempty"`
+	Tags          []string   `json:"tags,omitempty"`
+	CreatedAfter  *time.Time `json:"created_after,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+}
+
+func (f *SearchFilter) IsEmpty() bool {
+	return f == nil || (len(f.DocumentIDs) == 0 &&
+		len(f.FileTypes) == 0 &&
+		len(f.Tags) == 0 &&
+		f.CreatedAfter == nil &&
+		f.CreatedBefore == nil)
+}
+
+// normalizeFileType matches the format documents are stored with, which is
+// the extension including the leading dot.
+func normalizeFileType(fileType string) string {
+	return "." + strings.TrimPrefix(strings.TrimSpace(fileType), ".")
+}
+
+func chromaTagKey(tag string) string {
+	return "tag:" + tag
+}
+
+func bleveTermsQuery(field string, terms []string) query.Query {
+	disjuncts := make([]query.Query, len(terms))
+	for i, term := range terms {
+		termQuery := bleve.NewTermQuery(term)
+		termQuery.SetField(field)
+		disjuncts[i] = termQuery
+	}
+
+	return bleve.NewDisjunctionQuery(disjuncts...)
+}
+
+// bleveQuery returns the filter as a query to be combined with the search
+// query in a conjunction, or nil when the filter is empty.
+func (f *SearchFilter) bleveQuery() query.Query {
+	if f.IsEmpty() {
+		return nil
+	}
+
+	var conjuncts []query.Query
+
+	if len(f.DocumentIDs) > 0 {
+		ids := make([]string, len(f.DocumentIDs))
+		for i, id := range f.DocumentIDs {
+			ids[i] = strconv.FormatInt(id, 10)
+		}
+		conjuncts = append(conjuncts, bleveTermsQuery("document_id", ids))
+	}
+
+	if len(f.FileTypes) > 0 {
+		fileTypes := make([]string, len(f.FileTypes))
+		for i, fileType := range f.FileTypes {
+			fileTypes[i] = normalizeFileType(fileType)
+		}
+		conjuncts = append(conjuncts, bleveTermsQuery("file_type", fileTypes))
+	}
+
+	if len(f.Tags) > 0 {
+		conjuncts = append(conjuncts, bleveTermsQuery("tags", f.Tags))
+	}
+
+	if f.CreatedAfter != nil || f.CreatedBefore != nil {
+		var start, end time.Time
+		if f.CreatedAfter != nil {
+			start = *f.CreatedAfter
+		}
+		if f.CreatedBefore != nil {
+			end = *f.CreatedBefore
+		}
+
+		dateQuery := bleve.NewDateRangeQuery(start, end)
+		dateQuery.SetField("created_at")
+		conjuncts = append(conjuncts, dateQuery)
+	}
+
+	return bleve.NewConjunctionQuery(conjuncts...)
+}
+
+// chromaWhere returns the filter as a Chroma metadata filter, or nil when the
+// filter is empty. Chroma metadata can't hold lists, so every tag is stored
+// as its own boolean key and creation dates are stored as Unix timestamps.
+func (f *SearchFilter) chromaWhere() chroma.WhereFilter {
+	if f.IsEmpty() {
+		return nil
+	}
+
+	var clauses []chroma.WhereClause
+
+	if len(f.DocumentIDs) > 0 {
+		ids := make([]int, len(f.DocumentIDs))
+		for i, id := range f.DocumentIDs {
+			ids[i] = int(id)
+		}
+		clauses = append(clauses, chroma.InInt("document_id", ids...))
+	}
+
+	if len(f.FileTypes) > 0 {
+		fileTypes := make([]string, len(f.FileTypes))
+		for i, fileType := range f.FileTypes {
+			fileTypes[i] = normalizeFileType(fileType)
+		}
+		clauses = append(clauses, chroma.InString("file_type", fileTypes...))
+	}
+
+	if len(f.Tags) > 0 {
+		tagClauses := make([]chroma.WhereClause, len(f.Tags))
+		for i, tag := range f.Tags {
+			tagClauses[i] = chroma.EqBool(chromaTagKey(tag), true)
+		}
+		clauses = append(clauses, chromaOr(tagClauses...))
+	}
+
+	if f.CreatedAfter != nil {
+		clauses = append(clauses, chroma.GteInt("created_at", int(f.CreatedAfter.Unix())))
+	}
+
+	if f.CreatedBefore != nil {
+		clauses = append(clauses, chroma.LtInt("created_at", int(f.CreatedBefore.Unix())))
+	}
+
+	return chromaAnd(clauses...)
+}
+
+// Chroma rejects $and and $or with fewer than two operands.
+func chromaAnd(clauses ...chroma.WhereClause) chroma.WhereClause {
+	if len(clauses) == 1 {
+		return clauses[0]
+	}
+
+	return chroma.And(clauses...)
+}
+
+func chromaOr(clauses ...chroma.WhereClause) chroma.WhereClause {
+	if len(clauses) == 1 {
+		return clauses[0]
+	}
+
+	return chroma.Or(clauses...)
+}
@@ -0,0 +1,121 @@
+package index
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/OptimusePrime/petagpt/internal/parser"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/blevesearch/bleve/v2"
+)
+
+var (
+	filterTestSeptember = time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+	filterTestOctober   = time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func TestSearchFilterBleveQuery(t *testing.T) {
+	index, err := bleve.NewMemOnly(newBleveIndexMapping("standard"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+
+	documents := []struct {
+		document sqlc.Document
+		tags     []string
+	}{
+		{sqlc.Document{ID: 1, Filepath: "a.pdf", Filetype: ".pdf", CreatedAt: filterTestSeptember.Add(-time.Hour)}, []string{"2023"}},
+		{sqlc.Document{ID: 2, Filepath: "b.pdf", Filetype: ".pdf", CreatedAt: filterTestSeptember.Add(time.Hour)}, []string{"2024", "ispiti"}},
+		{sqlc.Document{ID: 3, Filepath: "c.docx", Filetype: ".docx", CreatedAt: filterTestOctober.Add(time.Hour)}, []string{"2024"}},
+		{sqlc.Document{ID: 4, Filepath: "d.md", Filetype: ".md", CreatedAt: filterTestOctober.Add(-time.Hour)}, nil},
+	}
+	for _, document := range documents {
+		chunk := parser.Chunk{Content: "Pravilnik o ocjenjivanju učenika."}
+		err := index.Index(strconv.FormatInt(document.document.ID, 10), newBleveChunk(document.document, document.tags, chunk, time.Now()))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter *SearchFilter
+		want   []string
+	}{
+		{name: "no filter", want: []string{"1", "2", "3", "4"}},
+		{name: "empty filter", filter: &SearchFilter{}, want: []string{"1", "2", "3", "4"}},
+		{name: "document IDs", filter: &SearchFilter{DocumentIDs: []int64{2, 4}}, want: []string{"2", "4"}},
+		{name: "file types without dots", filter: &SearchFilter{FileTypes: []string{"pdf", ".md"}}, want: []string{"1", "2", "4"}},
+		{name: "any of the tags", filter: &SearchFilter{Tags: []string{"ispiti", "2023"}}, want: []string{"1", "2"}},
+		{name: "created after", filter: &SearchFilter{CreatedAfter: &filterTestSeptember}, want: []string{"2", "3", "4"}},
+		{name: "created between", filter: &SearchFilter{CreatedAfter: &filterTestSeptember, CreatedBefore: &filterTestOctober}, want: []string{"2", "4"}},
+		{name: "fields are combined", filter: &SearchFilter{Tags: []string{"2024"}, FileTypes: []string{"docx"}}, want: []string{"3"}},
+		{name: "nothing matches", filter: &SearchFilter{Tags: []string{"2024"}, DocumentIDs: []int64{1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := index.Search(newBleveSearchRequest("pravilnik", 10, tt.filter, QueryModeMatch))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, hit := range result.Hits {
+				got = append(got, hit.ID)
+			}
+			slices.Sort(got)
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("hits = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchFilterChromaWhere(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter *SearchFilter
+		want   string
+	}{
+		{name: "no filter", want: "null"},
+		{name: "empty filter", filter: &SearchFilter{}, want: "null"},
+		{
+			name:   "single tag",
+			filter: &SearchFilter{Tags: []string{"2024"}},
+			want:   `{"tag:2024":{"$eq":true}}`,
+		},
+		{
+			name:   "dates",
+			filter: &SearchFilter{CreatedAfter: &filterTestSeptember, CreatedBefore: &filterTestOctober},
+			want:   `{"$and":[{"created_at":{"$gte":1725148800}},{"created_at":{"$lt":1727740800}}]}`,
+		},
+		{
+			name: "every field",
+			filter: &SearchFilter{
+				DocumentIDs: []int64{1, 2},
+				FileTypes:   []string{"pdf"},
+				Tags:        []string{"2024", "ispiti"},
+			},
+			want: `{"$and":[{"document_id":{"$in":[1,2]}},{"file_type":{"$in":[".pdf"]}},{"$or":[{"tag:2024":{"$eq":true}},{"tag:ispiti":{"$eq":true}}]}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.filter.chromaWhere())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("chromaWhere() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package index
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve/v2/document"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/highlight"
+	"github.com/blevesearch/bleve/v2/search/highlight/format/ansi"
+	"github.com/blevesearch/bleve/v2/search/highlight/format/html"
+	"github.com/blevesearch/bleve/v2/search/highlight/fragmenter/simple"
+	simplehighlighter "github.com/blevesearch/bleve/v2/search/highlight/highlighter/simple"
+	"github.com/spf13/viper"
+)
+
+const (
+	HighlightStyleHTML = "html"
+	HighlightStyleANSI = "ansi"
+)
+
+var (
+	wordRegex     = regexp.MustCompile(`[\p{L}\p{N}]+`)
+	sentenceRegex = regexp.MustCompile(`[^.!?\n]+[.!?]*`)
+)
+
+// newHighlighter builds a highlighter marking terms in the given style, with
+// fragments of highlight.fragment_size characters. Bleve only offers
+// highlighters with a fixed fragment size through its registry, so the
+// highlighter is applied to the hits by Highlight instead of by Bleve itself.
+func newHighlighter(style string) (*simplehighlighter.Highlighter, error) {
+	var formatter highlight.FragmentFormatter
+	switch style {
+	case HighlightStyleHTML:
+		formatter = html.NewFragmentFormatter("<mark>", "</mark>")
+	case HighlightStyleANSI:
+		formatter = ansi.NewFragmentFormatter(ansi.DefaultAnsiHighlight)
+	default:
+		return nil, fmt.Errorf("unknown highlight style: %s", style)
+	}
+
+	return simplehighlighter.NewHighlighter(simple.NewFragmenter(highlightFragmentSize()), formatter, simplehighlighter.DefaultSeparator), nil
+}
+
+// Highlight sets the highlights of every document to up to
+// highlight.fragments fragments of its content around the terms matched by
+// BM25. Documents found only by the vector search get the sentence sharing
+// the most words with the query instead. It must be called before the
+// documents are expanded with their neighbours.
+func Highlight(docs []SearchDocument, queryString string, mode QueryMode, style string) error {
+	highlighter, err := newHighlighter(style)
+	if err != nil {
+		return err
+	}
+
+	fragments := max(viper.GetInt("highlight.fragments"), 1)
+	queryTerms := queryWords(plainQueryText(queryString, mode))
+
+	for i := range docs {
+		doc := &docs[i]
+
+		if len(doc.locations) > 0 {
+			match := &search.DocumentMatch{
+				Locations: search.FieldTermLocationMap{"content": doc.locations},
+			}
+			bleveDoc := document.NewDocument(doc.ID).
+				AddField(document.NewTextField("content", nil, []byte(doc.Content)))
+
+			doc.Highlights = highlighter.BestFragmentsInField(match, bleveDoc, "content", fragments)
+		}
+
+		if len(doc.Highlights) == 0 {
+			if fragment := bestSentence(highlighter, doc.Content, queryTerms); fragment != "" {
+				doc.Highlights = []string{fragment}
+			}
+		}
+	}
+
+	return nil
+}
+
+func highlightFragmentSize() int {
+	if size := viper.GetInt("highlight.fragment_size"); size > 0 {
+		return size
+	}
+
+	return 200
+}
+
+func queryWords(queryString string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range wordRegex.FindAllString(queryString, -1) {
+		words[strings.ToLower(word)] = true
+	}
+
+	return words
+}
+
+// bestSentence formats the sentence of content containing the most distinct
+// query terms, or the first sentence if none of them occur, cut to the
+// fragment size of the highlighter.
+func bestSentence(highlighter *simplehighlighter.Highlighter, content string, queryTerms map[string]bool) string {
+	var (
+		best      []int
+		bestScore = -1
+	)
+
+	for _, sentence := range sentenceRegex.FindAllStringIndex(content, -1) {
+		if strings.TrimSpace(content[sentence[0]:sentence[1]]) == "" {
+			continue
+		}
+
+		matched := make(map[string]bool)
+		for _, word := range wordRegex.FindAllString(content[sentence[0]:sentence[1]], -1) {
+			if word = strings.ToLower(word); queryTerms[word] {
+				matched[word] = true
+			}
+		}
+
+		if len(matched) > bestScore {
+			best, bestScore = sentence, len(matched)
+		}
+	}
+
+	if best == nil {
+		return ""
+	}
+
+	start := best[0]
+	for start < best[1] && (content[start] == ' ' || content[start] == '\t') {
+		start++
+	}
+
+	end, fragmentSize := start, highlightFragmentSize()
+	for used := 0; end < best[1] && used < fragmentSize; used++ {
+		_, size := utf8.DecodeRuneInString(content[end:])
+		end += size
+	}
+
+	fragment := &highlight.Fragment{
+		Orig:  []byte(content),
+		Start: start,
+		End:   end,
+	}
+
+	var locations highlight.TermLocations
+	for _, word := range wordRegex.FindAllStringIndex(content[start:end], -1) {
+		if queryTerms[strings.ToLower(content[start+word[0]:start+word[1]])] {
+			locations = append(locations, &highlight.TermLocation{
+				Start: start + word[0],
+				End:   start + word[1],
+			})
+		}
+	}
+
+	formatted := highlighter.FragmentFormatter().Format(fragment, locations)
+	if start != 0 {
+		formatted = highlighter.Separator() + formatted
+	}
+	if end != len(content) {
+		formatted += highlighter.Separator()
+	}
+
+	return formatted
+}
@@ -0,0 +1,170 @@
+package index
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/OptimusePrime/petagpt/internal/parser"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/spf13/viper"
+)
+
+func TestQueryWords(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "", want: nil},
+		{query: "Solar panels", want: []string{"panels", "solar"}},
+		{query: "solar, SOLAR! panels?", want: []string{"panels", "solar"}},
+		{query: "Čaj 42", want: []string{"42", "čaj"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			words := slices.Sorted(maps.Keys(queryWords(tt.query)))
+			if !slices.Equal(words, tt.want) {
+				t.Errorf("queryWords(%q) = %v, want %v", tt.query, words, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewHighlighter(t *testing.T) {
+	for _, style := range []string{HighlightStyleHTML, HighlightStyleANSI} {
+		if _, err := newHighlighter(style); err != nil {
+			t.Errorf("newHighlighter(%q) error = %v", style, err)
+		}
+	}
+
+	if _, err := newHighlighter("latex"); err == nil {
+		t.Error("newHighlighter(\"latex\") succeeded")
+	}
+}
+
+func TestBestSentence(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		query        string
+		fragmentSize int
+		want         string
+	}{
+		{
+			name:    "empty content",
+			content: "",
+			query:   "solar",
+			want:    "",
+		},
+		{
+			name:    "sentence with most terms",
+			content: "Wind is cheap. Solar panels are cheap. Solar is sunny.",
+			query:   "solar panels",
+			want:    "…<mark>Solar</mark> <mark>panels</mark> are cheap.…",
+		},
+		{
+			name:    "repeated terms count once",
+			content: "Solar solar solar. Solar panels.",
+			query:   "solar panels",
+			want:    "…<mark>Solar</mark> <mark>panels</mark>.",
+		},
+		{
+			name:    "first sentence without matches",
+			content: "Wind is cheap. Coal is not.",
+			query:   "solar",
+			want:    "Wind is cheap.…",
+		},
+		{
+			name:    "whole content",
+			content: "Solar is cheap",
+			query:   "solar",
+			want:    "<mark>Solar</mark> is cheap",
+		},
+		{
+			name:         "cut to the fragment size",
+			content:      "Čaj and solar panels.",
+			query:        "čaj panels",
+			fragmentSize: 9,
+			want:         "<mark>Čaj</mark> and s…",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("highlight.fragment_size", tt.fragmentSize)
+			t.Cleanup(func() { viper.Set("highlight.fragment_size", nil) })
+
+			highlighter, err := newHighlighter(HighlightStyleHTML)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := bestSentence(highlighter, tt.content, queryWords(tt.query)); got != tt.want {
+				t.Errorf("bestSentence() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighlightWithoutLocations(t *testing.T) {
+	docs := []SearchDocument{
+		{Document: Document{ID: "a", Content: "Wind is cheap. Solar is cheap."}},
+		{Document: Document{ID: "b", Content: ""}},
+	}
+
+	if err := Highlight(docs, `+solar -wind`, QueryModeSyntax, HighlightStyleHTML); err != nil {
+		t.Fatalf("Highlight() error = %v", err)
+	}
+
+	if want := []string{"…<mark>Solar</mark> is cheap."}; !slices.Equal(docs[0].Highlights, want) {
+		t.Errorf("highlights of a = %q, want %q", docs[0].Highlights, want)
+	}
+	if len(docs[1].Highlights) != 0 {
+		t.Errorf("highlights of b = %q, want none", docs[1].Highlights)
+	}
+}
+
+func TestHighlightBleveHits(t *testing.T) {
+	index, err := bleve.NewMemOnly(newBleveIndexMapping("standard"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = index.Close() })
+
+	chunks := []parser.Chunk{
+		{ID: "a", Content: "Wind is cheap. Solar panels are cheap."},
+		{ID: "b", Content: "Panels need cleaning."},
+	}
+	if err = indexBleveChunks(index, sqlc.Document{ID: 1, Filepath: "a.md"}, nil, chunks...); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := index.Search(newBleveSearchRequest("solar panels", 10, nil, QueryModeMatch))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var docs []SearchDocument
+	for _, hit := range result.Hits {
+		docs = append(docs, SearchDocument{Document: bleveHitToDocument(hit)})
+	}
+
+	if err = Highlight(docs, "solar panels", QueryModeMatch, HighlightStyleHTML); err != nil {
+		t.Fatalf("Highlight() error = %v", err)
+	}
+
+	want := map[string]string{
+		"a": "Wind is cheap. <mark>Solar</mark> <mark>panels</mark> are cheap.",
+		"b": "<mark>Panels</mark> need cleaning.",
+	}
+	if len(docs) != len(want) {
+		t.Fatalf("search found %d chunks, want %d", len(docs), len(want))
+	}
+	for _, doc := range docs {
+		if !slices.Equal(doc.Highlights, []string{want[doc.ID]}) {
+			t.Errorf("highlights of %s = %q, want %q", doc.ID, doc.Highlights, want[doc.ID])
+		}
+	}
+}
@@ -4,23 +4,54 @@ import (
 	"context"
 	"crypto/sha256"
 	"fmt"
+	"path/filepath"
 
 	"github.com/OptimusePrime/petagpt/internal/db"
 	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/blevesearch/bleve/v2/search"
 )
 
 type Document struct {
-	ID      string `json:"id"`
-	Title   string `json:"title"`
-	Content string `json:"content"`
+	ID         string   `json:"id"`
+	Title      string   `json:"title"`
+	Content    string   `json:"content"`
+	Context    string   `json:"context,omitempty"`
+	DocumentID int64    `json:"document_id,omitempty"`
+	FileName   string   `json:"file_name,omitempty"`
+	FileType   string   `json:"file_type,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Page       int      `json:"page,omitempty"`
+	// Index is the name of the index the document was found in.
+	Index string `json:"index,omitempty"`
+	// Highlights are fragments of the content around the matched terms,
+	// set by Highlight.
+	Highlights []string `json:"highlights,omitempty"`
+
+	// locations of the terms matched by BM25 in the content.
+	locations search.TermLocationMap
 }
 
 func (d Document) SHA256() string {
 	return fmt.Sprintf("%x", sha256.Sum256([]byte(d.Content)))
 }
 
+// key identifies a document across retrievers. Chroma and Bleve both use the
+// chunk's indexing ID as the document ID, so hits for the same chunk are fused
+// together.
+func (d Document) key() string {
+	if d.ID != "" {
+		return d.ID
+	}
+
+	return d.SHA256()
+}
+
 type SearchResult struct {
 	Documents []SearchDocument
+	// Degraded is set when one of the retrievers failed and the documents
+	// come from the other one only.
+	Degraded       bool
+	DegradedReason string
 }
 
 type SearchDocument struct {
@@ -41,10 +72,14 @@ func CreateIndex(ctx context.Context, params sqlc.CreateIndexParams) error {
 		return fmt.Errorf("failed creating Bleve index: %w", err)
 	}
 
-	err = CreateChromaCollection(ctx, params.Name)
+	err = CreateChromaCollection(ctx, params.Collection)
 	if err != nil {
 		return fmt.Errorf("failed creating Chroma collection: %w", err)
 	}
 
 	return nil
 }
+
+func documentFileName(document sqlc.Document) string {
+	return filepath.Base(document.Filepath)
+}
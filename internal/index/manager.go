@@ -0,0 +1,418 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	chroma "github.com/OptimusePrime/chroma-go/pkg/api/v2"
+	"github.com/OptimusePrime/chroma-go/pkg/embeddings"
+	"github.com/OptimusePrime/chroma-go/pkg/embeddings/vllm"
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/spf13/viper"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultManager holds the index handles shared by the whole process.
+var DefaultManager = NewManager()
+
+type bleveHandle struct {
+	index    bleve.Index
+	path     string
+	lastUsed atomic.Int64
+	// users counts the calls using the index, which is only closed once
+	// they're done.
+	users atomic.Int64
+	done  sync.WaitGroup
+}
+
+func (h *bleveHandle) touch() {
+	h.lastUsed.Store(time.Now().UnixNano())
+}
+
+// pin marks the handle as in use. It's only called while the handle is in
+// Manager.bleve, so it can't race with close.
+func (h *bleveHandle) pin() {
+	h.users.Add(1)
+	h.done.Add(1)
+	h.touch()
+}
+
+func (h *bleveHandle) unpin() {
+	h.touch()
+	h.users.Add(-1)
+	h.done.Done()
+}
+
+// close waits for the calls using the handle and closes the index. The handle
+// must have been removed from Manager.bleve first.
+func (h *bleveHandle) close() error {
+	h.done.Wait()
+	return h.index.Close()
+}
+
+// Manager keeps Bleve indexes and Chroma collections open between calls.
+// Handles are opened lazily on first use and are safe to share between
+// goroutines. Bleve takes an exclusive file lock while an index is open, so
+// long-running processes should call ReleaseIdle to let other processes in.
+//
+// mu only guards the maps. A Bleve handle in use is pinned instead, so that a
+// long batch on one index doesn't hold up searches or handles being dropped;
+// dropped handles are closed outside mu once their calls are done.
+//
+// Handles are opened without holding mu, so that opening one index, which may
+// wait for another process's lock, doesn't block the others. Opens of the same
+// index are deduplicated by opening, and a handle is only kept if no handles
+// were dropped while it was being opened, as it might then be stale.
+type Manager struct {
+	mu          sync.RWMutex
+	lookup      func(ctx context.Context, name string) (sqlc.Index, error)
+	bleve       map[string]*bleveHandle
+	chroma      chroma.Client
+	ef          embeddings.EmbeddingFunction
+	collections map[string]chroma.Collection
+	// generation is incremented whenever handles are dropped.
+	generation uint64
+	opening    singleflight.Group
+	// clientMu serialises calls on the Chroma client, which caches
+	// collections without synchronisation. It's taken before mu.
+	clientMu sync.Mutex
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		lookup:      lookupIndex,
+		bleve:       make(map[string]*bleveHandle),
+		collections: make(map[string]chroma.Collection),
+	}
+}
+
+func lookupIndex(ctx context.Context, name string) (sqlc.Index, error) {
+	idx, err := sqlc.New(db.MainDB).GetIndexByName(ctx, name)
+	if err != nil {
+		return sqlc.Index{}, fmt.Errorf("failed to find index: %s: %w", name, err)
+	}
+
+	return idx, nil
+}
+
+func openBleveIndex(path string) (bleve.Index, error) {
+	config := map[string]interface{}{}
+	if timeout := viper.GetString("bm25.lock_timeout"); timeout != "" {
+		config["bolt_timeout"] = timeout
+	}
+
+	index, err := bleve.OpenUsing(path, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Bleve index (is it in use by another process?): %w", err)
+	}
+
+	return index, nil
+}
+
+func (m *Manager) openBleve(ctx context.Context, name string) error {
+	_, err, _ := m.opening.Do("bleve/"+name, func() (any, error) {
+		m.mu.RLock()
+		_, ok := m.bleve[name]
+		generation := m.generation
+		m.mu.RUnlock()
+		if ok {
+			return nil, nil
+		}
+
+		idx, err := m.lookup(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		index, err := openBleveIndex(idx.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = checkBleveMapping(index, name); err != nil {
+			return nil, errors.Join(err, index.Close())
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		// The index may have been removed or moved while it was being opened,
+		// the caller retries with a fresh lookup.
+		if m.generation != generation {
+			return nil, index.Close()
+		}
+
+		handle := &bleveHandle{
+			index: index,
+			path:  idx.Path,
+		}
+		handle.touch()
+		m.bleve[name] = handle
+
+		return nil, nil
+	})
+
+	return err
+}
+
+// withBleve runs fn with the open Bleve index of the named index. The handle
+// isn't closed by Remove, Reload or ReleaseIdle until fn returns.
+func (m *Manager) withBleve(ctx context.Context, name string, fn func(index bleve.Index) error) error {
+	for {
+		m.mu.RLock()
+		handle, ok := m.bleve[name]
+		if ok {
+			handle.pin()
+		}
+		m.mu.RUnlock()
+
+		if ok {
+			defer handle.unpin()
+			return fn(handle.index)
+		}
+
+		if err := m.openBleve(ctx, name); err != nil {
+			return err
+		}
+	}
+}
+
+func (m *Manager) embeddingFunction() (embeddings.EmbeddingFunction, error) {
+	if m.ef != nil {
+		return m.ef, nil
+	}
+
+	ef, err := vllm.NewVLLMEmbeddingFunctionFromOptions(
+		vllm.WithModel(viper.GetString("embedding_service.model")),
+		vllm.WithBaseURL(viper.GetString("embedding_service.base_url")),
+		vllm.WithAPIKey(viper.GetString("embedding_service.api_key")),
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.ef = ef
+
+	return ef, nil
+}
+
+// chromaClient returns the shared Chroma client and embedding function,
+// creating them on first use.
+func (m *Manager) chromaClient() (chroma.Client, embeddings.EmbeddingFunction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ef, err := m.embeddingFunction()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if m.chroma == nil {
+		client, err := chroma.NewHTTPClient(chroma.WithBaseURL(viper.GetString("chroma.base_url")))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create chroma client: %w", err)
+		}
+		m.chroma = client
+	}
+
+	return m.chroma, ef, nil
+}
+
+// Collection returns the Chroma collection of the named index.
+func (m *Manager) Collection(ctx context.Context, name string) (chroma.Collection, error) {
+	m.mu.RLock()
+	collection, ok := m.collections[name]
+	m.mu.RUnlock()
+	if ok {
+		return collection, nil
+	}
+
+	v, err, _ := m.opening.Do("chroma/"+name, func() (any, error) {
+		m.mu.RLock()
+		collection, ok := m.collections[name]
+		generation := m.generation
+		m.mu.RUnlock()
+		if ok {
+			return collection, nil
+		}
+
+		idx, err := m.lookup(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		err = m.withChromaClient(func(client chroma.Client, ef embeddings.EmbeddingFunction) error {
+			collection, err = client.GetCollection(ctx, idx.Collection, chroma.WithEmbeddingFunctionGet(ef))
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get collection: %w", err)
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		// A collection fetched while handles were dropped is still returned,
+		// but fetched again next time.
+		if m.generation == generation {
+			m.collections[name] = collection
+		}
+
+		return collection, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(chroma.Collection), nil
+}
+
+// withChromaClient runs fn with the shared Chroma client. Collection
+// lifecycle calls go through here because the client caches collections
+// without synchronisation.
+func (m *Manager) withChromaClient(fn func(client chroma.Client, ef embeddings.EmbeddingFunction) error) error {
+	m.clientMu.Lock()
+	defer m.clientMu.Unlock()
+
+	client, ef, err := m.chromaClient()
+	if err != nil {
+		return err
+	}
+
+	return fn(client, ef)
+}
+
+// Remove closes and forgets all handles of the named index. It must be
+// called before the index is deleted, and waits for calls still using it.
+func (m *Manager) Remove(name string) error {
+	m.mu.Lock()
+	handle := m.removeLocked(name)
+	m.mu.Unlock()
+
+	return closeBleveHandles(map[string]*bleveHandle{name: handle})
+}
+
+// removeLocked forgets the handles of the named index, returning its Bleve
+// handle, if any, to be closed once mu is released.
+func (m *Manager) removeLocked(name string) *bleveHandle {
+	m.generation++
+
+	handle := m.bleve[name]
+	delete(m.bleve, name)
+	delete(m.collections, name)
+
+	return handle
+}
+
+func closeBleveHandles(handles map[string]*bleveHandle) error {
+	var errs []error
+	for name, handle := range handles {
+		if handle == nil {
+			continue
+		}
+
+		if err := handle.close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close Bleve index: %s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Reload drops handles of indexes which were removed, moved or rebuilt since
+// they were opened. With all set, every Chroma collection is forgotten as well,
+// so that collections recreated under the same name are fetched again. New
+// indexes need no reload because handles are opened on first use.
+func (m *Manager) Reload(ctx context.Context, all bool) error {
+	indexes, err := sqlc.New(db.MainDB).ListIndexes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list indexes: %w", err)
+	}
+
+	current := make(map[string]sqlc.Index, len(indexes))
+	for _, idx := range indexes {
+		current[idx.Name] = idx
+	}
+
+	m.mu.Lock()
+
+	dropped := make(map[string]*bleveHandle)
+	for name, handle := range m.bleve {
+		if idx, ok := current[name]; ok && idx.Path == handle.path {
+			continue
+		}
+
+		dropped[name] = m.removeLocked(name)
+	}
+
+	if all {
+		m.generation++
+		clear(m.collections)
+	}
+	for name, collection := range m.collections {
+		if idx, ok := current[name]; ok && idx.Collection == collection.Name() {
+			continue
+		}
+
+		m.generation++
+		delete(m.collections, name)
+	}
+
+	m.mu.Unlock()
+
+	return closeBleveHandles(dropped)
+}
+
+// ReleaseIdle closes Bleve indexes which haven't been used for maxIdle,
+// releasing their file locks until they are needed again. Indexes in use are
+// kept however long they've been used for.
+func (m *Manager) ReleaseIdle(maxIdle time.Duration) error {
+	m.mu.Lock()
+
+	idleSince := time.Now().Add(-maxIdle).UnixNano()
+
+	released := make(map[string]*bleveHandle)
+	for name, handle := range m.bleve {
+		if handle.users.Load() > 0 || handle.lastUsed.Load() > idleSince {
+			continue
+		}
+
+		released[name] = m.removeLocked(name)
+	}
+
+	m.mu.Unlock()
+
+	return closeBleveHandles(released)
+}
+
+// Close closes every open handle. The manager can still be used afterwards
+// and will reopen handles as needed.
+func (m *Manager) Close() error {
+	m.clientMu.Lock()
+	defer m.clientMu.Unlock()
+
+	m.mu.Lock()
+
+	closed := make(map[string]*bleveHandle, len(m.bleve))
+	for name := range m.bleve {
+		closed[name] = m.removeLocked(name)
+	}
+	m.generation++
+	clear(m.collections)
+
+	var errs []error
+	if m.chroma != nil {
+		errs = append(errs, m.chroma.Close())
+		m.chroma = nil
+		m.ef = nil
+	}
+
+	m.mu.Unlock()
+
+	return errors.Join(append(errs, closeBleveHandles(closed))...)
+}
@@ -0,0 +1,261 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OptimusePrime/petagpt/internal/parser"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/spf13/viper"
+)
+
+const benchmarkIndexName = "benchmark"
+
+var benchmarkQueries = []string{
+	"pravilnik o ocjenjivanju",
+	"kurikulum informatike",
+	"izostanci s nastave",
+	"školska pravila",
+}
+
+const (
+	benchmarkDocuments = 200
+	benchmarkChunks    = 50
+)
+
+// newBenchmarkIndex creates a Bleve index the size of a real one, with
+// benchmarkDocuments documents of benchmarkChunks paragraph-sized chunks each,
+// indexed one document per batch the way ingestion does, and a manager that
+// resolves benchmarkIndexName to it.
+func newBenchmarkIndex(b *testing.B) (string, *Manager) {
+	b.Helper()
+
+	viper.Set("bm25.content_boost", 1.0)
+	viper.Set("bm25.context_boost", 0.4)
+
+	indexPath := filepath.Join(b.TempDir(), benchmarkIndexName+".bleve")
+	if _, err := CreateBleveIndex(indexPath, "standard"); err != nil {
+		b.Fatal(err)
+	}
+
+	index, err := bleve.Open(indexPath)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for d := range benchmarkDocuments {
+		document := sqlc.Document{
+			ID:        int64(d + 1),
+			Filepath:  fmt.Sprintf("benchmark-%d.pdf", d),
+			Filetype:  ".pdf",
+			CreatedAt: time.Now(),
+		}
+
+		batch := index.NewBatch()
+		for i := range benchmarkChunks {
+			n := d*benchmarkChunks + i
+			chunk := parser.Chunk{
+				Content: strings.Repeat(fmt.Sprintf("Odlomak %d s temom %d: %s. ", n, n%97, benchmarkQueries[n%len(benchmarkQueries)]), 8),
+				Context: fmt.Sprintf("Dio %d dokumenta %d o pravilima škole.", i, d),
+				Page:    i / 10,
+				Ordinal: i,
+			}
+			if err := batch.Index(chunk.SHA256(), newBleveChunk(document, nil, chunk, time.Now())); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := index.Batch(batch); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := index.Close(); err != nil {
+		b.Fatal(err)
+	}
+
+	manager := NewManager()
+	manager.lookup = func(ctx context.Context, name string) (sqlc.Index, error) {
+		return sqlc.Index{Name: name, Path: indexPath, Collection: name}, nil
+	}
+	b.Cleanup(func() {
+		if err := manager.Close(); err != nil {
+			b.Error(err)
+		}
+	})
+
+	return indexPath, manager
+}
+
+// BenchmarkOpenBleve measures opening and closing the index on its own, the
+// cost a managed handle saves on every call.
+func BenchmarkOpenBleve(b *testing.B) {
+	indexPath, _ := newBenchmarkIndex(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		index, err := bleve.Open(indexPath)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if err = index.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSearchBleveOpenPerCall measures the previous behaviour of opening
+// and closing the index around every search.
+func BenchmarkSearchBleveOpenPerCall(b *testing.B) {
+	indexPath, _ := newBenchmarkIndex(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		index, err := bleve.Open(indexPath)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		_, err = index.Search(newBleveSearchRequest(benchmarkQueries[i%len(benchmarkQueries)], 20, nil, QueryModeMatch))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if err = index.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSearchBleveManaged(b *testing.B) {
+	_, manager := newBenchmarkIndex(b)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := manager.withBleve(ctx, benchmarkIndexName, func(index bleve.Index) error {
+			_, err := index.Search(newBleveSearchRequest(benchmarkQueries[i%len(benchmarkQueries)], 20, nil, QueryModeMatch))
+			return err
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSearchBleveManagedParallel searches from many goroutines at once,
+// which failed on the bolt lock when every call opened the index itself.
+func BenchmarkSearchBleveManagedParallel(b *testing.B) {
+	_, manager := newBenchmarkIndex(b)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			err := manager.withBleve(ctx, benchmarkIndexName, func(index bleve.Index) error {
+				_, err := index.Search(newBleveSearchRequest(benchmarkQueries[i%len(benchmarkQueries)], 20, nil, QueryModeMatch))
+				return err
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			i++
+		}
+	})
+}
+
+// newTestManager returns a manager resolving every name to a fresh Bleve index
+// of its own.
+func newTestManager(t *testing.T, names ...string) *Manager {
+	t.Helper()
+
+	paths := make(map[string]string)
+	for _, name := range names {
+		paths[name] = filepath.Join(t.TempDir(), name+".bleve")
+		if _, err := CreateBleveIndex(paths[name], "standard"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manager := NewManager()
+	manager.lookup = func(ctx context.Context, name string) (sqlc.Index, error) {
+		return sqlc.Index{Name: name, Path: paths[name], Collection: name}, nil
+	}
+	t.Cleanup(func() {
+		if err := manager.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return manager
+}
+
+func TestManagerPinsHandles(t *testing.T) {
+	manager := newTestManager(t, "busy", "other")
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	busyDone := make(chan error)
+	go func() {
+		busyDone <- manager.withBleve(ctx, "busy", func(index bleve.Index) error {
+			close(started)
+			<-release
+
+			// The index must still be open.
+			_, err := index.DocCount()
+			return err
+		})
+	}()
+	<-started
+
+	if err := manager.ReleaseIdle(0); err != nil {
+		t.Fatal(err)
+	}
+
+	removed := make(chan error)
+	go func() {
+		removed <- manager.Remove("busy")
+	}()
+
+	// Other indexes are usable while one is busy and waiting to be removed.
+	for range 10 {
+		select {
+		case err := <-removed:
+			t.Fatalf("Remove returned while the index was in use: %v", err)
+		default:
+		}
+
+		otherDone := make(chan error)
+		go func() {
+			otherDone <- manager.withBleve(ctx, "other", func(index bleve.Index) error {
+				_, err := index.DocCount()
+				return err
+			})
+		}()
+
+		select {
+		case err := <-otherDone:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("withBleve blocked on another index being used")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	if err := <-busyDone; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-removed; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,129 @@
+package index
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+)
+
+// passage is a range of chunk ordinals within one document, positioned at the
+// best ranked hit it contains.
+type passage struct {
+	position    int
+	documentID  int64
+	first, last int64
+}
+
+// ExpandNeighbours replaces every document with a passage made of its chunk
+// and up to n chunks before and after it from the same document. Passages
+// which overlap or touch are merged, so every chunk is returned at most once,
+// at the position of the best ranked hit within it. Documents whose chunks
+// have no recorded ordinal are returned unchanged.
+func ExpandNeighbours(ctx context.Context, docs []SearchDocument, n int) ([]SearchDocument, error) {
+	if n <= 0 || len(docs) == 0 {
+		return docs, nil
+	}
+
+	queries := sqlc.New(db.MainDB)
+
+	var unchanged []int
+	passagesByDocument := make(map[int64][]passage)
+
+	for i, doc := range docs {
+		row, err := queries.GetChunkByIndexingID(ctx, doc.ID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && !row.Ordinal.Valid) {
+			unchanged = append(unchanged, i)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to find chunk: %s: %w", doc.ID, err)
+		}
+
+		passagesByDocument[row.DocumentID] = append(passagesByDocument[row.DocumentID], passage{
+			position:   i,
+			documentID: row.DocumentID,
+			first:      row.Ordinal.Int64 - int64(n),
+			last:       row.Ordinal.Int64 + int64(n),
+		})
+	}
+
+	var passages []passage
+	for _, documentPassages := range passagesByDocument {
+		passages = append(passages, mergePassages(documentPassages)...)
+	}
+
+	expanded := make(map[int]SearchDocument, len(docs))
+	for _, i := range unchanged {
+		expanded[i] = docs[i]
+	}
+
+	for _, p := range passages {
+		rows, err := queries.ListChunksByOrdinalRange(ctx, sqlc.ListChunksByOrdinalRangeParams{
+			DocumentID:   p.documentID,
+			FirstOrdinal: sql.NullInt64{Int64: p.first, Valid: true},
+			LastOrdinal:  sql.NullInt64{Int64: p.last, Valid: true},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed listing neighbouring chunks: %w", err)
+		}
+
+		contents := make([]string, len(rows))
+		for i, row := range rows {
+			contents[i] = row.Content
+		}
+
+		doc := docs[p.position]
+		if len(contents) > 0 {
+			doc.Content = strings.Join(contents, "\n\n")
+		}
+		expanded[p.position] = doc
+	}
+
+	positions := make([]int, 0, len(expanded))
+	for position := range expanded {
+		positions = append(positions, position)
+	}
+	slices.Sort(positions)
+
+	result := make([]SearchDocument, len(positions))
+	for i, position := range positions {
+		result[i] = expanded[position]
+		result[i].Rank = i + 1
+	}
+
+	return result, nil
+}
+
+// mergePassages merges the overlapping or adjacent passages of one document.
+func mergePassages(passages []passage) []passage {
+	slices.SortFunc(passages, func(a, b passage) int {
+		switch {
+		case a.first < b.first:
+			return -1
+		case a.first > b.first:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	merged := passages[:1]
+	for _, p := range passages[1:] {
+		last := &merged[len(merged)-1]
+		if p.first > last.last+1 {
+			merged = append(merged, p)
+			continue
+		}
+
+		last.last = max(last.last, p.last)
+		last.position = min(last.position, p.position)
+	}
+
+	return merged
+}
@@ -0,0 +1,139 @@
+package index
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestMergePassages(t *testing.T) {
+	tests := []struct {
+		name     string
+		passages []passage
+		want     []passage
+	}{
+		{
+			name:     "single passage",
+			passages: []passage{{position: 0, first: 1, last: 3}},
+			want:     []passage{{position: 0, first: 1, last: 3}},
+		},
+		{
+			name:     "separate passages",
+			passages: []passage{{position: 0, first: 10, last: 12}, {position: 1, first: 1, last: 3}},
+			want:     []passage{{position: 1, first: 1, last: 3}, {position: 0, first: 10, last: 12}},
+		},
+		{
+			name:     "overlapping passages",
+			passages: []passage{{position: 2, first: 1, last: 3}, {position: 0, first: 2, last: 4}},
+			want:     []passage{{position: 0, first: 1, last: 4}},
+		},
+		{
+			name:     "adjacent passages",
+			passages: []passage{{position: 0, first: 1, last: 3}, {position: 1, first: 4, last: 6}},
+			want:     []passage{{position: 0, first: 1, last: 6}},
+		},
+		{
+			name:     "contained passage",
+			passages: []passage{{position: 1, first: 1, last: 9}, {position: 0, first: 3, last: 5}},
+			want:     []passage{{position: 0, first: 1, last: 9}},
+		},
+		{
+			name: "chain of passages",
+			passages: []passage{
+				{position: 3, first: 7, last: 9},
+				{position: 1, first: 1, last: 3},
+				{position: 2, first: 4, last: 6},
+				{position: 0, first: 20, last: 22},
+			},
+			want: []passage{{position: 1, first: 1, last: 9}, {position: 0, first: 20, last: 22}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergePassages(tt.passages); !slices.Equal(got, tt.want) {
+				t.Errorf("mergePassages() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func searchDocuments(ids ...string) []SearchDocument {
+	docs := make([]SearchDocument, len(ids))
+	for i, id := range ids {
+		docs[i] = SearchDocument{Rank: i + 1, Document: Document{ID: id, Content: "hit " + id}}
+	}
+
+	return docs
+}
+
+func TestExpandNeighbours(t *testing.T) {
+	idx := newTestDB(t, "test")
+	addTestChunks(t, idx, 1, "a0", "a1", "a2", "a3", "a4", "a5", "a6")
+	addTestChunks(t, idx, 2, "b0", "b1")
+	execTestSQL(t, "INSERT INTO chunks (document_id, content, context, indexing_id) VALUES (2, 'content c', '', 'c')")
+
+	tests := []struct {
+		name string
+		docs []SearchDocument
+		n    int
+		// contents are the contents of the returned documents, in order.
+		contents []string
+	}{
+		{
+			name:     "no neighbours",
+			docs:     searchDocuments("a3"),
+			contents: []string{"hit a3"},
+		},
+		{
+			name:     "neighbours on both sides",
+			docs:     searchDocuments("a3"),
+			n:        1,
+			contents: []string{"content a2\n\ncontent a3\n\ncontent a4"},
+		},
+		{
+			name:     "start of the document",
+			docs:     searchDocuments("b0"),
+			n:        2,
+			contents: []string{"content b0\n\ncontent b1"},
+		},
+		{
+			name:     "overlapping passages merged at the best rank",
+			docs:     searchDocuments("b1", "a4", "a2"),
+			n:        1,
+			contents: []string{"content b0\n\ncontent b1", "content a1\n\ncontent a2\n\ncontent a3\n\ncontent a4\n\ncontent a5"},
+		},
+		{
+			name:     "separate passages of one document",
+			docs:     searchDocuments("a6", "a0"),
+			n:        1,
+			contents: []string{"content a5\n\ncontent a6", "content a0\n\ncontent a1"},
+		},
+		{
+			name:     "chunk without ordinal and unknown chunk",
+			docs:     searchDocuments("c", "missing", "a0"),
+			n:        1,
+			contents: []string{"hit c", "hit missing", "content a0\n\ncontent a1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := ExpandNeighbours(context.Background(), tt.docs, tt.n)
+			if err != nil {
+				t.Fatalf("ExpandNeighbours() error = %v", err)
+			}
+
+			var contents []string
+			for i, doc := range docs {
+				contents = append(contents, doc.Content)
+				if doc.Rank != i+1 {
+					t.Errorf("document %d has rank %d", i, doc.Rank)
+				}
+			}
+			if !slices.Equal(contents, tt.contents) {
+				t.Errorf("ExpandNeighbours() = %q, want %q", contents, tt.contents)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package index
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"github.com/spf13/viper"
+)
+
+// QueryMode selects how a search query is interpreted by the BM25 retriever.
+type QueryMode string
+
+const (
+	// QueryModeMatch matches the words of the query against the content and
+	// context of chunks, tolerating typos. It is meant for queries written by
+	// the LLM.
+	QueryModeMatch QueryMode = "match"
+	// QueryModeSyntax parses the query using the Bleve query string syntax,
+	// supporting "phrases", +required and -excluded terms, field:value
+	// restrictions and fuzzy~ terms.
+	QueryModeSyntax QueryMode = "syntax"
+)
+
+// ParseQueryMode parses a query mode, defaulting to QueryModeMatch.
+func ParseQueryMode(mode string) (QueryMode, error) {
+	switch QueryMode(mode) {
+	case "", QueryModeMatch:
+		return QueryModeMatch, nil
+	case QueryModeSyntax:
+		return QueryModeSyntax, nil
+	default:
+		return "", fmt.Errorf("unknown query mode: %s", mode)
+	}
+}
+
+// newBleveQuery builds the BM25 query for queryString in the given mode.
+func newBleveQuery(queryString string, mode QueryMode) query.Query {
+	if mode == QueryModeSyntax {
+		return bleve.NewQueryStringQuery(queryString)
+	}
+
+	contentQuery := bleve.NewMatchQuery(queryString)
+	contentQuery.SetField("content")
+	contentQuery.SetBoost(viper.GetFloat64("bm25.content_boost"))
+
+	contextQuery := bleve.NewMatchQuery(queryString)
+	contextQuery.SetField("context")
+	contextQuery.SetBoost(viper.GetFloat64("bm25.context_boost"))
+
+	disjuncts := []query.Query{contentQuery, contextQuery}
+
+	// Exact matches keep their full weight, while misspelled words still
+	// match the content through a fuzzy query whose edit distance depends on
+	// the word length, so short words aren't matched loosely.
+	if fuzzyBoost := viper.GetFloat64("bm25.fuzzy_boost"); fuzzyBoost > 0 {
+		fuzzyQuery := bleve.NewMatchQuery(queryString)
+		fuzzyQuery.SetField("content")
+		fuzzyQuery.SetAutoFuzziness(true)
+		fuzzyQuery.SetBoost(fuzzyBoost)
+		disjuncts = append(disjuncts, fuzzyQuery)
+	}
+
+	return bleve.NewDisjunctionQuery(disjuncts...)
+}
+
+var syntaxTokenRegex = regexp.MustCompile(`[+-]?(?:[\w.]+:)?(?:"[^"]*"|\S+)`)
+
+var syntaxSuffixRegex = regexp.MustCompile(`[~^][\d.]*$`)
+
+// plainQueryText strips the query string syntax from a query so it can be
+// embedded. Excluded terms are dropped entirely.
+func plainQueryText(queryString string, mode QueryMode) string {
+	if mode != QueryModeSyntax {
+		return queryString
+	}
+
+	var words []string
+	for _, token := range syntaxTokenRegex.FindAllString(queryString, -1) {
+		if strings.HasPrefix(token, "-") {
+			continue
+		}
+		token = strings.TrimPrefix(token, "+")
+
+		if field, value, ok := strings.Cut(token, ":"); ok && !strings.Contains(field, `"`) {
+			token = value
+		}
+
+		token = syntaxSuffixRegex.ReplaceAllString(token, "")
+		token = strings.Trim(token, `"`)
+		if token != "" {
+			words = append(words, token)
+		}
+	}
+
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,168 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/blevesearch/bleve/v2/search/query"
+	"github.com/spf13/viper"
+)
+
+func TestParseQueryMode(t *testing.T) {
+	tests := []struct {
+		mode string
+		want QueryMode
+		err  bool
+	}{
+		{mode: "", want: QueryModeMatch},
+		{mode: "match", want: QueryModeMatch},
+		{mode: "syntax", want: QueryModeSyntax},
+		{mode: "regex", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			mode, err := ParseQueryMode(tt.mode)
+			if (err != nil) != tt.err {
+				t.Fatalf("ParseQueryMode(%q) error = %v, want error %v", tt.mode, err, tt.err)
+			}
+			if mode != tt.want {
+				t.Errorf("ParseQueryMode(%q) = %q, want %q", tt.mode, mode, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewBleveQuery(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       QueryMode
+		fuzzyBoost float64
+		// disjuncts is the number of match queries, or 0 for a query string
+		// query.
+		disjuncts int
+	}{
+		{
+			name: "syntax",
+			mode: QueryModeSyntax,
+		},
+		{
+			name:      "match without fuzzy matching",
+			mode:      QueryModeMatch,
+			disjuncts: 2,
+		},
+		{
+			name:       "match with fuzzy matching",
+			mode:       QueryModeMatch,
+			fuzzyBoost: 0.5,
+			disjuncts:  3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("bm25.content_boost", 2)
+			viper.Set("bm25.context_boost", 0.5)
+			viper.Set("bm25.fuzzy_boost", tt.fuzzyBoost)
+			t.Cleanup(func() {
+				viper.Set("bm25.content_boost", nil)
+				viper.Set("bm25.context_boost", nil)
+				viper.Set("bm25.fuzzy_boost", nil)
+			})
+
+			q := newBleveQuery("hello world", tt.mode)
+
+			if tt.disjuncts == 0 {
+				if _, ok := q.(*query.QueryStringQuery); !ok {
+					t.Fatalf("newBleveQuery() = %T, want *query.QueryStringQuery", q)
+				}
+				return
+			}
+
+			disjunction, ok := q.(*query.DisjunctionQuery)
+			if !ok {
+				t.Fatalf("newBleveQuery() = %T, want *query.DisjunctionQuery", q)
+			}
+			if len(disjunction.Disjuncts) != tt.disjuncts {
+				t.Fatalf("newBleveQuery() has %d disjuncts, want %d", len(disjunction.Disjuncts), tt.disjuncts)
+			}
+
+			fields := []string{"content", "context", "content"}
+			boosts := []float64{2, 0.5, tt.fuzzyBoost}
+			for i, disjunct := range disjunction.Disjuncts {
+				match, ok := disjunct.(*query.MatchQuery)
+				if !ok {
+					t.Fatalf("disjunct %d = %T, want *query.MatchQuery", i, disjunct)
+				}
+				if match.Match != "hello world" || match.Field() != fields[i] || match.Boost() != boosts[i] {
+					t.Errorf("disjunct %d matches %q on %s boosted by %v, want %s boosted by %v", i, match.Match, match.Field(), match.Boost(), fields[i], boosts[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPlainQueryText(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		mode  QueryMode
+		want  string
+	}{
+		{
+			name:  "match mode unchanged",
+			query: `+"exact phrase" -excluded`,
+			mode:  QueryModeMatch,
+			want:  `+"exact phrase" -excluded`,
+		},
+		{
+			name:  "plain words",
+			query: "solar panels",
+			mode:  QueryModeSyntax,
+			want:  "solar panels",
+		},
+		{
+			name:  "phrase",
+			query: `"solar panels" roof`,
+			mode:  QueryModeSyntax,
+			want:  "solar panels roof",
+		},
+		{
+			name:  "required and excluded terms",
+			query: `+solar -wind panels`,
+			mode:  QueryModeSyntax,
+			want:  "solar panels",
+		},
+		{
+			name:  "excluded phrase",
+			query: `solar -"wind turbine"`,
+			mode:  QueryModeSyntax,
+			want:  "solar",
+		},
+		{
+			name:  "field restrictions",
+			query: `file_type:pdf content:"solar panels" +tags:energy`,
+			mode:  QueryModeSyntax,
+			want:  "pdf solar panels energy",
+		},
+		{
+			name:  "fuzzy and boosted terms",
+			query: `solr~ panels~2 roof^3 tiles^1.5`,
+			mode:  QueryModeSyntax,
+			want:  "solr panels roof tiles",
+		},
+		{
+			name:  "only excluded terms",
+			query: `-wind -"gas turbine"`,
+			mode:  QueryModeSyntax,
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := plainQueryText(tt.query, tt.mode); got != tt.want {
+				t.Errorf("plainQueryText(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
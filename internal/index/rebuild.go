@@ -0,0 +1,270 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	chroma "github.com/OptimusePrime/chroma-go/pkg/api/v2"
+	"github.com/OptimusePrime/chroma-go/pkg/embeddings"
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/parser"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/blevesearch/bleve/v2"
+)
+
+const rebuildBatchSize = 100
+
+// RebuildProgress is called after every batch of chunks written by a rebuild.
+type RebuildProgress func(done, total int)
+
+// rebuildName returns a fresh name for the stores built by a rebuild, so they
+// can be filled next to the ones still in use.
+func rebuildName(name string) string {
+	return fmt.Sprintf("%s-%d", name, time.Now().Unix())
+}
+
+// rebuildTarget is the store filled by a rebuild.
+type rebuildTarget struct {
+	write  func(ctx context.Context, document sqlc.Document, tags []string, chunks []parser.Chunk) error
+	remove func(ctx context.Context, chunkIDs []string) error
+}
+
+// rebuildState holds the version of every chunk a rebuild has written, so that
+// chunks committed, changed or removed while it ran can be replayed.
+type rebuildState map[string]string
+
+func chunkVersion(document sqlc.Document, tags []string, row sqlc.Chunk) string {
+	return fmt.Sprint(document.ID, document.Filepath, document.Filetype, document.CreatedAt.Unix(), tags,
+		row.UpdatedAt.UnixNano(), row.Context, row.Page, row.Ordinal.Int64)
+}
+
+// sync reads all chunks of an index from SQLite and writes the ones which
+// changed since they were last written to the target, in batches of chunks
+// belonging to the same document. Chunks written before which are gone from
+// SQLite are removed from the target.
+func (s rebuildState) sync(ctx context.Context, idx sqlc.Index, progress RebuildProgress, target rebuildTarget) error {
+	queries := sqlc.New(db.MainDB)
+
+	rows, err := queries.ListChunksByIndexID(ctx, idx.ID)
+	if err != nil {
+		return fmt.Errorf("failed listing chunks: %w", err)
+	}
+
+	var (
+		document sqlc.Document
+		tags     []string
+		batch    []parser.Chunk
+		versions []string
+		done     int
+	)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := target.write(ctx, document, tags, batch); err != nil {
+			return err
+		}
+
+		for i, chunk := range batch {
+			s[chunk.ID] = versions[i]
+		}
+
+		done += len(batch)
+		batch = batch[:0]
+		versions = versions[:0]
+		if progress != nil {
+			progress(done, len(rows))
+		}
+
+		return ctx.Err()
+	}
+
+	current := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		current[row.IndexingID] = true
+
+		if row.DocumentID != document.ID || len(batch) == rebuildBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+
+		if row.DocumentID != document.ID {
+			document, err = queries.GetDocument(ctx, row.DocumentID)
+			if err != nil {
+				return fmt.Errorf("failed to find document: %d: %w", row.DocumentID, err)
+			}
+
+			tags, err = queries.GetTagsByDocumentID(ctx, row.DocumentID)
+			if err != nil {
+				return fmt.Errorf("failed to get document tags: %d: %w", row.DocumentID, err)
+			}
+		}
+
+		version := chunkVersion(document, tags, row)
+		if s[row.IndexingID] == version {
+			done++
+			continue
+		}
+
+		batch = append(batch, chunkFromRow(row))
+		versions = append(versions, version)
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	var removed []string
+	for id := range s {
+		if !current[id] {
+			removed = append(removed, id)
+		}
+	}
+
+	for start := 0; start < len(removed); start += rebuildBatchSize {
+		batch := removed[start:min(start+rebuildBatchSize, len(removed))]
+		if err := target.remove(ctx, batch); err != nil {
+			return err
+		}
+
+		for _, id := range batch {
+			delete(s, id)
+		}
+	}
+
+	return nil
+}
+
+// fillAndSwap fills a rebuilt store from SQLite and swaps it in. Chunks
+// committed or removed while it was filled are replayed before the swap, and
+// the ones committed while swapping are replayed once more afterwards. The
+// store is only deleted again if the swap hasn't happened.
+func fillAndSwap(ctx context.Context, idx sqlc.Index, progress RebuildProgress, target rebuildTarget, swap func() error) (swapped bool, err error) {
+	state := make(rebuildState)
+
+	if err = state.sync(ctx, idx, progress, target); err != nil {
+		return false, err
+	}
+	if err = state.sync(ctx, idx, nil, target); err != nil {
+		return false, err
+	}
+
+	if err = swap(); err != nil {
+		return false, err
+	}
+
+	if err = state.sync(context.WithoutCancel(ctx), idx, nil, target); err != nil {
+		return true, fmt.Errorf("failed replaying chunks committed during the rebuild, run index repair: %w", err)
+	}
+
+	return true, nil
+}
+
+// RebuildBleveIndex creates a new Bleve index with the current mapping and the
+// given analyzer, fills it from the chunks stored in SQLite and then swaps it
+// in by updating the index path. The old index keeps serving searches until
+// the swap and is deleted afterwards.
+func RebuildBleveIndex(ctx context.Context, idx sqlc.Index, analyzer string, progress RebuildProgress) error {
+	path := filepath.Join(filepath.Dir(idx.Path), rebuildName(idx.Name)+".bleve")
+
+	index, err := bleve.New(path, newBleveIndexMapping(analyzer))
+	if err != nil {
+		return fmt.Errorf("failed to create Bleve index: %w", err)
+	}
+
+	target := rebuildTarget{
+		write: func(ctx context.Context, document sqlc.Document, tags []string, chunks []parser.Chunk) error {
+			return indexBleveChunks(index, document, tags, chunks...)
+		},
+		remove: func(ctx context.Context, chunkIDs []string) error {
+			batch := index.NewBatch()
+			for _, id := range chunkIDs {
+				batch.Delete(id)
+			}
+			if err := index.Batch(batch); err != nil {
+				return fmt.Errorf("failed to remove chunks from Bleve index: %w", err)
+			}
+
+			return nil
+		},
+	}
+
+	swapped, err := fillAndSwap(ctx, idx, progress, target, func() error {
+		err := sqlc.New(db.MainDB).UpdateIndexPath(ctx, sqlc.UpdateIndexPathParams{
+			Path: path,
+			ID:   idx.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update index path: %w", err)
+		}
+
+		return nil
+	})
+	err = errors.Join(err, index.Close())
+	if !swapped {
+		return errors.Join(err, DeleteBleveIndex(path))
+	}
+
+	return errors.Join(err, DefaultManager.Remove(idx.Name), DeleteBleveIndex(idx.Path))
+}
+
+// RebuildChromaCollection creates a new Chroma collection using the configured
+// embedding model, fills it from the chunks stored in SQLite and then swaps it
+// in by updating the index's collection name. The old collection keeps
+// serving searches until the swap and is deleted afterwards.
+func RebuildChromaCollection(ctx context.Context, idx sqlc.Index, progress RebuildProgress) error {
+	name := rebuildName(idx.Name)
+
+	var collection chroma.Collection
+	err := DefaultManager.withChromaClient(func(client chroma.Client, ef embeddings.EmbeddingFunction) error {
+		var err error
+		collection, err = client.CreateCollection(ctx, name, chroma.WithEmbeddingFunctionCreate(ef))
+		if err != nil {
+			return fmt.Errorf("failed to create chroma collection: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	target := rebuildTarget{
+		write: func(ctx context.Context, document sqlc.Document, tags []string, chunks []parser.Chunk) error {
+			return collection.Upsert(ctx, chromaAddOptions(document, tags, chunks)...)
+		},
+		remove: func(ctx context.Context, chunkIDs []string) error {
+			ids := make([]chroma.DocumentID, len(chunkIDs))
+			for i, id := range chunkIDs {
+				ids[i] = chroma.DocumentID(id)
+			}
+			if err := collection.Delete(ctx, chroma.WithIDsDelete(ids...)); err != nil {
+				return fmt.Errorf("failed to delete chunks from collection: %w", err)
+			}
+
+			return nil
+		},
+	}
+
+	swapped, err := fillAndSwap(ctx, idx, progress, target, func() error {
+		err := sqlc.New(db.MainDB).UpdateIndexCollection(ctx, sqlc.UpdateIndexCollectionParams{
+			Collection: name,
+			ID:         idx.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update index collection: %w", err)
+		}
+
+		return nil
+	})
+	if !swapped {
+		return errors.Join(err, DeleteChromaCollection(context.WithoutCancel(ctx), name))
+	}
+
+	return errors.Join(err, DefaultManager.Remove(idx.Name), DeleteChromaCollection(ctx, idx.Collection))
+}
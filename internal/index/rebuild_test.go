@@ -0,0 +1,142 @@
+package index
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/parser"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+)
+
+// fakeRebuildTarget records the chunks a rebuild writes to it.
+type fakeRebuildTarget struct {
+	chunks map[string]parser.Chunk
+	writes int
+}
+
+func (f *fakeRebuildTarget) target() rebuildTarget {
+	f.chunks = make(map[string]parser.Chunk)
+
+	return rebuildTarget{
+		write: func(ctx context.Context, document sqlc.Document, tags []string, chunks []parser.Chunk) error {
+			for _, chunk := range chunks {
+				f.chunks[chunk.ID] = chunk
+				f.writes++
+			}
+			return nil
+		},
+		remove: func(ctx context.Context, chunkIDs []string) error {
+			for _, id := range chunkIDs {
+				delete(f.chunks, id)
+			}
+			return nil
+		},
+	}
+}
+
+func (f *fakeRebuildTarget) ids() []string {
+	return slices.Sorted(maps.Keys(f.chunks))
+}
+
+func execTestSQL(t *testing.T, query string, args ...any) {
+	t.Helper()
+
+	if _, err := db.MainDB.ExecContext(context.Background(), query, args...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// addTestChunks adds a document with chunks of the given IDs to the index.
+func addTestChunks(t *testing.T, idx sqlc.Index, documentID int64, ids ...string) {
+	t.Helper()
+
+	execTestSQL(t, "INSERT OR IGNORE INTO documents (id, index_id, filePath, fileType, fileSize, fileSha256) VALUES (?, ?, 'a.md', '.md', 1, 'sum')", documentID, idx.ID)
+	for i, id := range ids {
+		execTestSQL(t, "INSERT INTO chunks (document_id, content, context, indexing_id, ordinal) VALUES (?, ?, '', ?, ?)", documentID, "content "+id, id, i)
+	}
+}
+
+func TestRebuildStateSync(t *testing.T) {
+	idx := newTestDB(t, "test")
+	ctx := context.Background()
+
+	addTestChunks(t, idx, 1, "a", "b", "c")
+	addTestChunks(t, idx, 2, "d")
+
+	var fake fakeRebuildTarget
+	target := fake.target()
+	state := make(rebuildState)
+
+	var progress []int
+	err := state.sync(ctx, idx, func(done, total int) {
+		if total != 4 {
+			t.Errorf("total = %d, want 4", total)
+		}
+		progress = append(progress, done)
+	}, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.ids(), []string{"a", "b", "c", "d"}; !slices.Equal(got, want) {
+		t.Fatalf("chunks = %v, want %v", got, want)
+	}
+	// Chunks are written in a batch per document.
+	if !slices.Equal(progress, []int{3, 4}) {
+		t.Errorf("progress = %v, want [3 4]", progress)
+	}
+
+	// Nothing changed, so nothing is written again.
+	fake.writes = 0
+	if err := state.sync(ctx, idx, nil, target); err != nil {
+		t.Fatal(err)
+	}
+	if fake.writes != 0 {
+		t.Errorf("writes = %d, want 0", fake.writes)
+	}
+
+	// Chunks committed, changed and removed since are replayed.
+	execTestSQL(t, "UPDATE chunks SET context = 'new context' WHERE indexing_id = 'b'")
+	execTestSQL(t, "DELETE FROM chunks WHERE indexing_id = 'c'")
+	execTestSQL(t, "DELETE FROM documents WHERE id = 2")
+	addTestChunks(t, idx, 3, "e")
+
+	if err := state.sync(ctx, idx, nil, target); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.ids(), []string{"a", "b", "e"}; !slices.Equal(got, want) {
+		t.Errorf("chunks = %v, want %v", got, want)
+	}
+	if fake.writes != 2 {
+		t.Errorf("writes = %d, want 2", fake.writes)
+	}
+	if fake.chunks["b"].Context != "new context" {
+		t.Errorf("context of b = %q, want the new one", fake.chunks["b"].Context)
+	}
+}
+
+func TestFillAndSwapReplaysChunksCommittedWhileSwapping(t *testing.T) {
+	idx := newTestDB(t, "test")
+
+	addTestChunks(t, idx, 1, "a", "b")
+
+	var fake fakeRebuildTarget
+	swapped, err := fillAndSwap(context.Background(), idx, nil, fake.target(), func() error {
+		// A worker commits a document and another one is removed meanwhile.
+		addTestChunks(t, idx, 2, "c")
+		execTestSQL(t, "DELETE FROM chunks WHERE indexing_id = 'a'")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !swapped {
+		t.Error("swapped = false, want true")
+	}
+
+	if got, want := fake.ids(), []string{"b", "c"}; !slices.Equal(got, want) {
+		t.Errorf("chunks = %v, want %v", got, want)
+	}
+}
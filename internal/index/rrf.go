@@ -2,59 +2,226 @@ package index
 
 import (
 	"context"
-	"path/filepath"
+	"errors"
+	"fmt"
 	"slices"
+	"sync"
 
+	chroma "github.com/OptimusePrime/chroma-go/pkg/api/v2"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/charmbracelet/log"
 	"github.com/spf13/viper"
 )
 
 const RRF_K = 60
 
-func SearchIndex(ctx context.Context, indexName string, query string, topN int) (*SearchResult, error) {
-	//fmt.Println("Hello")
-	chromaResult, err := SearchChromaCollection(ctx, indexName, topN, query)
+// SearchIndex searches a single query with both retrievers, see SearchIndexQueries.
+func SearchIndex(ctx context.Context, indexName string, query string, topN int, filter *SearchFilter, mode QueryMode) (*SearchResult, error) {
+	results, err := SearchIndexQueries(ctx, indexName, []string{query}, topN, filter, mode)
 	if err != nil {
 		return nil, err
 	}
-	//fmt.Println("Hello 2")
 
-	blevePath := filepath.Join(viper.GetString("data_dir"), "bm25", indexName+".bleve")
-	//fmt.Println(blevePath)
-	bm25Result, err := SearchBleveIndex(blevePath, query, topN)
+	return results[0], nil
+}
+
+// SearchBM25 searches a query with the BM25 retriever only.
+func SearchBM25(ctx context.Context, indexName string, query string, topN int, filter *SearchFilter, mode QueryMode) (*SearchResult, error) {
+	bm25Ctx, cancel := withConfigTimeout(ctx, "retrieval.bm25_timeout")
+	defer cancel()
+
+	bm25Result, err := SearchBleveIndex(bm25Ctx, indexName, query, topN, filter, mode)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("BM25 search failed: %w", err)
+	}
+
+	return bleveResultToSearchResult(bm25Result), nil
+}
+
+// SearchVector searches a query with the vector retriever only.
+func SearchVector(ctx context.Context, indexName string, query string, topN int, filter *SearchFilter, mode QueryMode) (*SearchResult, error) {
+	vectorCtx, cancel := withConfigTimeout(ctx, "retrieval.vector_timeout")
+	defer cancel()
+
+	chromaResult, err := SearchChromaCollection(vectorCtx, indexName, topN, filter, plainQueryText(query, mode))
+	if err != nil {
+		return nil, fmt.Errorf("vector search failed: %w", err)
+	}
+
+	return chromaResultGroup(chromaResult, 0), nil
+}
+
+// SearchIndexQueries runs the vector and BM25 retrievers concurrently, each
+// with its own timeout. All queries are embedded and searched in a single
+// Chroma request, while every query gets its own concurrent Bleve search.
+// The results of each query are fused separately and returned in order.
+// In syntax mode, Chroma is queried with the query syntax stripped.
+//
+// If one of the retrievers fails for a query, the results of the other one are
+// returned and flagged as degraded. A query both retrievers failed for gets an
+// empty degraded result. An error is only returned when both fail for every
+// query.
+func SearchIndexQueries(ctx context.Context, indexName string, queries []string, topN int, filter *SearchFilter, mode QueryMode) ([]*SearchResult, error) {
+	if len(queries) == 0 {
+		return nil, nil
+	}
+
+	var (
+		wg          sync.WaitGroup
+		chromaErr   error
+		chromaGroup []*SearchResult
+		bm25Errs    = make([]error, len(queries))
+		bm25Groups  = make([]*SearchResult, len(queries))
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		vectorCtx, cancel := withConfigTimeout(ctx, "retrieval.vector_timeout")
+		defer cancel()
+
+		vectorQueries := make([]string, len(queries))
+		for i, query := range queries {
+			vectorQueries[i] = plainQueryText(query, mode)
+		}
+
+		chromaResult, err := SearchChromaCollection(vectorCtx, indexName, topN, filter, vectorQueries...)
+		if err != nil {
+			chromaErr = fmt.Errorf("vector search failed: %w", err)
+			return
+		}
+
+		for i := range queries {
+			chromaGroup = append(chromaGroup, chromaResultGroup(chromaResult, i))
+		}
+	}()
+
+	for i, query := range queries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			bm25Ctx, cancel := withConfigTimeout(ctx, "retrieval.bm25_timeout")
+			defer cancel()
+
+			bm25Result, err := SearchBleveIndex(bm25Ctx, indexName, query, topN, filter, mode)
+			if err != nil {
+				bm25Errs[i] = fmt.Errorf("BM25 search failed: %w", err)
+				return
+			}
+
+			bm25Groups[i] = bleveResultToSearchResult(bm25Result)
+		}()
+	}
+
+	wg.Wait()
+
+	return fuseQueryResults(chromaGroup, chromaErr, bm25Groups, bm25Errs)
+}
+
+// fuseQueryResults fuses the vector and BM25 results of every query, falling
+// back to the retriever which didn't fail, see SearchIndexQueries. The vector
+// search covers all queries at once, so it either failed for all or none.
+func fuseQueryResults(chromaGroup []*SearchResult, chromaErr error, bm25Groups []*SearchResult, bm25Errs []error) ([]*SearchResult, error) {
+	if chromaErr != nil && !slices.Contains(bm25Errs, nil) {
+		return nil, errors.Join(chromaErr, errors.Join(bm25Errs...))
+	}
+
+	results := make([]*SearchResult, len(bm25Groups))
+	for i := range bm25Groups {
+		switch {
+		case chromaErr != nil && bm25Errs[i] != nil:
+			results[i] = degradedResult(new(SearchResult), errors.Join(chromaErr, bm25Errs[i]))
+		case chromaErr != nil:
+			results[i] = degradedResult(bm25Groups[i], chromaErr)
+		case bm25Errs[i] != nil:
+			results[i] = degradedResult(chromaGroup[i], bm25Errs[i])
+		default:
+			results[i] = rrf(chromaGroup[i], bm25Groups[i])
+		}
+	}
+
+	return results, nil
+}
+
+// withConfigTimeout applies the timeout configured under key, if any.
+func withConfigTimeout(ctx context.Context, key string) (context.Context, context.CancelFunc) {
+	timeout := viper.GetDuration(key)
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
 	}
 
-	chromaGroup := chromaResult.GetDocumentsGroups()[0]
-	//fmt.Println(chromaGroup[0].ContentString())
+	return context.WithTimeout(ctx, timeout)
+}
+
+func degradedResult(result *SearchResult, cause error) *SearchResult {
+	log.Warnf("returning degraded search results: %s", cause.Error())
+
+	result.Degraded = true
+	result.DegradedReason = cause.Error()
 
-	chromaSearchResult := new(SearchResult)
-	bm25SearchResult := new(SearchResult)
-	//fmt.Println(bm25Result.Hits[0].Fields["Content"])
+	return result
+}
+
+// chromaResultGroup converts the results of the query at position group. The
+// Chroma client flattens the documents of all queries into a single list, so
+// they are located using the lengths of the ID groups.
+func chromaResultGroup(chromaResult chroma.QueryResult, group int) *SearchResult {
+	idGroups := chromaResult.GetIDGroups()
+	docGroups := chromaResult.GetDocumentsGroups()
+	metadataGroups := chromaResult.GetMetadatasGroups()
+
+	searchResult := new(SearchResult)
+	if group >= len(idGroups) || len(docGroups) == 0 {
+		return searchResult
+	}
 
-	for i, doc := range chromaGroup {
-		chromaSearchResult.Documents = append(chromaSearchResult.Documents, SearchDocument{
-			Rank: i + 1,
-			Document: Document{
-				Content: doc.ContentString(),
-			},
+	ids := idGroups[group]
+	docs := docGroups[0]
+	offset := 0
+
+	if len(docGroups) == len(idGroups) {
+		docs = docGroups[group]
+	} else {
+		for _, groupIDs := range idGroups[:group] {
+			offset += len(groupIDs)
+		}
+	}
+
+	for i, id := range ids {
+		if offset+i >= len(docs) {
+			break
+		}
+
+		document := Document{
+			ID:      string(id),
+			Content: docs[offset+i].ContentString(),
+		}
+		if group < len(metadataGroups) && i < len(metadataGroups[group]) {
+			chromaMetadataToDocument(&document, metadataGroups[group][i])
+		}
+
+		searchResult.Documents = append(searchResult.Documents, SearchDocument{
+			Rank:     i + 1,
+			Document: document,
 		})
 	}
 
+	return searchResult
+}
+
+func bleveResultToSearchResult(bm25Result *bleve.SearchResult) *SearchResult {
+	searchResult := new(SearchResult)
+
 	for i, hit := range bm25Result.Hits {
-		bm25SearchResult.Documents = append(bm25SearchResult.Documents, SearchDocument{
-			Rank: i + 1,
-			Document: Document{
-				ID: hit.ID,
-				//Title:   hit.Fields["title"].(string),
-				Content: hit.Fields["Content"].(string),
-			},
+		searchResult.Documents = append(searchResult.Documents, SearchDocument{
+			Rank:     i + 1,
+			Document: bleveHitToDocument(hit),
 		})
 	}
 
-	finalResult := rrf(chromaSearchResult, bm25SearchResult)
-
-	return finalResult, nil
+	return searchResult
 }
 
 func rrf(chromaResult *SearchResult, bm25Result *SearchResult) *SearchResult {
@@ -62,25 +229,39 @@ func rrf(chromaResult *SearchResult, bm25Result *SearchResult) *SearchResult {
 	finalScores := make(map[string]float64)
 
 	for i, doc := range chromaResult.Documents {
-		finalScores[doc.SHA256()] += 1.0 / (RRF_K + float64(i+1))
+		finalScores[doc.key()] += 1.0 / (RRF_K + float64(i+1))
 
-		if !slices.ContainsFunc(finalResult, func(s SearchDocument) bool { return s.SHA256() == doc.SHA256() }) {
+		if !slices.ContainsFunc(finalResult, func(s SearchDocument) bool { return s.key() == doc.key() }) {
 			finalResult = append(finalResult, doc)
 		}
 	}
 
 	for i, doc := range bm25Result.Documents {
-		finalScores[doc.SHA256()] += 1.0 / (RRF_K + float64(i+1))
+		finalScores[doc.key()] += 1.0 / (RRF_K + float64(i+1))
 
-		if !slices.ContainsFunc(finalResult, func(s SearchDocument) bool { return s.SHA256() == doc.SHA256() }) {
+		existing := slices.IndexFunc(finalResult, func(s SearchDocument) bool { return s.key() == doc.key() })
+		if existing < 0 {
 			finalResult = append(finalResult, doc)
+			continue
+		}
+
+		// Chunks indexed before Chroma metadata was written carry only the
+		// chunk text, so take the metadata stored in Bleve.
+		if finalResult[existing].DocumentID == 0 {
+			finalResult[existing].DocumentID = doc.DocumentID
+			finalResult[existing].FileName = doc.FileName
+			finalResult[existing].FileType = doc.FileType
+			finalResult[existing].Page = doc.Page
 		}
+		finalResult[existing].Context = doc.Context
+		finalResult[existing].Tags = doc.Tags
+		finalResult[existing].locations = doc.locations
 	}
 
 	slices.SortFunc(finalResult, func(a, b SearchDocument) int {
-		if finalScores[a.SHA256()] > finalScores[b.SHA256()] {
+		if finalScores[a.key()] > finalScores[b.key()] {
 			return -1
-		} else if finalScores[a.SHA256()] < finalScores[b.SHA256()] {
+		} else if finalScores[a.key()] < finalScores[b.key()] {
 			return 1
 		} else {
 			return 0
@@ -0,0 +1,233 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	chroma "github.com/OptimusePrime/chroma-go/pkg/api/v2"
+	"github.com/spf13/viper"
+)
+
+func chromaDocuments(contents ...string) chroma.Documents {
+	documents := make(chroma.Documents, len(contents))
+	for i, content := range contents {
+		documents[i] = chroma.NewTextDocument(content)
+	}
+
+	return documents
+}
+
+func TestChromaResultGroup(t *testing.T) {
+	metadata := chroma.NewDocumentMetadata(chroma.NewIntAttribute("document_id", 7), chroma.NewStringAttribute("file_name", "a.pdf"))
+
+	tests := []struct {
+		name   string
+		result chroma.QueryResultImpl
+		group  int
+		ids    []string
+		// contents are the contents of the documents, in order.
+		contents []string
+		fileName string
+	}{
+		{
+			name: "documents grouped per query",
+			result: chroma.QueryResultImpl{
+				IDLists:        []chroma.DocumentIDs{{"a", "b"}, {"c"}},
+				DocumentsLists: []chroma.Documents{chromaDocuments("A", "B"), chromaDocuments("C")},
+			},
+			group:    1,
+			ids:      []string{"c"},
+			contents: []string{"C"},
+		},
+		{
+			name: "documents flattened into one list",
+			result: chroma.QueryResultImpl{
+				IDLists:        []chroma.DocumentIDs{{"a", "b"}, {"c", "d"}, {"e"}},
+				DocumentsLists: []chroma.Documents{chromaDocuments("A", "B", "C", "D", "E")},
+			},
+			group:    1,
+			ids:      []string{"c", "d"},
+			contents: []string{"C", "D"},
+		},
+		{
+			name: "metadata of the group",
+			result: chroma.QueryResultImpl{
+				IDLists:        []chroma.DocumentIDs{{"a"}, {"b"}},
+				DocumentsLists: []chroma.Documents{chromaDocuments("A"), chromaDocuments("B")},
+				MetadatasLists: []chroma.DocumentMetadatas{{nil}, {metadata}},
+			},
+			group:    1,
+			ids:      []string{"b"},
+			contents: []string{"B"},
+			fileName: "a.pdf",
+		},
+		{
+			name: "group without results",
+			result: chroma.QueryResultImpl{
+				IDLists:        []chroma.DocumentIDs{{"a"}},
+				DocumentsLists: []chroma.Documents{chromaDocuments("A")},
+			},
+			group: 1,
+		},
+		{
+			name: "fewer documents than IDs",
+			result: chroma.QueryResultImpl{
+				IDLists:        []chroma.DocumentIDs{{"a", "b"}},
+				DocumentsLists: []chroma.Documents{chromaDocuments("A")},
+			},
+			ids:      []string{"a"},
+			contents: []string{"A"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := chromaResultGroup(&tt.result, tt.group)
+
+			var ids, contents []string
+			for i, doc := range result.Documents {
+				ids = append(ids, doc.ID)
+				contents = append(contents, doc.Content)
+				if doc.Rank != i+1 {
+					t.Errorf("rank of %s = %d, want %d", doc.ID, doc.Rank, i+1)
+				}
+			}
+
+			if !slices.Equal(ids, tt.ids) {
+				t.Errorf("ids = %v, want %v", ids, tt.ids)
+			}
+			if !slices.Equal(contents, tt.contents) {
+				t.Errorf("contents = %v, want %v", contents, tt.contents)
+			}
+			if tt.fileName != "" && result.Documents[0].FileName != tt.fileName {
+				t.Errorf("FileName = %q, want %q", result.Documents[0].FileName, tt.fileName)
+			}
+		})
+	}
+}
+
+func TestWithConfigTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		deadline bool
+	}{
+		{name: "not configured"},
+		{name: "negative", timeout: -time.Second},
+		{name: "configured", timeout: time.Minute, deadline: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("retrieval.test_timeout", tt.timeout)
+			t.Cleanup(func() { viper.Set("retrieval.test_timeout", nil) })
+
+			ctx, cancel := withConfigTimeout(context.Background(), "retrieval.test_timeout")
+			defer cancel()
+
+			deadline, ok := ctx.Deadline()
+			if ok != tt.deadline {
+				t.Fatalf("has deadline = %v, want %v", ok, tt.deadline)
+			}
+			if ok && time.Until(deadline) > tt.timeout {
+				t.Errorf("deadline in %s, want at most %s", time.Until(deadline), tt.timeout)
+			}
+		})
+	}
+}
+
+func TestFuseQueryResults(t *testing.T) {
+	errSearch := errors.New("search failed")
+
+	tests := []struct {
+		name      string
+		chromaErr error
+		bm25Errs  []error
+		// want are the IDs of every query's result, degraded the queries whose
+		// result is degraded.
+		want     [][]string
+		degraded []bool
+		err      bool
+	}{
+		{
+			name:     "both retrievers",
+			bm25Errs: []error{nil, nil},
+			want:     [][]string{{"v1", "b1"}, {"v2", "b2"}},
+			degraded: []bool{false, false},
+		},
+		{
+			name:      "vector search failed",
+			chromaErr: errSearch,
+			bm25Errs:  []error{nil, nil},
+			want:      [][]string{{"b1"}, {"b2"}},
+			degraded:  []bool{true, true},
+		},
+		{
+			name:     "BM25 failed for one query",
+			bm25Errs: []error{nil, errSearch},
+			want:     [][]string{{"v1", "b1"}, {"v2"}},
+			degraded: []bool{false, true},
+		},
+		{
+			name:      "both failed for one query",
+			chromaErr: errSearch,
+			bm25Errs:  []error{errSearch, nil},
+			want:      [][]string{nil, {"b2"}},
+			degraded:  []bool{true, true},
+		},
+		{
+			name:      "both failed for every query",
+			chromaErr: errSearch,
+			bm25Errs:  []error{errSearch, errSearch},
+			err:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var chromaGroup, bm25Groups []*SearchResult
+			for i := range tt.bm25Errs {
+				n := strconv.Itoa(i + 1)
+				if tt.chromaErr == nil {
+					chromaGroup = append(chromaGroup, rankedResult("test", "v"+n))
+				}
+				if tt.bm25Errs[i] == nil {
+					bm25Groups = append(bm25Groups, rankedResult("test", "b"+n))
+				} else {
+					bm25Groups = append(bm25Groups, nil)
+				}
+			}
+
+			results, err := fuseQueryResults(chromaGroup, tt.chromaErr, bm25Groups, tt.bm25Errs)
+			if tt.err {
+				if err == nil {
+					t.Error("fuseQueryResults() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, result := range results {
+				var ids []string
+				for _, doc := range result.Documents {
+					ids = append(ids, doc.ID)
+				}
+				slices.Sort(ids)
+				slices.Sort(tt.want[i])
+
+				if !slices.Equal(ids, tt.want[i]) {
+					t.Errorf("result %d = %v, want %v", i, ids, tt.want[i])
+				}
+				if result.Degraded != tt.degraded[i] {
+					t.Errorf("result %d degraded = %v, want %v", i, result.Degraded, tt.degraded[i])
+				}
+			}
+		})
+	}
+}
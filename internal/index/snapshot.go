@@ -0,0 +1,602 @@
+package index
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	chroma "github.com/OptimusePrime/chroma-go/pkg/api/v2"
+	"github.com/OptimusePrime/chroma-go/pkg/embeddings"
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/parser"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/viper"
+)
+
+const (
+	snapshotVersion       = 1
+	snapshotManifestFile  = "manifest.json"
+	snapshotDocumentsFile = "documents.jsonl"
+	snapshotBleveDir      = "bm25"
+)
+
+// snapshotManifest describes the contents of an index snapshot archive.
+type snapshotManifest struct {
+	Version     int       `json:"version"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	ExportedAt  time.Time `json:"exported_at"`
+	Documents   int       `json:"documents"`
+	Chunks      int       `json:"chunks"`
+	// EmbeddingModel is only set when the archive holds embeddings.
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+	BM25Analyzer   string `json:"bm25_analyzer,omitempty"`
+}
+
+// snapshotDocument is one line of documents.jsonl. The document ID is kept so
+// that the archived Bleve index, which stores it, can be reused on import.
+type snapshotDocument struct {
+	ID         int64           `json:"id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	FilePath   string          `json:"file_path"`
+	FileType   string          `json:"file_type"`
+	FileSize   int64           `json:"file_size"`
+	FileSHA256 string          `json:"file_sha256"`
+	Tags       []string        `json:"tags,omitempty"`
+	Chunks     []snapshotChunk `json:"chunks"`
+}
+
+type snapshotChunk struct {
+	IndexingID  string    `json:"indexing_id"`
+	Content     string    `json:"content"`
+	Context     string    `json:"context"`
+	Page        int64     `json:"page"`
+	Ordinal     *int64    `json:"ordinal,omitempty"`
+	StartOffset *int64    `json:"start_offset,omitempty"`
+	EndOffset   *int64    `json:"end_offset,omitempty"`
+	TableSHA256 string    `json:"table_sha256,omitempty"`
+	Embedding   []float32 `json:"embedding,omitempty"`
+}
+
+func (c snapshotChunk) chunk() parser.Chunk {
+	return parser.Chunk{
+		ID:          c.IndexingID,
+		Content:     c.Content,
+		Context:     c.Context,
+		Page:        int(c.Page),
+		Ordinal:     int(ptrNullInt64(c.Ordinal).Int64),
+		TableSHA256: c.TableSHA256,
+	}
+}
+
+func nullInt64Ptr(n sql.NullInt64) *int64 {
+	if !n.Valid {
+		return nil
+	}
+
+	return &n.Int64
+}
+
+func ptrNullInt64(n *int64) sql.NullInt64 {
+	if n == nil {
+		return sql.NullInt64{}
+	}
+
+	return sql.NullInt64{Int64: *n, Valid: true}
+}
+
+// ExportIndex writes a zstd-compressed tar snapshot of an index to w. It holds
+// the index metadata, its documents with their tags and chunks, a copy of the
+// Bleve index and, with withEmbeddings set, the embeddings from Chroma.
+func ExportIndex(ctx context.Context, idx sqlc.Index, w io.Writer, withEmbeddings bool) error {
+	dir, err := os.MkdirTemp(viper.GetString("data_dir"), "export-*")
+	if err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	manifest := snapshotManifest{
+		Version:     snapshotVersion,
+		Name:        idx.Name,
+		Description: idx.Description.String,
+		ExportedAt:  time.Now(),
+	}
+
+	err = DefaultManager.withBleve(ctx, idx.Name, func(index bleve.Index) error {
+		copyable, ok := index.(bleve.IndexCopyable)
+		if !ok {
+			return errors.New("Bleve index does not support copying")
+		}
+
+		if indexMapping, ok := index.Mapping().(*mapping.IndexMappingImpl); ok {
+			manifest.BM25Analyzer = indexMapping.DefaultAnalyzer
+		}
+
+		bleveDir := filepath.Join(dir, snapshotBleveDir)
+		if err := os.MkdirAll(bleveDir, 0o755); err != nil {
+			return err
+		}
+
+		return copyable.CopyTo(bleve.FileSystemDirectory(bleveDir))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy Bleve index: %w", err)
+	}
+
+	var collection chroma.Collection
+	if withEmbeddings {
+		collection, err = DefaultManager.Collection(ctx, idx.Name)
+		if err != nil {
+			return err
+		}
+		manifest.EmbeddingModel = viper.GetString("embedding_service.model")
+	}
+
+	err = exportDocuments(ctx, idx, filepath.Join(dir, snapshotDocumentsFile), collection, &manifest)
+	if err != nil {
+		return err
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filepath.Join(dir, snapshotManifestFile), manifestData, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return writeArchive(w, dir)
+}
+
+func exportDocuments(ctx context.Context, idx sqlc.Index, path string, collection chroma.Collection, manifest *snapshotManifest) error {
+	queries := sqlc.New(db.MainDB)
+
+	documents, err := queries.ListDocumentsByIndexID(ctx, idx.ID)
+	if err != nil {
+		return fmt.Errorf("failed listing documents: %w", err)
+	}
+
+	rows, err := queries.ListChunksByIndexID(ctx, idx.ID)
+	if err != nil {
+		return fmt.Errorf("failed listing chunks: %w", err)
+	}
+	chunksByDocument := groupChunksByDocument(rows)
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create documents file: %w", err)
+	}
+	defer file.Close()
+
+	buf := bufio.NewWriter(file)
+	encoder := json.NewEncoder(buf)
+
+	for _, document := range documents {
+		tags, err := queries.GetTagsByDocumentID(ctx, document.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get document tags: %d: %w", document.ID, err)
+		}
+
+		snapshot := snapshotDocument{
+			ID:         document.ID,
+			CreatedAt:  document.CreatedAt,
+			FilePath:   document.Filepath,
+			FileType:   document.Filetype,
+			FileSize:   document.Filesize,
+			FileSHA256: document.Filesha256,
+			Tags:       tags,
+		}
+
+		for _, row := range chunksByDocument[document.ID] {
+			snapshot.Chunks = append(snapshot.Chunks, snapshotChunk{
+				IndexingID:  row.IndexingID,
+				Content:     row.Content,
+				Context:     row.Context,
+				Page:        row.Page,
+				Ordinal:     nullInt64Ptr(row.Ordinal),
+				StartOffset: nullInt64Ptr(row.StartOffset),
+				EndOffset:   nullInt64Ptr(row.EndOffset),
+				TableSHA256: row.TableSha256.String,
+			})
+		}
+
+		if collection != nil {
+			if err := fetchEmbeddings(ctx, collection, snapshot.Chunks); err != nil {
+				return err
+			}
+		}
+
+		if err := encoder.Encode(snapshot); err != nil {
+			return err
+		}
+
+		manifest.Documents++
+		manifest.Chunks += len(snapshot.Chunks)
+	}
+
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+func fetchEmbeddings(ctx context.Context, collection chroma.Collection, chunks []snapshotChunk) error {
+	for start := 0; start < len(chunks); start += rebuildBatchSize {
+		batch := chunks[start:min(start+rebuildBatchSize, len(chunks))]
+
+		ids := make([]chroma.DocumentID, len(batch))
+		for i, chunk := range batch {
+			ids[i] = chroma.DocumentID(chunk.IndexingID)
+		}
+
+		result, err := collection.Get(ctx, chroma.WithIDsGet(ids...), chroma.WithIncludeGet(chroma.IncludeEmbeddings))
+		if err != nil {
+			return fmt.Errorf("failed to get embeddings from Chroma: %w", err)
+		}
+
+		resultEmbeddings := result.GetEmbeddings()
+		byID := make(map[string][]float32, len(resultEmbeddings))
+		for i, id := range result.GetIDs() {
+			if i < len(resultEmbeddings) {
+				byID[string(id)] = resultEmbeddings[i].ContentAsFloat32()
+			}
+		}
+
+		for i := range batch {
+			batch[i].Embedding = byID[batch[i].IndexingID]
+		}
+	}
+
+	return nil
+}
+
+type ImportOptions struct {
+	// Name overrides the index name stored in the snapshot.
+	Name string
+	// Reembed embeds all chunks again even if the snapshot holds embeddings
+	// made with the configured embedding model.
+	Reembed  bool
+	Progress RebuildProgress
+}
+
+// ImportIndex restores a snapshot written by ExportIndex as a new index.
+// Stored embeddings are used only when they were made with the configured
+// embedding model. The archived Bleve index is used as-is when the original
+// document IDs are still free, otherwise it is rebuilt from the chunks.
+func ImportIndex(ctx context.Context, r io.Reader, opts ImportOptions) (sqlc.Index, error) {
+	dir, err := os.MkdirTemp(viper.GetString("data_dir"), "import-*")
+	if err != nil {
+		return sqlc.Index{}, fmt.Errorf("failed to create import directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err = extractArchive(r, dir); err != nil {
+		return sqlc.Index{}, err
+	}
+
+	var manifest snapshotManifest
+	manifestData, err := os.ReadFile(filepath.Join(dir, snapshotManifestFile))
+	if err != nil {
+		return sqlc.Index{}, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if err = json.Unmarshal(manifestData, &manifest); err != nil {
+		return sqlc.Index{}, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if manifest.Version != snapshotVersion {
+		return sqlc.Index{}, fmt.Errorf("unsupported snapshot version: %d", manifest.Version)
+	}
+
+	name := manifest.Name
+	if opts.Name != "" {
+		name = opts.Name
+	}
+
+	queries := sqlc.New(db.MainDB)
+
+	keepIDs := true
+	err = forEachSnapshotDocument(dir, func(document snapshotDocument) error {
+		_, err := queries.GetDocument(ctx, document.ID)
+		if err == nil {
+			keepIDs = false
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return sqlc.Index{}, err
+	}
+
+	_, err = os.Stat(filepath.Join(dir, snapshotBleveDir))
+	reuseBleve := keepIDs && err == nil
+
+	useEmbeddings := !opts.Reembed && manifest.EmbeddingModel != "" &&
+		manifest.EmbeddingModel == viper.GetString("embedding_service.model")
+
+	path := filepath.Join(viper.GetString("data_dir"), "bm25", fmt.Sprintf("%s.bleve", name))
+	if _, err = os.Stat(path); err == nil {
+		return sqlc.Index{}, fmt.Errorf("BM25 index already exists: %s", path)
+	}
+
+	tx, err := db.MainDB.BeginTx(ctx, nil)
+	if err != nil {
+		return sqlc.Index{}, err
+	}
+	defer tx.Rollback()
+
+	idx, err := queries.WithTx(tx).CreateIndex(ctx, sqlc.CreateIndexParams{
+		Name: name,
+		Description: sql.NullString{
+			String: manifest.Description,
+			Valid:  manifest.Description != "",
+		},
+		Path:       path,
+		Collection: name,
+	})
+	if err != nil {
+		return sqlc.Index{}, fmt.Errorf("failed creating index entry in DB: %w", err)
+	}
+
+	err = importStores(ctx, tx, idx, dir, manifest, importPlan{
+		keepIDs:       keepIDs,
+		reuseBleve:    reuseBleve,
+		useEmbeddings: useEmbeddings,
+		progress:      opts.Progress,
+	})
+	if err != nil {
+		return sqlc.Index{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return sqlc.Index{}, errors.Join(err, DeleteBleveIndex(path), DeleteChromaCollection(ctx, idx.Collection))
+	}
+
+	return idx, nil
+}
+
+type importPlan struct {
+	keepIDs       bool
+	reuseBleve    bool
+	useEmbeddings bool
+	progress      RebuildProgress
+}
+
+// importStores writes the documents of a snapshot to SQLite within tx and to
+// the index's Bleve index and Chroma collection. Both stores are deleted again
+// if anything fails.
+func importStores(ctx context.Context, tx *sql.Tx, idx sqlc.Index, dir string, manifest snapshotManifest, plan importPlan) (err error) {
+	var index bleve.Index
+	if plan.reuseBleve {
+		if err = os.MkdirAll(filepath.Dir(idx.Path), 0o755); err != nil {
+			return err
+		}
+		if err = os.Rename(filepath.Join(dir, snapshotBleveDir), idx.Path); err != nil {
+			return fmt.Errorf("failed to move Bleve index: %w", err)
+		}
+	} else {
+		analyzer := manifest.BM25Analyzer
+		if analyzer == "" {
+			analyzer = "en"
+		}
+
+		index, err = bleve.New(idx.Path, newBleveIndexMapping(analyzer))
+		if err != nil {
+			return fmt.Errorf("failed to create Bleve index: %w", err)
+		}
+	}
+	defer func() {
+		if index != nil {
+			err = errors.Join(err, index.Close())
+		}
+		if err != nil {
+			err = errors.Join(err, DeleteBleveIndex(idx.Path))
+		}
+	}()
+
+	var collection chroma.Collection
+	err = DefaultManager.withChromaClient(func(client chroma.Client, ef embeddings.EmbeddingFunction) error {
+		var err error
+		collection, err = client.CreateCollection(ctx, idx.Collection, chroma.WithEmbeddingFunctionCreate(ef))
+		if err != nil {
+			return fmt.Errorf("failed to create chroma collection: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, DeleteChromaCollection(context.WithoutCancel(ctx), idx.Collection))
+		}
+	}()
+
+	queries := sqlc.New(db.MainDB).WithTx(tx)
+	done := 0
+
+	return forEachSnapshotDocument(dir, func(snapshot snapshotDocument) error {
+		document, err := queries.ImportDocument(ctx, sqlc.ImportDocumentParams{
+			ID:         sql.NullInt64{Int64: snapshot.ID, Valid: plan.keepIDs},
+			CreatedAt:  snapshot.CreatedAt,
+			IndexID:    idx.ID,
+			Filepath:   snapshot.FilePath,
+			Filetype:   snapshot.FileType,
+			Filesize:   snapshot.FileSize,
+			Filesha256: snapshot.FileSHA256,
+		})
+		if err != nil {
+			return fmt.Errorf("failed creating document in database: %s: %w", snapshot.FilePath, err)
+		}
+
+		for _, tag := range snapshot.Tags {
+			err = queries.AddDocumentTag(ctx, sqlc.AddDocumentTagParams{
+				DocumentID: document.ID,
+				Tag:        tag,
+			})
+			if err != nil {
+				return fmt.Errorf("failed adding tag to document: %s: %w", snapshot.FilePath, err)
+			}
+		}
+
+		chunks := make([]parser.Chunk, len(snapshot.Chunks))
+		for i, c := range snapshot.Chunks {
+			_, err = queries.CreateChunk(ctx, sqlc.CreateChunkParams{
+				DocumentID:  document.ID,
+				StartOffset: ptrNullInt64(c.StartOffset),
+				EndOffset:   ptrNullInt64(c.EndOffset),
+				Content:     c.Content,
+				Context:     c.Context,
+				IndexingID:  c.IndexingID,
+				Page:        c.Page,
+				Ordinal:     ptrNullInt64(c.Ordinal),
+				TableSha256: sql.NullString{String: c.TableSHA256, Valid: c.TableSHA256 != ""},
+			})
+			if err != nil {
+				return fmt.Errorf("failed creating chunk in database: %s: %w", snapshot.FilePath, err)
+			}
+			chunks[i] = c.chunk()
+		}
+
+		if index != nil {
+			if err = indexBleveChunks(index, document, snapshot.Tags, chunks...); err != nil {
+				return err
+			}
+		}
+
+		for start := 0; start < len(chunks); start += rebuildBatchSize {
+			end := min(start+rebuildBatchSize, len(chunks))
+
+			addOptions := chromaAddOptions(document, snapshot.Tags, chunks[start:end])
+			if plan.useEmbeddings {
+				chunkEmbeddings := make([]embeddings.Embedding, 0, end-start)
+				for _, c := range snapshot.Chunks[start:end] {
+					if len(c.Embedding) == 0 {
+						break
+					}
+					chunkEmbeddings = append(chunkEmbeddings, embeddings.NewEmbeddingFromFloat32(c.Embedding))
+				}
+
+				if len(chunkEmbeddings) == end-start {
+					addOptions = append(addOptions, chroma.WithEmbeddings(chunkEmbeddings...))
+				}
+			}
+
+			if err = collection.Add(ctx, addOptions...); err != nil {
+				return fmt.Errorf("failed adding chunks to Chroma collection: %w", err)
+			}
+
+			done += end - start
+			if plan.progress != nil {
+				plan.progress(done, manifest.Chunks)
+			}
+		}
+
+		return ctx.Err()
+	})
+}
+
+func forEachSnapshotDocument(dir string, fn func(document snapshotDocument) error) error {
+	file, err := os.Open(filepath.Join(dir, snapshotDocumentsFile))
+	if err != nil {
+		return fmt.Errorf("failed to open documents file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for {
+		var document snapshotDocument
+		err := decoder.Decode(&document)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse documents file: %w", err)
+		}
+
+		if err = fn(document); err != nil {
+			return err
+		}
+	}
+}
+
+func writeArchive(w io.Writer, dir string) error {
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(zw)
+	err = tw.AddFS(os.DirFS(dir))
+	if err != nil {
+		err = fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	return errors.Join(err, tw.Close(), zw.Close())
+}
+
+func extractArchive(r io.Reader, dir string) error {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		if !filepath.IsLocal(header.Name) {
+			return fmt.Errorf("invalid path in archive: %s", header.Name)
+		}
+		path := filepath.Join(dir, header.Name)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err = os.MkdirAll(path, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err = extractFile(tr, path); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported entry in archive: %s", header.Name)
+		}
+	}
+}
+
+func extractFile(r io.Reader, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, r)
+
+	return errors.Join(err, file.Close())
+}
@@ -0,0 +1,290 @@
+package index
+
+import (
+	"archive/tar"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/OptimusePrime/petagpt/internal/parser"
+	"github.com/klauspost/compress/zstd"
+)
+
+func int64Ptr(n int64) *int64 {
+	return &n
+}
+
+func TestNullInt64Ptr(t *testing.T) {
+	tests := []struct {
+		name string
+		null sql.NullInt64
+		ptr  *int64
+	}{
+		{
+			name: "null",
+			null: sql.NullInt64{},
+		},
+		{
+			name: "zero",
+			null: sql.NullInt64{Valid: true},
+			ptr:  int64Ptr(0),
+		},
+		{
+			name: "value",
+			null: sql.NullInt64{Int64: 42, Valid: true},
+			ptr:  int64Ptr(42),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ptr := nullInt64Ptr(tt.null)
+			if (ptr == nil) != (tt.ptr == nil) || ptr != nil && *ptr != *tt.ptr {
+				t.Fatalf("nullInt64Ptr(%v) = %v, want %v", tt.null, ptr, tt.ptr)
+			}
+
+			if null := ptrNullInt64(ptr); null != tt.null {
+				t.Errorf("ptrNullInt64(%v) = %v, want %v", ptr, null, tt.null)
+			}
+		})
+	}
+}
+
+func TestSnapshotChunk(t *testing.T) {
+	tests := []struct {
+		name  string
+		chunk snapshotChunk
+		want  parser.Chunk
+	}{
+		{
+			name: "all fields",
+			chunk: snapshotChunk{
+				IndexingID:  "a",
+				Content:     "content",
+				Context:     "context",
+				Page:        3,
+				Ordinal:     int64Ptr(7),
+				StartOffset: int64Ptr(10),
+				EndOffset:   int64Ptr(20),
+				TableSHA256: "sha",
+				Embedding:   []float32{1, 2},
+			},
+			want: parser.Chunk{
+				ID:          "a",
+				Content:     "content",
+				Context:     "context",
+				Page:        3,
+				Ordinal:     7,
+				TableSHA256: "sha",
+			},
+		},
+		{
+			name: "without ordinal",
+			chunk: snapshotChunk{
+				IndexingID: "b",
+				Content:    "content",
+			},
+			want: parser.Chunk{
+				ID:      "b",
+				Content: "content",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.chunk.chunk(); got != tt.want {
+				t.Errorf("chunk() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	files := map[string]string{
+		snapshotManifestFile:                      `{"version":1}`,
+		snapshotDocumentsFile:                     "",
+		filepath.Join(snapshotBleveDir, "store"):  "bleve",
+		filepath.Join(snapshotBleveDir, "a", "b"): "nested",
+	}
+
+	src := t.TempDir()
+	writeTestFiles(t, src, files)
+
+	var archive bytes.Buffer
+	if err := writeArchive(&archive, src); err != nil {
+		t.Fatalf("writeArchive() error = %v", err)
+	}
+
+	dst := t.TempDir()
+	if err := extractArchive(&archive, dst); err != nil {
+		t.Fatalf("extractArchive() error = %v", err)
+	}
+
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Errorf("failed to read %s: %v", name, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func testArchive(t *testing.T, headers ...tar.Header) *bytes.Buffer {
+	t.Helper()
+
+	var archive bytes.Buffer
+	zw, err := zstd.NewWriter(&archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tw := tar.NewWriter(zw)
+	for _, header := range headers {
+		if err = tw.WriteHeader(&header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = errors.Join(tw.Close(), zw.Close()); err != nil {
+		t.Fatal(err)
+	}
+
+	return &archive
+}
+
+func TestExtractArchiveRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		header tar.Header
+		err    string
+	}{
+		{
+			name:   "parent directory",
+			header: tar.Header{Name: "../escape", Typeflag: tar.TypeReg},
+			err:    "invalid path in archive",
+		},
+		{
+			name:   "absolute path",
+			header: tar.Header{Name: "/tmp/escape", Typeflag: tar.TypeReg},
+			err:    "invalid path in archive",
+		},
+		{
+			name:   "symlink",
+			header: tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+			err:    "unsupported entry in archive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			err := extractArchive(testArchive(t, tt.header), dir)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("extractArchive() error = %v, want %q", err, tt.err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("extractArchive() wrote %d entries", len(entries))
+			}
+		})
+	}
+}
+
+func TestForEachSnapshotDocument(t *testing.T) {
+	documents := []snapshotDocument{
+		{ID: 1, FilePath: "a.pdf", Chunks: []snapshotChunk{{IndexingID: "a"}}},
+		{ID: 2, FilePath: "b.pdf", Tags: []string{"x"}},
+	}
+
+	var lines []string
+	for _, document := range documents {
+		line, err := json.Marshal(document)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, string(line))
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		// stopAt makes the callback fail on the document with this ID.
+		stopAt int64
+		ids    []int64
+		err    bool
+	}{
+		{
+			name:    "all documents",
+			content: strings.Join(lines, "\n") + "\n",
+			ids:     []int64{1, 2},
+		},
+		{
+			name:    "empty file",
+			content: "",
+		},
+		{
+			name:    "malformed line",
+			content: lines[0] + "\n{\n",
+			ids:     []int64{1},
+			err:     true,
+		},
+		{
+			name:    "callback error",
+			content: strings.Join(lines, "\n"),
+			stopAt:  1,
+			ids:     []int64{1},
+			err:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFiles(t, dir, map[string]string{snapshotDocumentsFile: tt.content})
+
+			var ids []int64
+			err := forEachSnapshotDocument(dir, func(document snapshotDocument) error {
+				ids = append(ids, document.ID)
+				if document.ID == tt.stopAt {
+					return errors.New("stop")
+				}
+
+				return nil
+			})
+			if (err != nil) != tt.err {
+				t.Fatalf("forEachSnapshotDocument() error = %v, want error %v", err, tt.err)
+			}
+			if !slices.Equal(ids, tt.ids) {
+				t.Errorf("forEachSnapshotDocument() visited %v, want %v", ids, tt.ids)
+			}
+		})
+	}
+}
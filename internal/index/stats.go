@@ -0,0 +1,238 @@
+package index
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	chroma "github.com/OptimusePrime/chroma-go/pkg/api/v2"
+	"github.com/OptimusePrime/chroma-go/pkg/embeddings"
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/spf13/viper"
+)
+
+type IndexStats struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Documents   int64     `json:"documents"`
+	Chunks      int64     `json:"chunks"`
+	TotalBytes  int64     `json:"total_bytes"`
+
+	BlevePath      string `json:"bleve_path"`
+	BleveDocuments uint64 `json:"bleve_documents"`
+	BleveSize      int64  `json:"bleve_size"`
+
+	Collection         string `json:"collection"`
+	ChromaDocuments    int    `json:"chroma_documents"`
+	EmbeddingModel     string `json:"embedding_model"`
+	EmbeddingDimension int    `json:"embedding_dimension,omitempty"`
+}
+
+// GetIndexStats collects the statistics of an index from SQLite, its Bleve
+// index and its Chroma collection.
+func GetIndexStats(ctx context.Context, idx sqlc.Index) (*IndexStats, error) {
+	counts, err := sqlc.New(db.MainDB).GetIndexStats(ctx, idx.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index statistics: %w", err)
+	}
+
+	stats := &IndexStats{
+		Name:           idx.Name,
+		Description:    idx.Description.String,
+		CreatedAt:      idx.CreatedAt,
+		UpdatedAt:      idx.UpdatedAt,
+		Documents:      counts.DocumentCount,
+		Chunks:         counts.ChunkCount,
+		TotalBytes:     counts.TotalBytes,
+		BlevePath:      idx.Path,
+		Collection:     idx.Collection,
+		EmbeddingModel: viper.GetString("embedding_service.model"),
+	}
+
+	err = DefaultManager.withBleve(ctx, idx.Name, func(index bleve.Index) error {
+		var err error
+		stats.BleveDocuments, err = index.DocCount()
+
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count Bleve documents: %w", err)
+	}
+
+	stats.BleveSize, err = directorySize(idx.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Bleve index size: %w", err)
+	}
+
+	collection, err := DefaultManager.Collection(ctx, idx.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.ChromaDocuments, err = collection.Count(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count Chroma documents: %w", err)
+	}
+	stats.EmbeddingDimension = collection.Dimension()
+
+	return stats, nil
+}
+
+func directorySize(path string) (int64, error) {
+	var size int64
+
+	err := filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+
+		return nil
+	})
+
+	return size, err
+}
+
+// RenameIndex renames an index together with its Bleve directory and Chroma
+// collection. The stores are renamed back if the database can't be updated.
+func RenameIndex(ctx context.Context, idx sqlc.Index, name string) error {
+	_, err := sqlc.New(db.MainDB).GetIndexByName(ctx, name)
+	if err == nil {
+		return fmt.Errorf("an index with that name already exists: %s", name)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to find index: %w", err)
+	}
+
+	path := filepath.Join(filepath.Dir(idx.Path), fmt.Sprintf("%s.bleve", name))
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("BM25 index already exists: %s", path)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to check BM25 index: %w", err)
+	}
+
+	collection, err := DefaultManager.Collection(ctx, idx.Name)
+	if err != nil {
+		return err
+	}
+
+	// A clashing collection is found before anything is moved.
+	if idx.Collection != name {
+		exists, err := chromaCollectionExists(ctx, name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("chroma collection already exists: %s", name)
+		}
+	}
+
+	if err = DefaultManager.Remove(idx.Name); err != nil {
+		return err
+	}
+
+	if err = os.Rename(idx.Path, path); err != nil {
+		return fmt.Errorf("failed to move Bleve index: %w", err)
+	}
+
+	if err = renameChromaCollection(ctx, collection, name); err != nil {
+		return errors.Join(err, os.Rename(path, idx.Path))
+	}
+
+	err = updateIndexName(ctx, idx, name, path)
+	if err != nil {
+		return errors.Join(err, os.Rename(path, idx.Path), renameChromaCollection(ctx, collection, idx.Collection))
+	}
+
+	return nil
+}
+
+// chromaCollectionExists reports whether a Chroma collection has the name.
+func chromaCollectionExists(ctx context.Context, name string) (bool, error) {
+	var exists bool
+
+	err := DefaultManager.withChromaClient(func(client chroma.Client, ef embeddings.EmbeddingFunction) error {
+		for offset := 0; ; offset += listIDsBatchSize {
+			collections, err := client.ListCollections(ctx, chroma.ListWithLimit(listIDsBatchSize), chroma.ListWithOffset(offset))
+			if err != nil {
+				return fmt.Errorf("failed to list Chroma collections: %w", err)
+			}
+
+			for _, collection := range collections {
+				if collection.Name() == name {
+					exists = true
+					return nil
+				}
+			}
+
+			if len(collections) < listIDsBatchSize {
+				return nil
+			}
+		}
+	})
+
+	return exists, err
+}
+
+func renameChromaCollection(ctx context.Context, collection chroma.Collection, name string) error {
+	return DefaultManager.withChromaClient(func(client chroma.Client, ef embeddings.EmbeddingFunction) error {
+		if err := collection.ModifyName(ctx, name); err != nil {
+			return fmt.Errorf("failed to rename Chroma collection: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func updateIndexName(ctx context.Context, idx sqlc.Index, name, path string) error {
+	tx, err := db.MainDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := sqlc.New(db.MainDB).WithTx(tx)
+
+	err = queries.UpdateIndex(ctx, sqlc.UpdateIndexParams{
+		Name:        name,
+		Description: idx.Description,
+		ID:          idx.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rename index: %w", err)
+	}
+
+	err = queries.UpdateIndexPath(ctx, sqlc.UpdateIndexPathParams{
+		Path: path,
+		ID:   idx.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update index path: %w", err)
+	}
+
+	err = queries.UpdateIndexCollection(ctx, sqlc.UpdateIndexCollectionParams{
+		Collection: name,
+		ID:         idx.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update index collection: %w", err)
+	}
+
+	return tx.Commit()
+}
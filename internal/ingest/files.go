@@ -0,0 +1,183 @@
+package ingest
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FileFilter selects the files found in directories by include and exclude
+// globs, matched against the path relative to the directory. Globs without a
+// slash match the file name at any depth, and ** matches any number of
+// directories, e.g. "*.pdf" or "drafts/**".
+type FileFilter struct {
+	Include []string
+	Exclude []string
+}
+
+func (f FileFilter) Validate() error {
+	for _, pattern := range append(append([]string(nil), f.Include...), f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid glob: %s: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// Match reports whether the file with the slash separated relative path is
+// selected.
+func (f FileFilter) Match(name string) bool {
+	if f.excluded(name) {
+		return false
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+
+	for _, pattern := range f.Include {
+		if MatchGlob(pattern, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f FileFilter) excluded(name string) bool {
+	for _, pattern := range f.Exclude {
+		if MatchGlob(pattern, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchGlob matches a slash separated path against a glob, see FileFilter.
+func MatchGlob(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+
+	return matchGlobSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlobSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// CollectFiles returns the absolute paths of the files to ingest from the
+// given paths, the same path documents are matched with by Enqueue however a
+// file was given. Files are taken as they are, while directories are walked if
+// recursive is set and their files selected by the filter. Every file is
+// returned once.
+func CollectFiles(paths []string, recursive bool, filter FileFilter) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+
+	add := func(file string) error {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		if !seen[abs] {
+			seen[abs] = true
+			files = append(files, abs)
+		}
+		return nil
+	}
+
+	for _, root := range paths {
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open document: %s: %w", root, err)
+		}
+
+		if !info.IsDir() {
+			if err := add(root); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if !recursive {
+			return nil, fmt.Errorf("%s is a directory, use --recursive to add the documents in it", root)
+		}
+
+		err = WalkFiles(root, filter, func(file string, _ fs.FileInfo) error {
+			return add(file)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// WalkFiles calls fn for every regular file in the directory selected by the
+// filter, skipping excluded directories altogether.
+func WalkFiles(root string, filter FileFilter, fn func(file string, info fs.FileInfo) error) error {
+	err := filepath.WalkDir(root, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		if entry.IsDir() {
+			if filter.excluded(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !entry.Type().IsRegular() || !filter.Match(rel) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		return fn(file, info)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk directory: %s: %w", root, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package ingest
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*.pdf", "a.pdf", true},
+		{"*.pdf", "docs/2024/a.pdf", true},
+		{"*.pdf", "a.docx", false},
+		{"*.pdf", "a.pdf.bak", false},
+		{"a?.md", "docs/ab.md", true},
+		{"[ab].md", "c.md", false},
+		{"docs/*.pdf", "docs/a.pdf", true},
+		{"docs/*.pdf", "docs/2024/a.pdf", false},
+		{"docs/*.pdf", "other/a.pdf", false},
+		{"drafts/**", "drafts/a.md", true},
+		{"drafts/**", "drafts/2024/q1/a.md", true},
+		{"drafts/**", "drafts", true},
+		{"drafts/**", "final/drafts/a.md", false},
+		{"**/drafts/*.md", "drafts/a.md", true},
+		{"**/drafts/*.md", "a/b/drafts/a.md", true},
+		{"**/drafts/*.md", "a/b/drafts/c/a.md", false},
+		{"docs/**/*.pdf", "docs/a.pdf", true},
+		{"docs/**/*.pdf", "docs/2024/q1/a.pdf", true},
+		{"docs/**/*.pdf", "docs/2024/a.md", false},
+		{"/home/**/*.pdf", "/home/user/a.pdf", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			if got := MatchGlob(tt.pattern, tt.name); got != tt.want {
+				t.Errorf("MatchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,408 @@
+package ingest
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+
+	chroma "github.com/OptimusePrime/chroma-go/pkg/api/v2"
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/index"
+	"github.com/OptimusePrime/petagpt/internal/parser"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/spf13/viper"
+)
+
+// JobStatus is the state of an ingestion job in the queue.
+type JobStatus string
+
+const (
+	JobStatusPending   JobStatus = "pending"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusFailed    JobStatus = "failed"
+	JobStatusCancelled JobStatus = "cancelled"
+	JobStatusCompleted JobStatus = "completed"
+)
+
+// JobStage is the last stage an ingestion job completed. The result of every
+// stage is stored with the job, so a failed or interrupted job resumes after
+// it.
+type JobStage string
+
+const (
+	JobStageQueued         JobStage = "queued"
+	JobStageParsed         JobStage = "parsed"
+	JobStageSegmented      JobStage = "segmented"
+	JobStageContextualised JobStage = "contextualised"
+	JobStageEmbedded       JobStage = "embedded"
+	JobStageCommitted      JobStage = "committed"
+)
+
+type JobParams struct {
+	IndexID      int64
+	FilePath     string
+	Data         []byte
+	Tags         []string
+	ChunkSize    int
+	RequestDelay int
+	// Force processes the file even if the index already has its content,
+	// without reusing the chunks of the document it updates.
+	Force bool
+	// AddOnly never updates a document with the same path, for paths which
+	// don't identify a file, like the names of uploaded files.
+	AddOnly bool
+}
+
+// DuplicateError is returned by Enqueue when the index already has the content
+// of the file, or a job adding it.
+type DuplicateError struct {
+	// Path is the path of the document or job with the same content.
+	Path   string
+	Queued bool
+}
+
+func (e *DuplicateError) Error() string {
+	if e.Queued {
+		return "same content is already queued as " + e.Path
+	}
+	return "same content is already in the index as " + e.Path
+}
+
+// Enqueue adds a job ingesting a document to the queue. A document with the
+// same path is updated in place by the job, unless params.AddOnly is set, only contextualising and
+// embedding the chunks whose content changed. A *DuplicateError is returned
+// if the index already has the content, unless params.Force is set.
+func Enqueue(ctx context.Context, params JobParams) (sqlc.IngestionJob, error) {
+	tags, err := json.Marshal(params.Tags)
+	if err != nil {
+		return sqlc.IngestionJob{}, err
+	}
+
+	checksum := FileSHA256(params.Data)
+
+	queries := sqlc.New(db.MainDB)
+
+	if !params.Force {
+		job, err := queries.GetActiveIngestionJobBySHA256(ctx, sqlc.GetActiveIngestionJobBySHA256Params{
+			IndexID:    params.IndexID,
+			FileSha256: checksum,
+		})
+		if err == nil {
+			return sqlc.IngestionJob{}, &DuplicateError{Path: job.FilePath, Queued: true}
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return sqlc.IngestionJob{}, fmt.Errorf("failed to find ingestion jobs: %w", err)
+		}
+	}
+
+	var documents []sqlc.Document
+	if !params.AddOnly {
+		documents, err = documentsByPath(ctx, queries, params.IndexID, params.FilePath)
+		if err != nil {
+			return sqlc.IngestionJob{}, err
+		}
+	}
+
+	var replaces sql.NullInt64
+	if len(documents) > 0 {
+		// Duplicates from before documents were updated in place are left
+		// alone, the latest one is updated.
+		document := documents[len(documents)-1]
+		if document.Filesha256 == checksum && !params.Force {
+			return sqlc.IngestionJob{}, &DuplicateError{Path: document.Filepath}
+		}
+		replaces = sql.NullInt64{Int64: document.ID, Valid: true}
+	} else if !params.Force {
+		documents, err := queries.ListDocumentsBySHA256(ctx, sqlc.ListDocumentsBySHA256Params{
+			IndexID:    params.IndexID,
+			Filesha256: checksum,
+		})
+		if err != nil {
+			return sqlc.IngestionJob{}, fmt.Errorf("failed to find documents: %w", err)
+		}
+		if len(documents) > 0 {
+			return sqlc.IngestionJob{}, &DuplicateError{Path: documents[0].Filepath}
+		}
+	}
+
+	job, err := queries.CreateIngestionJob(ctx, sqlc.CreateIngestionJobParams{
+		IndexID:            params.IndexID,
+		FilePath:           params.FilePath,
+		FileSize:           int64(len(params.Data)),
+		FileSha256:         checksum,
+		FileData:           params.Data,
+		Tags:               string(tags),
+		ChunkSize:          int64(params.ChunkSize),
+		RequestDelay:       int64(params.RequestDelay),
+		ReplacesDocumentID: replaces,
+		Force:              params.Force,
+	})
+	if err != nil {
+		return sqlc.IngestionJob{}, fmt.Errorf("failed to enqueue ingestion job: %s: %w", params.FilePath, err)
+	}
+
+	return job, nil
+}
+
+// FileSHA256 encodes the checksum of a file like the documents table does.
+func FileSHA256(data []byte) string {
+	checksum := sha256.Sum256(data)
+	return base64.StdEncoding.EncodeToString(checksum[:])
+}
+
+// Retry queues a failed or cancelled job again.
+func Retry(ctx context.Context, id int64) error {
+	queries := sqlc.New(db.MainDB)
+
+	job, err := queries.GetIngestionJob(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to find ingestion job %d: %w", id, err)
+	}
+
+	n, err := queries.RetryIngestionJob(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to retry ingestion job %d: %w", id, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("ingestion job %d is %s, only failed and cancelled jobs can be retried", id, job.Status)
+	}
+
+	return nil
+}
+
+// Cancel cancels a job which isn't completed. What a job already wrote to the
+// stores is removed right away, unless it's running, in which case its worker
+// does so once it notices.
+func Cancel(ctx context.Context, id int64) error {
+	queries := sqlc.New(db.MainDB)
+
+	job, err := queries.GetIngestionJob(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to find ingestion job %d: %w", id, err)
+	}
+
+	n, err := queries.CancelIngestionJob(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to cancel ingestion job %d: %w", id, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("ingestion job %d is %s and can't be cancelled", id, job.Status)
+	}
+
+	if JobStatus(job.Status) == JobStatusRunning {
+		return nil
+	}
+
+	return cleanupJob(ctx, job)
+}
+
+// Recover finishes or rolls back what was left half done by processes which
+// stopped abruptly, or failed to clean up after themselves. Interrupted
+// removals are finished. What jobs which aren't being processed wrote to the
+// Chroma collection and the BM25 index before being committed is removed, and
+// written again once they're resumed.
+func Recover(ctx context.Context) error {
+	if err := index.RecoverChunkRemovals(ctx); err != nil {
+		return err
+	}
+
+	queries := sqlc.New(db.MainDB)
+
+	staleBefore := time.Now().UTC().Add(-viper.GetDuration("ingestion.stale_after"))
+
+	jobs, err := queries.ListIngestionJobsToRecover(ctx, staleBefore)
+	if err != nil {
+		return fmt.Errorf("failed to list ingestion jobs: %w", err)
+	}
+
+	var errs []error
+	for _, job := range jobs {
+		// Workers don't claim the job while it's cleaned up.
+		n, err := queries.LockIngestionJob(ctx, sqlc.LockIngestionJobParams{
+			ID:        job.ID,
+			Status:    job.Status,
+			UpdatedAt: staleBefore,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to lock ingestion job %d: %w", job.ID, err))
+			continue
+		}
+		if n == 0 {
+			continue
+		}
+
+		status := job.Status
+		if JobStatus(status) == JobStatusRunning {
+			// The worker processing it stopped, it's resumed by the next one.
+			status = string(JobStatusPending)
+		}
+
+		current, err := queries.GetIngestionJob(ctx, job.ID)
+		if err == nil {
+			err = cleanupJob(ctx, current)
+		}
+
+		err = errors.Join(err, queries.SetIngestionJobStatus(ctx, sqlc.SetIngestionJobStatusParams{
+			Status: status,
+			ID:     job.ID,
+		}))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to recover ingestion job %d: %w", job.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// documentsByPath returns the documents of the index added from the file at
+// path, oldest first. Documents used to be stored with the path they were
+// added with, so for an absolute path the documents with relative paths are
+// resolved against the working directory as well.
+func documentsByPath(ctx context.Context, queries *sqlc.Queries, indexID int64, path string) ([]sqlc.Document, error) {
+	documents, err := queries.ListDocumentsByPath(ctx, sqlc.ListDocumentsByPathParams{
+		IndexID:  indexID,
+		Filepath: path,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find documents: %w", err)
+	}
+
+	if !filepath.IsAbs(path) {
+		return documents, nil
+	}
+
+	relative, err := queries.ListDocumentsWithRelativePath(ctx, indexID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find documents: %w", err)
+	}
+
+	for _, document := range relative {
+		if abs, err := filepath.Abs(document.Filepath); err == nil && abs == path {
+			documents = append(documents, document)
+		}
+	}
+	slices.SortFunc(documents, func(a, b sqlc.Document) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return documents, nil
+}
+
+// UpdatesDocument reports whether the job updates an existing document in
+// place, rather than adding a new one.
+func UpdatesDocument(job sqlc.IngestionJob) bool {
+	return job.DocumentID.Valid && job.DocumentID == job.ReplacesDocumentID
+}
+
+// cleanupJob removes the document and chunks a job wrote before it was
+// committed. The chunks and their contexts are kept, so a retried job only
+// has to embed them again. A document updated in place is kept with the
+// chunks it had before.
+func cleanupJob(ctx context.Context, job sqlc.IngestionJob) error {
+	if !job.DocumentID.Valid {
+		return nil
+	}
+
+	queries := sqlc.New(db.MainDB)
+
+	idx, err := queries.GetIndex(ctx, job.IndexID)
+	if err != nil {
+		return fmt.Errorf("failed to find index of ingestion job %d: %w", job.ID, err)
+	}
+
+	chunks, err := jobChunks(job)
+	if err != nil {
+		return err
+	}
+
+	committed := make(map[string]bool)
+	if UpdatesDocument(job) {
+		rows, err := queries.GetChunksByDocumentID(ctx, job.DocumentID.Int64)
+		if err != nil {
+			return fmt.Errorf("failed to find chunks of ingestion job %d: %w", job.ID, err)
+		}
+		for _, row := range rows {
+			committed[row.IndexingID] = true
+		}
+	}
+
+	var chunkIDs []string
+	var documentIDs []chroma.DocumentID
+	for _, chunk := range chunks {
+		if committed[chunk.ID] {
+			continue
+		}
+		chunkIDs = append(chunkIDs, chunk.ID)
+		documentIDs = append(documentIDs, chroma.DocumentID(chunk.ID))
+	}
+
+	if len(chunkIDs) > 0 {
+		err = index.RemoveChunksFromChromaCollection(ctx, idx.Name, documentIDs)
+		if err != nil {
+			return fmt.Errorf("failed to remove chunks of ingestion job %d from Chroma collection: %w", job.ID, err)
+		}
+
+		err = index.RemoveChunksFromBleveIndex(ctx, idx.Name, chunkIDs)
+		if err != nil {
+			return fmt.Errorf("failed to remove chunks of ingestion job %d from BM25 index: %w", job.ID, err)
+		}
+	}
+
+	tx, err := db.MainDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	txQueries := queries.WithTx(tx)
+
+	if !UpdatesDocument(job) {
+		if err = index.DeleteDocumentRows(ctx, txQueries, job.DocumentID.Int64); err != nil {
+			return fmt.Errorf("failed to delete document of ingestion job %d: %w", job.ID, err)
+		}
+	}
+
+	stage := JobStage(job.Stage)
+	if stage == JobStageEmbedded {
+		stage = JobStageContextualised
+	}
+
+	err = txQueries.SaveIngestionJobProgress(ctx, sqlc.SaveIngestionJobProgressParams{
+		Stage:    string(stage),
+		Markdown: job.Markdown,
+		Chunks:   job.Chunks,
+		ID:       job.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save ingestion job %d: %w", job.ID, err)
+	}
+
+	return tx.Commit()
+}
+
+func jobChunks(job sqlc.IngestionJob) ([]parser.Chunk, error) {
+	if !job.Chunks.Valid {
+		return nil, nil
+	}
+
+	var chunks []parser.Chunk
+	if err := json.Unmarshal([]byte(job.Chunks.String), &chunks); err != nil {
+		return nil, fmt.Errorf("failed to read chunks of ingestion job %d: %w", job.ID, err)
+	}
+
+	return chunks, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+var errJobCancelled = errors.New("ingestion job was cancelled")
@@ -0,0 +1,438 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/parser"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/spf13/viper"
+)
+
+func TestJobChunks(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks sql.NullString
+		want   []parser.Chunk
+		err    bool
+	}{
+		{
+			name: "not segmented",
+		},
+		{
+			name:   "chunks",
+			chunks: sql.NullString{String: `[{"ID":"a","Content":"A","Ordinal":0},{"ID":"b","Content":"B","Ordinal":1,"TableSHA256":"sum"}]`, Valid: true},
+			want: []parser.Chunk{
+				{ID: "a", Content: "A"},
+				{ID: "b", Content: "B", Ordinal: 1, TableSHA256: "sum"},
+			},
+		},
+		{
+			name:   "malformed chunks",
+			chunks: sql.NullString{String: `[{"ID":`, Valid: true},
+			err:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, err := jobChunks(sqlc.IngestionJob{ID: 1, Chunks: tt.chunks})
+			if (err != nil) != tt.err {
+				t.Fatalf("jobChunks() error = %v, want error %v", err, tt.err)
+			}
+			if !slices.Equal(chunks, tt.want) {
+				t.Errorf("jobChunks() = %+v, want %+v", chunks, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdatesDocument(t *testing.T) {
+	document := sql.NullInt64{Int64: 1, Valid: true}
+
+	tests := []struct {
+		name     string
+		document sql.NullInt64
+		replaces sql.NullInt64
+		want     bool
+	}{
+		{name: "not committed yet"},
+		{name: "adds a document", document: document},
+		{name: "replaces a document", document: sql.NullInt64{Int64: 2, Valid: true}, replaces: document},
+		{name: "updates a document in place", document: document, replaces: document, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := sqlc.IngestionJob{DocumentID: tt.document, ReplacesDocumentID: tt.replaces}
+			if got := UpdatesDocument(job); got != tt.want {
+				t.Errorf("UpdatesDocument() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryAndCancel(t *testing.T) {
+	tests := []struct {
+		status JobStatus
+		// retried and cancelled are the statuses after Retry and Cancel, or
+		// empty if they fail.
+		retried   JobStatus
+		cancelled JobStatus
+	}{
+		{status: JobStatusPending, cancelled: JobStatusCancelled},
+		{status: JobStatusRunning, cancelled: JobStatusCancelled},
+		{status: JobStatusFailed, retried: JobStatusPending, cancelled: JobStatusCancelled},
+		{status: JobStatusCancelled, retried: JobStatusPending},
+		{status: JobStatusCompleted},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			idx := newTestDB(t)
+			ctx := context.Background()
+			queries := sqlc.New(db.MainDB)
+
+			job, err := Enqueue(ctx, JobParams{IndexID: idx.ID, FilePath: "a.md", Data: []byte("# A\n"), ChunkSize: 50})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			setStatus := func() {
+				t.Helper()
+
+				err := queries.SetIngestionJobStatus(ctx, sqlc.SetIngestionJobStatusParams{Status: string(tt.status), ID: job.ID})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, op := range []struct {
+				name string
+				fn   func(ctx context.Context, id int64) error
+				want JobStatus
+			}{
+				{name: "Retry", fn: Retry, want: tt.retried},
+				{name: "Cancel", fn: Cancel, want: tt.cancelled},
+			} {
+				setStatus()
+
+				err := op.fn(ctx, job.ID)
+				if (err != nil) != (op.want == "") {
+					t.Fatalf("%s() error = %v", op.name, err)
+				}
+
+				current, err := queries.GetIngestionJob(ctx, job.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := op.want
+				if want == "" {
+					want = tt.status
+				}
+				if JobStatus(current.Status) != want {
+					t.Errorf("status after %s() = %s, want %s", op.name, current.Status, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDocumentsByPath(t *testing.T) {
+	idx := newTestDB(t)
+	wd := t.TempDir()
+	t.Chdir(wd)
+
+	// Documents are numbered by the order they're added in.
+	paths := []string{
+		filepath.Join(wd, "notes", "a.md"),
+		"notes/a.md",
+		"./notes/a.md",
+		"notes/b.md",
+		"a.md",
+		filepath.Join(wd, "notes", "b.md"),
+	}
+	for _, path := range paths {
+		addTestDocument(t, idx, path, []byte(path))
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want []int64
+	}{
+		{name: "absolute and relative paths", path: filepath.Join(wd, "notes", "a.md"), want: []int64{1, 2, 3}},
+		{name: "relative path added first", path: filepath.Join(wd, "notes", "b.md"), want: []int64{4, 6}},
+		{name: "relative path only", path: filepath.Join(wd, "a.md"), want: []int64{5}},
+		{name: "file outside the working directory", path: filepath.Join(t.TempDir(), "a.md")},
+		{name: "relative paths are matched exactly", path: "notes/a.md", want: []int64{2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			documents, err := documentsByPath(context.Background(), sqlc.New(db.MainDB), idx.ID, tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []int64
+			for _, document := range documents {
+				got = append(got, document.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("documentsByPath(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnqueueUpdatesDocumentAddedWithRelativePath(t *testing.T) {
+	idx := newTestDB(t)
+	wd := t.TempDir()
+	t.Chdir(wd)
+
+	addTestDocument(t, idx, "notes/a.md", []byte("# Old\n"))
+
+	job, err := Enqueue(context.Background(), JobParams{
+		IndexID:   idx.ID,
+		FilePath:  filepath.Join(wd, "notes", "a.md"),
+		Data:      []byte("# New\n"),
+		ChunkSize: 50,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !job.ReplacesDocumentID.Valid || job.ReplacesDocumentID.Int64 != 1 {
+		t.Errorf("ReplacesDocumentID = %v, want 1", job.ReplacesDocumentID)
+	}
+}
+
+func TestEnqueueDuplicates(t *testing.T) {
+	content := []byte("# A\n")
+
+	tests := []struct {
+		name   string
+		params JobParams
+		// queued adds a job with the same content before the test.
+		queued    bool
+		duplicate *DuplicateError
+		replaces  sql.NullInt64
+	}{
+		{
+			name:      "same content at the same path",
+			params:    JobParams{FilePath: "a.md", Data: content},
+			duplicate: &DuplicateError{Path: "a.md"},
+		},
+		{
+			name:      "same content at another path",
+			params:    JobParams{FilePath: "b.md", Data: content},
+			duplicate: &DuplicateError{Path: "a.md"},
+		},
+		{
+			name:      "same content queued",
+			params:    JobParams{FilePath: "c.md", Data: []byte("# C\n")},
+			queued:    true,
+			duplicate: &DuplicateError{Path: "queued.md", Queued: true},
+		},
+		{
+			name:     "changed content",
+			params:   JobParams{FilePath: "a.md", Data: []byte("# B\n")},
+			replaces: sql.NullInt64{Int64: 1, Valid: true},
+		},
+		{
+			name:     "forced",
+			params:   JobParams{FilePath: "a.md", Data: content, Force: true},
+			replaces: sql.NullInt64{Int64: 1, Valid: true},
+		},
+		{
+			name:   "added only",
+			params: JobParams{FilePath: "a.md", Data: []byte("# B\n"), AddOnly: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := newTestDB(t)
+			ctx := context.Background()
+
+			addTestDocument(t, idx, "a.md", content)
+			if tt.queued {
+				_, err := Enqueue(ctx, JobParams{IndexID: idx.ID, FilePath: "queued.md", Data: tt.params.Data, ChunkSize: 50})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			params := tt.params
+			params.IndexID = idx.ID
+			params.ChunkSize = 50
+
+			job, err := Enqueue(ctx, params)
+
+			var duplicate *DuplicateError
+			errors.As(err, &duplicate)
+			switch {
+			case tt.duplicate != nil && (duplicate == nil || *duplicate != *tt.duplicate):
+				t.Fatalf("Enqueue() error = %v, want %v", err, tt.duplicate)
+			case tt.duplicate == nil && err != nil:
+				t.Fatalf("Enqueue() error = %v", err)
+			}
+
+			if job.ReplacesDocumentID != tt.replaces {
+				t.Errorf("ReplacesDocumentID = %v, want %v", job.ReplacesDocumentID, tt.replaces)
+			}
+		})
+	}
+}
+
+func TestRecover(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   JobStatus
+		stage    JobStage
+		replaces bool
+		stale    bool
+		// wantStatus and wantStage are the state of the job after Recover,
+		// keepDocument whether the document it wrote is still there.
+		wantStatus   JobStatus
+		wantStage    JobStage
+		keepDocument bool
+	}{
+		{
+			name:       "pending job",
+			status:     JobStatusPending,
+			stage:      JobStageEmbedded,
+			wantStatus: JobStatusPending,
+			wantStage:  JobStageContextualised,
+		},
+		{
+			name:       "failed job",
+			status:     JobStatusFailed,
+			stage:      JobStageContextualised,
+			wantStatus: JobStatusFailed,
+			wantStage:  JobStageContextualised,
+		},
+		{
+			name:         "job updating a document in place",
+			status:       JobStatusCancelled,
+			stage:        JobStageEmbedded,
+			replaces:     true,
+			wantStatus:   JobStatusCancelled,
+			wantStage:    JobStageContextualised,
+			keepDocument: true,
+		},
+		{
+			name:       "job of a stopped worker",
+			status:     JobStatusRunning,
+			stage:      JobStageEmbedded,
+			stale:      true,
+			wantStatus: JobStatusPending,
+			wantStage:  JobStageContextualised,
+		},
+		{
+			name:         "job being processed",
+			status:       JobStatusRunning,
+			stage:        JobStageEmbedded,
+			wantStatus:   JobStatusRunning,
+			wantStage:    JobStageEmbedded,
+			keepDocument: true,
+		},
+		{
+			name:         "committed job",
+			status:       JobStatusCompleted,
+			stage:        JobStageCommitted,
+			wantStatus:   JobStatusCompleted,
+			wantStage:    JobStageCommitted,
+			keepDocument: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := newTestDB(t)
+			ctx := context.Background()
+			queries := sqlc.New(db.MainDB)
+
+			viper.Set("ingestion.stale_after", time.Hour)
+			t.Cleanup(func() { viper.Set("ingestion.stale_after", nil) })
+
+			job, err := Enqueue(ctx, JobParams{IndexID: idx.ID, FilePath: "a.md", Data: []byte("# A\n"), ChunkSize: 50})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The job wrote its document, but none of its chunks yet.
+			addTestDocument(t, idx, "a.md", []byte("# A\n"))
+
+			updatedAt := time.Now().UTC()
+			if tt.stale {
+				updatedAt = updatedAt.Add(-2 * time.Hour)
+			}
+			var replaces sql.NullInt64
+			if tt.replaces {
+				replaces = sql.NullInt64{Int64: 1, Valid: true}
+			}
+			_, err = db.MainDB.ExecContext(ctx,
+				"UPDATE ingestion_jobs SET status = ?, stage = ?, document_id = 1, replaces_document_id = ?, updated_at = ? WHERE id = ?",
+				tt.status, tt.stage, replaces, updatedAt, job.ID,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = Recover(ctx); err != nil {
+				t.Fatalf("Recover() error = %v", err)
+			}
+
+			job, err = queries.GetIngestionJob(ctx, job.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if JobStatus(job.Status) != tt.wantStatus || JobStage(job.Stage) != tt.wantStage {
+				t.Errorf("job is %s at %s, want %s at %s", job.Status, job.Stage, tt.wantStatus, tt.wantStage)
+			}
+
+			documents, err := queries.ListDocumentsByIndexID(ctx, idx.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kept := len(documents) > 0; kept != tt.keepDocument {
+				t.Errorf("document kept = %v, want %v", kept, tt.keepDocument)
+			}
+		})
+	}
+}
+
+func TestRecoverDropsRemovalsOfDeletedIndexes(t *testing.T) {
+	newTestDB(t)
+	ctx := context.Background()
+
+	_, err := sqlc.New(db.MainDB).CreateChunkRemoval(ctx, sqlc.CreateChunkRemovalParams{
+		IndexID:     99,
+		ChunkIds:    `["a"]`,
+		DocumentIds: `[1]`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = Recover(ctx); err != nil {
+		t.Fatalf("Recover() error = %v", err)
+	}
+
+	removals, err := sqlc.New(db.MainDB).ListChunkRemovals(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removals) != 0 {
+		t.Errorf("removals = %d, want 0", len(removals))
+	}
+}
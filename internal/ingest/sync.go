@@ -0,0 +1,403 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/index"
+	"github.com/OptimusePrime/petagpt/internal/parser"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/fsnotify/fsnotify"
+)
+
+type SyncOptions struct {
+	Index        sqlc.Index
+	Dir          string
+	Filter       FileFilter
+	Tags         []string
+	ChunkSize    int
+	RequestDelay int
+	// Parallel is the number of documents processed at a time.
+	Parallel int
+}
+
+type SyncFailure struct {
+	Path string
+	Err  error
+}
+
+type SyncResult struct {
+	Added   []string
+	Updated []string
+	Removed []string
+	// Moved documents are listed as "old path -> new path".
+	Moved []string
+	// Queued files are already being added by an earlier sync or document add.
+	Queued []string
+	// Skipped files are empty or have the same content as another document in
+	// the index.
+	Skipped   []SyncFailure
+	Unchanged int
+	Failed    []SyncFailure
+}
+
+// Syncer mirrors a directory to an index. Documents are matched with files by
+// their path, so only documents within the directory are touched.
+type Syncer struct {
+	opts   SyncOptions
+	dir    string
+	worker *Worker
+
+	mu     sync.Mutex
+	ctx    context.Context
+	jobs   map[int64]syncJob
+	result *SyncResult
+}
+
+type syncJob struct {
+	path    string
+	updates bool
+	// replaces are the documents of the previous version of the file which
+	// the job doesn't update in place, they're removed once it's done.
+	replaces []sqlc.Document
+}
+
+func NewSyncer(dc *parser.DocumentChunker, opts SyncOptions) (*Syncer, error) {
+	dir, err := filepath.Abs(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", opts.Dir)
+	}
+
+	s := &Syncer{
+		opts:   opts,
+		dir:    dir,
+		worker: NewWorker(dc),
+	}
+	s.worker.OnJobDone = s.jobDone
+
+	return s, nil
+}
+
+// Sync adds new files to the index, updates changed files, moves the documents
+// of renamed files and removes the documents of files which are gone or no
+// longer selected by the filter.
+// A changed file replaces its old document only once it's indexed, so a
+// failure keeps the old version searchable.
+func (s *Syncer) Sync(ctx context.Context) (*SyncResult, error) {
+	result := new(SyncResult)
+
+	s.mu.Lock()
+	s.ctx = ctx
+	s.jobs = make(map[int64]syncJob)
+	s.result = result
+	s.mu.Unlock()
+
+	queries := sqlc.New(db.MainDB)
+
+	documents, err := queries.ListDocumentsByIndexID(ctx, s.opts.Index.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+
+	existing := make(map[string][]sqlc.Document)
+	for _, document := range documents {
+		// Documents added with a relative path are resolved against the
+		// working directory.
+		path, err := filepath.Abs(document.Filepath)
+		if err != nil || !s.contains(path) {
+			continue
+		}
+		existing[path] = append(existing[path], document)
+	}
+
+	activeJobs, err := queries.ListActiveIngestionJobsByIndexID(ctx, s.opts.Index.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ingestion jobs: %w", err)
+	}
+
+	queued := make(map[string]bool)
+	for _, job := range activeJobs {
+		queued[job.FilePath+"\x00"+job.FileSha256] = true
+	}
+
+	type syncFile struct {
+		path     string
+		checksum string
+	}
+
+	var files []syncFile
+	present := make(map[string]bool)
+
+	err = WalkFiles(s.dir, s.opts.Filter, func(file string, info fs.FileInfo) error {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			result.Failed = append(result.Failed, SyncFailure{Path: file, Err: err})
+			// The file may still be there, so its document is kept.
+			present[file] = true
+			return nil
+		}
+		// Files are often truncated while they're saved or copied, so an
+		// empty file keeps its document until it has content again.
+		present[file] = true
+		if len(data) == 0 {
+			result.Skipped = append(result.Skipped, SyncFailure{Path: file, Err: errors.New("empty file")})
+			return nil
+		}
+
+		files = append(files, syncFile{path: file, checksum: FileSHA256(data)})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A new file with the content of a document whose file is gone was renamed
+	// or moved, so the document is moved along instead of being removed while
+	// the file is skipped as a duplicate of it.
+	gone := make(map[string][]sqlc.Document)
+	for path, documents := range existing {
+		if present[path] {
+			continue
+		}
+		for _, document := range documents {
+			gone[document.Filesha256] = append(gone[document.Filesha256], document)
+		}
+	}
+
+	// moves are the files a document was moved to, keep the documents moved,
+	// which aren't removed with the files they were at.
+	moves := make(map[string]bool)
+	keep := make(map[int64]bool)
+
+	for _, file := range files {
+		if len(existing[file.path]) > 0 || len(gone[file.checksum]) == 0 {
+			continue
+		}
+
+		document := gone[file.checksum][0]
+		gone[file.checksum] = gone[file.checksum][1:]
+
+		// A failed move is tried again by the next sync, until then the
+		// document stays where it was.
+		moves[file.path] = true
+		keep[document.ID] = true
+
+		if err := index.MoveDocument(ctx, s.opts.Index, document, file.path); err != nil {
+			result.Failed = append(result.Failed, SyncFailure{Path: file.path, Err: err})
+			continue
+		}
+		result.Moved = append(result.Moved, document.Filepath+" -> "+file.path)
+	}
+
+	for _, file := range files {
+		if moves[file.path] {
+			continue
+		}
+
+		previous := existing[file.path]
+		if len(previous) == 1 && previous[0].Filesha256 == file.checksum {
+			result.Unchanged++
+			continue
+		}
+
+		if queued[file.path+"\x00"+file.checksum] {
+			result.Queued = append(result.Queued, file.path)
+			continue
+		}
+
+		data, err := os.ReadFile(file.path)
+		if err != nil {
+			result.Failed = append(result.Failed, SyncFailure{Path: file.path, Err: err})
+			continue
+		}
+
+		job, err := Enqueue(ctx, JobParams{
+			IndexID:      s.opts.Index.ID,
+			FilePath:     file.path,
+			Data:         data,
+			Tags:         s.opts.Tags,
+			ChunkSize:    s.opts.ChunkSize,
+			RequestDelay: s.opts.RequestDelay,
+		})
+		var duplicate *DuplicateError
+		if errors.As(err, &duplicate) {
+			if duplicate.Queued {
+				result.Queued = append(result.Queued, file.path)
+			} else {
+				result.Skipped = append(result.Skipped, SyncFailure{Path: file.path, Err: err})
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var replaces []sqlc.Document
+		for _, document := range previous {
+			if !job.ReplacesDocumentID.Valid || document.ID != job.ReplacesDocumentID.Int64 {
+				replaces = append(replaces, document)
+			}
+		}
+
+		s.mu.Lock()
+		s.jobs[job.ID] = syncJob{path: file.path, updates: len(previous) > 0, replaces: replaces}
+		s.mu.Unlock()
+	}
+
+	for path, documents := range existing {
+		if present[path] {
+			continue
+		}
+
+		var removed []sqlc.Document
+		for _, document := range documents {
+			if !keep[document.ID] {
+				removed = append(removed, document)
+			}
+		}
+		if len(removed) == 0 {
+			continue
+		}
+
+		if err := index.RemoveDocuments(ctx, s.opts.Index, removed...); err != nil {
+			result.Failed = append(result.Failed, SyncFailure{Path: path, Err: err})
+			continue
+		}
+		result.Removed = append(result.Removed, path)
+	}
+
+	s.mu.Lock()
+	jobIDs := make([]int64, 0, len(s.jobs))
+	for id := range s.jobs {
+		jobIDs = append(jobIDs, id)
+	}
+	s.mu.Unlock()
+
+	if err := s.worker.DrainJobs(ctx, s.opts.Parallel, jobIDs); err != nil {
+		return result, err
+	}
+
+	return result, ctx.Err()
+}
+
+func (s *Syncer) contains(path string) bool {
+	rel, err := filepath.Rel(s.dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (s *Syncer) jobDone(job sqlc.IngestionJob, err error) {
+	s.mu.Lock()
+	// The worker also processes jobs queued by others.
+	syncJob, ok := s.jobs[job.ID]
+	ctx, result := s.ctx, s.result
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	// The previous version is removed without holding mu, as it waits on
+	// Chroma and the BM25 index.
+	if err == nil {
+		if err = index.RemoveDocuments(ctx, s.opts.Index, syncJob.replaces...); err != nil {
+			err = fmt.Errorf("failed to remove previous version: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case err != nil:
+		result.Failed = append(result.Failed, SyncFailure{Path: syncJob.path, Err: err})
+	case syncJob.updates:
+		result.Updated = append(result.Updated, syncJob.path)
+	default:
+		result.Added = append(result.Added, syncJob.path)
+	}
+}
+
+// Watch syncs the directory, then again whenever files in it change, once no
+// change happened for the debounce duration. It returns when ctx is done.
+func (s *Syncer) Watch(ctx context.Context, debounce time.Duration, onSync func(result *SyncResult, err error)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch directory: %w", err)
+	}
+	defer watcher.Close()
+
+	if err := s.watchDirs(watcher, s.dir); err != nil {
+		return err
+	}
+
+	onSync(s.Sync(ctx))
+
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			// fsnotify doesn't watch subdirectories, new ones are added as
+			// they appear.
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := s.watchDirs(watcher, event.Name); err != nil {
+						onSync(nil, err)
+					}
+				}
+			}
+
+			timer = time.After(debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			onSync(nil, fmt.Errorf("failed to watch directory: %w", err))
+		case <-timer:
+			timer = nil
+			onSync(s.Sync(ctx))
+		}
+	}
+}
+
+func (s *Syncer) watchDirs(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+
+		if rel, err := filepath.Rel(s.dir, path); err == nil && rel != "." && s.opts.Filter.excluded(filepath.ToSlash(rel)) {
+			return filepath.SkipDir
+		}
+
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("failed to watch directory: %s: %w", path, err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,178 @@
+package ingest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/spf13/viper"
+)
+
+// newTestDB creates a fresh database with an index named test.
+func newTestDB(t *testing.T) sqlc.Index {
+	t.Helper()
+
+	viper.Set("data_dir", t.TempDir())
+	t.Cleanup(func() { viper.Set("data_dir", "") })
+
+	ctx := context.Background()
+	if err := db.InitDatabase(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.MainDB.Close() })
+
+	_, err := db.MainDB.ExecContext(ctx, "INSERT INTO indexes (name, path, collection) VALUES ('test', 'test.bleve', 'test')")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := sqlc.New(db.MainDB).GetIndexByName(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return idx
+}
+
+// addTestDocument records a document as if the file at path had been added
+// with the given content.
+func addTestDocument(t *testing.T, idx sqlc.Index, path string, data []byte) {
+	t.Helper()
+
+	_, err := db.MainDB.ExecContext(context.Background(),
+		"INSERT INTO documents (index_id, filePath, fileType, fileSize, fileSha256) VALUES (?, ?, ?, ?, ?)",
+		idx.ID, path, filepath.Ext(path), len(data), FileSHA256(data),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncKeepsDocumentsOfEmptyFiles(t *testing.T) {
+	idx := newTestDB(t)
+	dir := t.TempDir()
+
+	content := []byte("# Notes\n")
+	for name, data := range map[string][]byte{"saving.md": nil, "unchanged.md": content} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// Both were added before, the first file is being saved again.
+		addTestDocument(t, idx, path, content)
+	}
+
+	syncer, err := NewSyncer(nil, SyncOptions{Index: idx, Dir: dir, Parallel: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := syncer.Sync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Removed) != 0 || len(result.Added) != 0 || len(result.Failed) != 0 {
+		t.Errorf("result = %+v, want no changes", result)
+	}
+	if result.Unchanged != 1 {
+		t.Errorf("Unchanged = %d, want 1", result.Unchanged)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0].Path != filepath.Join(dir, "saving.md") {
+		t.Errorf("Skipped = %v, want the empty file", result.Skipped)
+	}
+
+	documents, err := sqlc.New(db.MainDB).ListDocumentsByIndexID(context.Background(), idx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(documents) != 2 {
+		t.Errorf("documents = %d, want 2", len(documents))
+	}
+}
+
+func TestSyncerContains(t *testing.T) {
+	dir := t.TempDir()
+
+	syncer, err := NewSyncer(nil, SyncOptions{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: filepath.Join(dir, "a.md"), want: true},
+		{path: filepath.Join(dir, "notes", "a.md"), want: true},
+		{path: filepath.Join(dir, "..dotted", "a.md"), want: true},
+		{path: dir, want: true},
+		{path: filepath.Dir(dir)},
+		{path: filepath.Join(filepath.Dir(dir), "a.md")},
+		{path: dir + "-other"},
+		{path: "a.md"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := syncer.contains(tt.path); got != tt.want {
+				t.Errorf("contains(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncSkipsQueuedFiles(t *testing.T) {
+	idx := newTestDB(t)
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	path := filepath.Join(dir, "a.md")
+	data := []byte("# A\n")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file is being added by an earlier document add, whose worker runs
+	// in another process.
+	viper.Set("ingestion.stale_after", time.Hour)
+	t.Cleanup(func() { viper.Set("ingestion.stale_after", nil) })
+
+	job, err := Enqueue(ctx, JobParams{IndexID: idx.ID, FilePath: path, Data: data, ChunkSize: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sqlc.New(db.MainDB).SetIngestionJobStatus(ctx, sqlc.SetIngestionJobStatusParams{Status: string(JobStatusRunning), ID: job.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	syncer, err := NewSyncer(nil, SyncOptions{Index: idx, Dir: dir, Parallel: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := syncer.Sync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Queued) != 1 || result.Queued[0] != path {
+		t.Errorf("Queued = %v, want %s", result.Queued, path)
+	}
+	if len(result.Added) != 0 || len(result.Failed) != 0 {
+		t.Errorf("result = %+v, want no changes", result)
+	}
+
+	jobs, err := sqlc.New(db.MainDB).ListActiveIngestionJobsByIndexID(ctx, idx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 {
+		t.Errorf("active jobs = %d, want 1", len(jobs))
+	}
+}
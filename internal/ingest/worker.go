@@ -0,0 +1,678 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/index"
+	"github.com/OptimusePrime/petagpt/internal/parser"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/spf13/viper"
+	"golang.org/x/sync/errgroup"
+)
+
+// Worker processes the jobs of the ingestion queue. Several workers, also in
+// different processes, can share the queue, and a worker can be used by
+// several goroutines, in which case OnJobDone must be safe for concurrent use.
+type Worker struct {
+	dc *parser.DocumentChunker
+	// OnJobDone, if set, is called after every job the worker processed, with
+	// the error it failed with.
+	OnJobDone func(job sqlc.IngestionJob, err error)
+}
+
+func NewWorker(dc *parser.DocumentChunker) *Worker {
+	return &Worker{dc: dc}
+}
+
+// Drain processes jobs until the queue has no pending ones left, including
+// the jobs of workers which stopped without finishing them.
+func (w *Worker) Drain(ctx context.Context) error {
+	for {
+		ok, err := w.processNext(ctx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+	}
+}
+
+// DrainParallel drains the queue processing up to n jobs at a time.
+func (w *Worker) DrainParallel(ctx context.Context, n int) error {
+	g, ctx := errgroup.WithContext(ctx)
+	for range max(n, 1) {
+		g.Go(func() error {
+			return w.Drain(ctx)
+		})
+	}
+
+	return g.Wait()
+}
+
+// DrainJobs drains the queue like DrainParallel, then waits until the given
+// jobs are done, as workers in other processes may have claimed some of them.
+// OnJobDone is also called for those jobs, once another worker finished them.
+// It returns early, without an error, when ctx is done.
+func (w *Worker) DrainJobs(ctx context.Context, n int, ids []int64) error {
+	var (
+		mu   sync.Mutex
+		done = make(map[int64]bool)
+	)
+
+	worker := *w
+	worker.OnJobDone = func(job sqlc.IngestionJob, err error) {
+		mu.Lock()
+		done[job.ID] = true
+		mu.Unlock()
+
+		if w.OnJobDone != nil {
+			w.OnJobDone(job, err)
+		}
+	}
+
+	queries := sqlc.New(db.MainDB)
+
+	for {
+		if err := worker.DrainParallel(ctx, n); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		var waiting []int64
+		for _, id := range ids {
+			if done[id] {
+				continue
+			}
+
+			job, err := queries.GetIngestionJob(ctx, id)
+			if err != nil {
+				return fmt.Errorf("failed to get ingestion job %d: %w", id, err)
+			}
+
+			switch JobStatus(job.Status) {
+			case JobStatusPending, JobStatusRunning:
+				waiting = append(waiting, id)
+				continue
+			case JobStatusFailed:
+				err = errors.New(job.Error.String)
+			case JobStatusCancelled:
+				err = errJobCancelled
+			}
+
+			done[id] = true
+			if w.OnJobDone != nil {
+				w.OnJobDone(job, err)
+			}
+		}
+		if len(waiting) == 0 {
+			return nil
+		}
+		ids = waiting
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(viper.GetDuration("ingestion.poll_interval")):
+		}
+	}
+}
+
+// Run processes jobs as they're queued until ctx is done, checking the queue
+// every ingestion.poll_interval when it's empty.
+func (w *Worker) Run(ctx context.Context) error {
+	for {
+		if err := w.Drain(ctx); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(viper.GetDuration("ingestion.poll_interval")):
+		}
+	}
+}
+
+// processNext claims and processes the next job, and reports whether there
+// was one. Only errors of the queue itself are returned, job errors are
+// recorded with the job.
+func (w *Worker) processNext(ctx context.Context) (bool, error) {
+	queries := sqlc.New(db.MainDB)
+
+	staleAfter := viper.GetDuration("ingestion.stale_after")
+
+	job, err := queries.ClaimIngestionJob(ctx, time.Now().UTC().Add(-staleAfter))
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to claim ingestion job: %w", err)
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go heartbeat(jobCtx, cancel, job.ID, staleAfter/4)
+
+	jobErr := w.process(jobCtx, job)
+
+	// The job may have been cancelled, or the worker stopped, so the job is
+	// finished up with a context of its own.
+	finishCtx := context.WithoutCancel(ctx)
+
+	current, err := queries.GetIngestionJob(finishCtx, job.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get ingestion job %d: %w", job.ID, err)
+	}
+
+	// Unless the job is committed, what it wrote to the Chroma collection and
+	// the BM25 index is removed again, so search doesn't return chunks the
+	// database doesn't know about. A failed cleanup is left to Recover.
+	switch {
+	case JobStatus(current.Status) == JobStatusCancelled:
+		jobErr = errJobCancelled
+		if err := cleanupJob(finishCtx, current); err != nil {
+			jobErr = errors.Join(jobErr, err)
+		}
+	case jobErr == nil:
+	case ctx.Err() != nil:
+		// The worker was stopped, the job is resumed by the next one.
+		cleanupErr := cleanupJob(finishCtx, current)
+		return false, errors.Join(cleanupErr, queries.ReleaseIngestionJob(finishCtx, job.ID))
+	default:
+		if err := cleanupJob(finishCtx, current); err != nil {
+			jobErr = errors.Join(jobErr, err)
+		}
+
+		err = queries.FailIngestionJob(finishCtx, sqlc.FailIngestionJobParams{
+			Error: nullString(jobErr.Error()),
+			ID:    job.ID,
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to fail ingestion job %d: %w", job.ID, err)
+		}
+		current.Status = string(JobStatusFailed)
+		current.Error = nullString(jobErr.Error())
+	}
+
+	if w.OnJobDone != nil {
+		w.OnJobDone(current, jobErr)
+	}
+
+	return true, nil
+}
+
+// heartbeat keeps the job from being claimed by another worker while it's
+// processed, and cancels processing when the job is cancelled.
+func heartbeat(ctx context.Context, cancel context.CancelFunc, id int64, interval time.Duration) {
+	queries := sqlc.New(db.MainDB)
+
+	ticker := time.NewTicker(max(interval, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		_ = queries.TouchIngestionJob(ctx, id)
+
+		job, err := queries.GetIngestionJob(ctx, id)
+		if err == nil && JobStatus(job.Status) == JobStatusCancelled {
+			cancel()
+			return
+		}
+	}
+}
+
+// jobRun holds the state of a job while it's processed.
+type jobRun struct {
+	job    sqlc.IngestionJob
+	idx    sqlc.Index
+	tags   []string
+	chunks []parser.Chunk
+}
+
+func (w *Worker) process(ctx context.Context, job sqlc.IngestionJob) error {
+	queries := sqlc.New(db.MainDB)
+
+	idx, err := queries.GetIndex(ctx, job.IndexID)
+	if err != nil {
+		return fmt.Errorf("failed to find index: %w", err)
+	}
+
+	run := &jobRun{job: job, idx: idx}
+
+	if err := json.Unmarshal([]byte(job.Tags), &run.tags); err != nil {
+		return fmt.Errorf("failed to read tags: %w", err)
+	}
+
+	run.chunks, err = jobChunks(job)
+	if err != nil {
+		return err
+	}
+
+	for JobStage(run.job.Stage) != JobStageCommitted {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		switch JobStage(run.job.Stage) {
+		case JobStageQueued:
+			err = w.parse(ctx, run)
+		case JobStageParsed:
+			err = w.segment(ctx, run)
+		case JobStageSegmented:
+			err = w.contextualise(ctx, run)
+		case JobStageContextualised:
+			err = w.embed(ctx, run)
+		case JobStageEmbedded:
+			err = w.commit(ctx, run)
+		default:
+			err = fmt.Errorf("unknown stage: %s", run.job.Stage)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *Worker) parse(ctx context.Context, run *jobRun) error {
+	markdown, err := parser.ParseDocument(ctx, run.job.FileData, filepath.Base(run.job.FilePath))
+	if err != nil {
+		return fmt.Errorf("failed parsing document: %w", err)
+	}
+
+	run.job.Markdown = sql.NullString{String: markdown, Valid: true}
+
+	return run.save(ctx, sqlc.New(db.MainDB), JobStageParsed)
+}
+
+func (w *Worker) segment(ctx context.Context, run *jobRun) error {
+	// A document updated in place reuses the table summaries and chunks
+	// which are unchanged since its previous version.
+	var previous []sqlc.Chunk
+	if run.job.ReplacesDocumentID.Valid && !run.job.Force {
+		var err error
+		previous, err = sqlc.New(db.MainDB).GetChunksByDocumentID(ctx, run.job.ReplacesDocumentID.Int64)
+		if err != nil {
+			return fmt.Errorf("failed to find chunks of previous version: %w", err)
+		}
+	}
+
+	summaries := make(map[string]string)
+	for _, chunk := range previous {
+		if chunk.TableSha256.Valid {
+			summaries[chunk.TableSha256.String] = chunk.Content
+		}
+	}
+
+	chunks, err := w.dc.Segment(ctx, run.job.Markdown.String, int(run.job.ChunkSize), int(run.job.RequestDelay), summaries)
+	if err != nil {
+		return fmt.Errorf("failed segmenting document: %w", err)
+	}
+
+	run.chunks = chunks
+	reuseChunks(previous, run.chunks)
+
+	return run.save(ctx, sqlc.New(db.MainDB), JobStageSegmented)
+}
+
+// reuseChunks gives the chunks whose content is unchanged since the previous
+// version of the document the ID and context they had, so they're neither
+// contextualised nor embedded again.
+func reuseChunks(previous []sqlc.Chunk, chunks []parser.Chunk) {
+	byContent := make(map[string][]sqlc.Chunk)
+	for _, chunk := range previous {
+		byContent[chunk.Content] = append(byContent[chunk.Content], chunk)
+	}
+
+	for i := range chunks {
+		matches := byContent[chunks[i].Content]
+		if len(matches) == 0 {
+			continue
+		}
+
+		chunks[i].ID = matches[0].IndexingID
+		chunks[i].Context = matches[0].Context
+		byContent[chunks[i].Content] = matches[1:]
+	}
+}
+
+// contextualise keeps the contexts created before a failure, so a retry only
+// creates the missing ones.
+func (w *Worker) contextualise(ctx context.Context, run *jobRun) error {
+	chunks, err := w.dc.Contextualise(ctx, run.job.Markdown.String, run.chunks)
+	if chunks != nil {
+		run.chunks = chunks
+	}
+	if err != nil {
+		saveErr := run.save(context.WithoutCancel(ctx), sqlc.New(db.MainDB), JobStageSegmented)
+		return errors.Join(fmt.Errorf("failed creating chunk contexts: %w", err), saveErr)
+	}
+
+	return run.save(ctx, sqlc.New(db.MainDB), JobStageContextualised)
+}
+
+// embed creates the document and adds its chunks to the Chroma collection,
+// which embeds them. Chunks are upserted, so embedding again after a failure
+// doesn't duplicate them.
+func (w *Worker) embed(ctx context.Context, run *jobRun) error {
+	document, err := run.document(ctx)
+	if err != nil {
+		return err
+	}
+
+	chunks := run.chunks
+	if UpdatesDocument(run.job) {
+		chunks, err = run.changedChunks(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(chunks) > 0 {
+		err = index.UpsertChunksToChromaCollection(ctx, run.idx.Name, document, run.tags, chunks...)
+		if err != nil {
+			return fmt.Errorf("failed adding chunks to Chroma collection: %s: %w", run.idx.Name, err)
+		}
+	}
+
+	return run.save(ctx, sqlc.New(db.MainDB), JobStageEmbedded)
+}
+
+// changedChunks returns the chunks of a document updated in place which
+// aren't in the Chroma collection as they are, all of them if its tags
+// changed.
+func (run *jobRun) changedChunks(ctx context.Context) ([]parser.Chunk, error) {
+	queries := sqlc.New(db.MainDB)
+
+	tags, err := queries.GetTagsByDocumentID(ctx, run.job.DocumentID.Int64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document tags: %w", err)
+	}
+	if !sameTags(tags, run.tags) {
+		return run.chunks, nil
+	}
+
+	previous, err := queries.GetChunksByDocumentID(ctx, run.job.DocumentID.Int64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find chunks of previous version: %w", err)
+	}
+
+	embedded := make(map[string]sqlc.Chunk)
+	for _, chunk := range previous {
+		embedded[chunk.IndexingID] = chunk
+	}
+
+	var chunks []parser.Chunk
+	for _, chunk := range run.chunks {
+		if prev, ok := embedded[chunk.ID]; ok && prev.Content == chunk.Content && prev.Context == chunk.Context && prev.Page == int64(chunk.Page) {
+			continue
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, nil
+}
+
+func sameTags(a, b []string) bool {
+	a = slices.Sorted(slices.Values(a))
+	b = slices.Sorted(slices.Values(b))
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
+
+// commit adds the chunks to the BM25 index and the database, completing the
+// job in the same transaction the chunks are created in. The chunks of a
+// document updated in place which are no longer part of it are removed once
+// the new version is committed, with their removal recorded in the same
+// transaction.
+func (w *Worker) commit(ctx context.Context, run *jobRun) error {
+	queries := sqlc.New(db.MainDB)
+
+	// The document was removed since the chunks were embedded.
+	if !run.job.DocumentID.Valid {
+		return run.save(ctx, queries, JobStageContextualised)
+	}
+
+	document, err := queries.GetDocument(ctx, run.job.DocumentID.Int64)
+	if err != nil {
+		return fmt.Errorf("failed to get document: %w", err)
+	}
+
+	updates := UpdatesDocument(run.job)
+
+	var stale []string
+	if updates {
+		stale, err = run.staleChunks(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = index.AddChunksToBleveIndex(ctx, run.idx.Name, document, run.tags, run.chunks...)
+	if err != nil {
+		return fmt.Errorf("failed adding chunks to BM25 index: %s: %w", run.idx.Name, err)
+	}
+
+	tx, err := db.MainDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	txQueries := queries.WithTx(tx)
+
+	if updates {
+		if err = txQueries.DeleteChunksByDocumentID(ctx, document.ID); err != nil {
+			return fmt.Errorf("failed to delete chunks of previous version: %w", err)
+		}
+
+		err = txQueries.UpdateDocumentContent(ctx, sqlc.UpdateDocumentContentParams{
+			Filesize:   run.job.FileSize,
+			Filesha256: run.job.FileSha256,
+			ID:         document.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed updating document in database: %w", err)
+		}
+
+		if err = txQueries.DeleteDocumentTags(ctx, document.ID); err != nil {
+			return fmt.Errorf("failed to delete document tags: %w", err)
+		}
+
+		if err = addDocumentTags(ctx, txQueries, document.ID, run.tags); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range run.chunks {
+		_, err = txQueries.CreateChunk(ctx, sqlc.CreateChunkParams{
+			DocumentID:  document.ID,
+			StartOffset: sql.NullInt64{Int64: int64(c.StartOffset), Valid: true},
+			EndOffset:   sql.NullInt64{Int64: int64(c.EndOffset), Valid: true},
+			Content:     c.Content,
+			Context:     c.Context,
+			IndexingID:  c.ID,
+			Page:        int64(c.Page),
+			Ordinal:     sql.NullInt64{Int64: int64(c.Ordinal), Valid: true},
+			TableSha256: sql.NullString{String: c.TableSHA256, Valid: c.TableSHA256 != ""},
+		})
+		if err != nil {
+			return fmt.Errorf("failed creating chunk in database: %w", err)
+		}
+	}
+
+	var removal sqlc.ChunkRemoval
+	if len(stale) > 0 {
+		removal, err = index.RecordChunkRemoval(ctx, txQueries, run.idx, stale, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = txQueries.CompleteIngestionJob(ctx, run.job.ID); err != nil {
+		return fmt.Errorf("failed to complete ingestion job: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	run.job.Stage = string(JobStageCommitted)
+
+	if len(stale) > 0 {
+		// The job is committed either way, a failed removal is finished by
+		// index.RecoverChunkRemovals.
+		_ = index.FinishChunkRemoval(ctx, run.idx, removal)
+	}
+
+	return nil
+}
+
+// staleChunks returns the IDs of the chunks of the previous version of the
+// document which the new one doesn't reuse.
+func (run *jobRun) staleChunks(ctx context.Context) ([]string, error) {
+	previous, err := sqlc.New(db.MainDB).GetChunksByDocumentID(ctx, run.job.DocumentID.Int64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find chunks of previous version: %w", err)
+	}
+
+	current := make(map[string]bool)
+	for _, chunk := range run.chunks {
+		current[chunk.ID] = true
+	}
+
+	var stale []string
+	for _, chunk := range previous {
+		if !current[chunk.IndexingID] {
+			stale = append(stale, chunk.IndexingID)
+		}
+	}
+
+	return stale, nil
+}
+
+// document returns the document of the job, creating it with its tags the
+// first time, unless the job updates one which still exists.
+func (run *jobRun) document(ctx context.Context) (sqlc.Document, error) {
+	queries := sqlc.New(db.MainDB)
+
+	if run.job.DocumentID.Valid {
+		document, err := queries.GetDocument(ctx, run.job.DocumentID.Int64)
+		if err != nil {
+			return sqlc.Document{}, fmt.Errorf("failed to get document: %w", err)
+		}
+		return document, nil
+	}
+
+	if run.job.ReplacesDocumentID.Valid {
+		document, err := queries.GetDocument(ctx, run.job.ReplacesDocumentID.Int64)
+		if err == nil {
+			run.job.DocumentID = run.job.ReplacesDocumentID
+			if err = run.save(ctx, queries, JobStage(run.job.Stage)); err != nil {
+				return sqlc.Document{}, err
+			}
+			return document, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return sqlc.Document{}, fmt.Errorf("failed to get document: %w", err)
+		}
+	}
+
+	tx, err := db.MainDB.BeginTx(ctx, nil)
+	if err != nil {
+		return sqlc.Document{}, err
+	}
+	defer tx.Rollback()
+
+	txQueries := queries.WithTx(tx)
+
+	document, err := txQueries.CreateDocument(ctx, sqlc.CreateDocumentParams{
+		IndexID:    run.idx.ID,
+		Filepath:   run.job.FilePath,
+		Filetype:   filepath.Ext(run.job.FilePath),
+		Filesize:   run.job.FileSize,
+		Filesha256: run.job.FileSha256,
+	})
+	if err != nil {
+		return sqlc.Document{}, fmt.Errorf("failed creating document in database: %w", err)
+	}
+
+	if err = addDocumentTags(ctx, txQueries, document.ID, run.tags); err != nil {
+		return sqlc.Document{}, err
+	}
+
+	run.job.DocumentID = sql.NullInt64{Int64: document.ID, Valid: true}
+
+	if err = run.save(ctx, txQueries, JobStage(run.job.Stage)); err != nil {
+		return sqlc.Document{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return sqlc.Document{}, err
+	}
+
+	return document, nil
+}
+
+func addDocumentTags(ctx context.Context, queries *sqlc.Queries, documentID int64, tags []string) error {
+	for _, tag := range tags {
+		err := queries.AddDocumentTag(ctx, sqlc.AddDocumentTagParams{
+			DocumentID: documentID,
+			Tag:        tag,
+		})
+		if err != nil {
+			return fmt.Errorf("failed adding tag to document: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// save stores the results of the job so far, as of the given stage.
+func (run *jobRun) save(ctx context.Context, queries *sqlc.Queries, stage JobStage) error {
+	var chunks sql.NullString
+	if run.chunks != nil {
+		data, err := json.Marshal(run.chunks)
+		if err != nil {
+			return err
+		}
+		chunks = sql.NullString{String: string(data), Valid: true}
+	}
+
+	err := queries.SaveIngestionJobProgress(ctx, sqlc.SaveIngestionJobProgressParams{
+		Stage:      string(stage),
+		Markdown:   run.job.Markdown,
+		Chunks:     chunks,
+		DocumentID: run.job.DocumentID,
+		ID:         run.job.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save ingestion job: %w", err)
+	}
+
+	run.job.Stage = string(stage)
+	run.job.Chunks = chunks
+
+	return nil
+}
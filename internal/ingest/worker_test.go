@@ -0,0 +1,164 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"testing"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/parser"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+)
+
+func TestReuseChunks(t *testing.T) {
+	previous := []sqlc.Chunk{
+		{IndexingID: "a", Content: "A", Context: "context A"},
+		{IndexingID: "b", Content: "B", Context: "context B"},
+		{IndexingID: "b2", Content: "B", Context: "context B2"},
+	}
+
+	tests := []struct {
+		name   string
+		chunks []parser.Chunk
+		want   []parser.Chunk
+	}{
+		{
+			name:   "unchanged chunks",
+			chunks: []parser.Chunk{{ID: "new-a", Content: "A"}, {ID: "new-b", Content: "B"}},
+			want:   []parser.Chunk{{ID: "a", Content: "A", Context: "context A"}, {ID: "b", Content: "B", Context: "context B"}},
+		},
+		{
+			name:   "changed chunk",
+			chunks: []parser.Chunk{{ID: "new-c", Content: "C"}, {ID: "new-a", Content: "A"}},
+			want:   []parser.Chunk{{ID: "new-c", Content: "C"}, {ID: "a", Content: "A", Context: "context A"}},
+		},
+		{
+			name:   "repeated content reuses each chunk once",
+			chunks: []parser.Chunk{{ID: "1", Content: "B"}, {ID: "2", Content: "B"}, {ID: "3", Content: "B"}},
+			want: []parser.Chunk{
+				{ID: "b", Content: "B", Context: "context B"},
+				{ID: "b2", Content: "B", Context: "context B2"},
+				{ID: "3", Content: "B"},
+			},
+		},
+		{
+			name:   "ordinals and pages are kept",
+			chunks: []parser.Chunk{{ID: "new-a", Content: "A", Page: 2, Ordinal: 5}},
+			want:   []parser.Chunk{{ID: "a", Content: "A", Context: "context A", Page: 2, Ordinal: 5}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := slices.Clone(tt.chunks)
+			reuseChunks(previous, chunks)
+			if !slices.Equal(chunks, tt.want) {
+				t.Errorf("reuseChunks() = %+v, want %+v", chunks, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameTags(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want bool
+	}{
+		{name: "no tags", want: true},
+		{name: "nil and empty", a: nil, b: []string{}, want: true},
+		{name: "different order", a: []string{"x", "y"}, b: []string{"y", "x"}, want: true},
+		{name: "repeated tag", a: []string{"x", "x"}, b: []string{"x"}, want: true},
+		{name: "added tag", a: []string{"x"}, b: []string{"x", "y"}},
+		{name: "different tag", a: []string{"x"}, b: []string{"y"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameTags(tt.a, tt.b); got != tt.want {
+				t.Errorf("sameTags(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangedChunks(t *testing.T) {
+	idx := newTestDB(t)
+	ctx := context.Background()
+
+	addTestDocument(t, idx, "a.md", []byte("# A\n"))
+	for _, stmt := range []string{
+		"INSERT INTO document_tags (document_id, tag) VALUES (1, 'x')",
+		"INSERT INTO chunks (document_id, content, context, indexing_id, page) VALUES (1, 'A', 'context A', 'a', 1)",
+		"INSERT INTO chunks (document_id, content, context, indexing_id, page) VALUES (1, 'B', 'context B', 'b', 1)",
+	} {
+		if _, err := db.MainDB.ExecContext(ctx, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	unchanged := parser.Chunk{ID: "a", Content: "A", Context: "context A", Page: 1}
+
+	tests := []struct {
+		name   string
+		tags   []string
+		chunks []parser.Chunk
+		// changed are the IDs of the chunks to embed again.
+		changed []string
+	}{
+		{
+			name:   "unchanged chunk",
+			tags:   []string{"x"},
+			chunks: []parser.Chunk{unchanged},
+		},
+		{
+			name:    "new chunk",
+			tags:    []string{"x"},
+			chunks:  []parser.Chunk{unchanged, {ID: "c", Content: "C"}},
+			changed: []string{"c"},
+		},
+		{
+			name:    "changed context",
+			tags:    []string{"x"},
+			chunks:  []parser.Chunk{unchanged, {ID: "b", Content: "B", Context: "new context", Page: 1}},
+			changed: []string{"b"},
+		},
+		{
+			name:    "changed page",
+			tags:    []string{"x"},
+			chunks:  []parser.Chunk{{ID: "a", Content: "A", Context: "context A", Page: 2}},
+			changed: []string{"a"},
+		},
+		{
+			name:    "changed tags",
+			tags:    []string{"x", "y"},
+			chunks:  []parser.Chunk{unchanged, {ID: "c", Content: "C"}},
+			changed: []string{"a", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := &jobRun{
+				job:    sqlc.IngestionJob{DocumentID: sql.NullInt64{Int64: 1, Valid: true}},
+				idx:    idx,
+				tags:   tt.tags,
+				chunks: tt.chunks,
+			}
+
+			chunks, err := run.changedChunks(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var changed []string
+			for _, chunk := range chunks {
+				changed = append(changed, chunk.ID)
+			}
+			if !slices.Equal(changed, tt.changed) {
+				t.Errorf("changedChunks() = %v, want %v", changed, tt.changed)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/spf13/viper"
+)
+
+// fileSHA256 encodes checksums like the documents table does, so cache
+// entries can be matched with documents.
+func fileSHA256(document []byte) string {
+	checksum := sha256.Sum256(document)
+	return base64.StdEncoding.EncodeToString(checksum[:])
+}
+
+// parseCacheSettings identifies the service and settings a document is
+// parsed with, so changing them parses documents again instead of using the
+// cache.
+func parseCacheSettings(service string, fields map[string]string) string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	h := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s=%s\n", key, fields[key])
+	}
+
+	return service + ":" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// lookupParseCache returns the cached parsing result of the document, if the
+// cache is enabled with document_parser.cache and has one.
+func lookupParseCache(ctx context.Context, fileSha256 string, settings string) (string, bool, error) {
+	if !viper.GetBool("document_parser.cache") {
+		return "", false, nil
+	}
+
+	queries := sqlc.New(db.MainDB)
+
+	entry, err := queries.GetParseCacheEntry(ctx, sqlc.GetParseCacheEntryParams{
+		FileSha256: fileSha256,
+		Settings:   settings,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to look up parse cache: %w", err)
+	}
+
+	err = queries.TouchParseCacheEntry(ctx, entry.ID)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to update parse cache entry: %w", err)
+	}
+
+	return entry.Markdown, true, nil
+}
+
+func storeParseCache(ctx context.Context, fileSha256 string, settings string, fileName string, result *JobMarkdownResultLlamaIndex) error {
+	if !viper.GetBool("document_parser.cache") {
+		return nil
+	}
+
+	queries := sqlc.New(db.MainDB)
+
+	err := queries.UpsertParseCacheEntry(ctx, sqlc.UpsertParseCacheEntryParams{
+		FileSha256:  fileSha256,
+		Settings:    settings,
+		FileName:    fileName,
+		Markdown:    result.Markdown,
+		Pages:       int64(result.JobMetadata.JobPages),
+		CreditsUsed: int64(result.JobMetadata.CreditsUsed),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store parse cache entry: %w", err)
+	}
+
+	return nil
+}
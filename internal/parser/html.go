@@ -0,0 +1,303 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// htmlParser converts HTML files to Markdown, keeping tables as HTML.
+type htmlParser struct{}
+
+func (htmlParser) Parse(ctx context.Context, document []byte, fileName string) (string, error) {
+	root, err := html.Parse(bytes.NewReader(document))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	w := new(markdownWriter)
+	w.children(root)
+
+	return strings.TrimSpace(w.buf.String()), nil
+}
+
+// markdownWriter renders an HTML tree as Markdown, collapsing whitespace
+// like a browser would.
+type markdownWriter struct {
+	buf bytes.Buffer
+	// space is set when whitespace was skipped after the last text.
+	space     bool
+	listDepth int
+	pre       bool
+}
+
+func (w *markdownWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.node(c)
+	}
+}
+
+func (w *markdownWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		w.children(n)
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Head, atom.Noscript, atom.Template, atom.Iframe, atom.Svg:
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		w.block()
+		w.buf.WriteString(strings.Repeat("#", int(n.Data[1]-'0')) + " ")
+		w.children(n)
+		w.block()
+	case atom.Br:
+		w.line()
+	case atom.Hr:
+		w.block()
+		w.buf.WriteString("---")
+		w.block()
+	case atom.Ul, atom.Ol:
+		if w.listDepth == 0 {
+			w.block()
+		}
+		w.listDepth++
+
+		number := 1
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.DataAtom != atom.Li {
+				w.node(c)
+				continue
+			}
+
+			w.line()
+			w.buf.WriteString(strings.Repeat("  ", w.listDepth-1))
+			if n.DataAtom == atom.Ol {
+				fmt.Fprintf(&w.buf, "%d. ", number)
+				number++
+			} else {
+				w.buf.WriteString("- ")
+			}
+			w.children(c)
+			w.line()
+		}
+
+		w.listDepth--
+		if w.listDepth == 0 {
+			w.block()
+		}
+	case atom.Blockquote:
+		quote := new(markdownWriter)
+		quote.children(n)
+
+		w.block()
+		for _, line := range strings.Split(strings.TrimSpace(quote.buf.String()), "\n") {
+			w.buf.WriteString(strings.TrimRight("> "+line, " ") + "\n")
+		}
+		w.block()
+	case atom.Pre:
+		w.block()
+		w.buf.WriteString("```\n")
+		w.pre = true
+		w.children(n)
+		w.pre = false
+		w.line()
+		w.buf.WriteString("```")
+		w.block()
+	case atom.Code:
+		if w.pre {
+			w.children(n)
+			return
+		}
+		w.inline(n, "`")
+	case atom.Strong, atom.B:
+		w.inline(n, "**")
+	case atom.Em, atom.I:
+		w.inline(n, "*")
+	case atom.A:
+		href := attr(n, "href")
+		text := strings.TrimSpace(textContent(n))
+		if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "javascript:") || text == "" {
+			w.children(n)
+			return
+		}
+		w.text(" ")
+		w.write(fmt.Sprintf("[%s](%s)", text, href))
+	case atom.Img:
+		if alt := attr(n, "alt"); alt != "" {
+			w.text(" " + alt + " ")
+		}
+	case atom.Table:
+		w.block()
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.DataAtom == atom.Caption {
+				w.text(textContent(c))
+				w.block()
+			}
+		}
+		w.buf.WriteString(htmlTableFromNode(n))
+		w.block()
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Header, atom.Footer, atom.Main, atom.Nav,
+		atom.Aside, atom.Figure, atom.Figcaption, atom.Address, atom.Dl, atom.Dt, atom.Dd, atom.Li:
+		w.block()
+		w.children(n)
+		w.block()
+	default:
+		w.children(n)
+	}
+}
+
+// inline wraps the text of n in marker, e.g. ** for bold text.
+func (w *markdownWriter) inline(n *html.Node, marker string) {
+	text := strings.Join(strings.Fields(textContent(n)), " ")
+	if text == "" {
+		return
+	}
+
+	w.text(" ")
+	w.write(marker + text + marker)
+}
+
+// text writes text with its whitespace collapsed, separated from the
+// previous text by a space if either had whitespace between them.
+func (w *markdownWriter) text(s string) {
+	if w.pre {
+		w.buf.WriteString(s)
+		return
+	}
+
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		w.space = w.space || s != ""
+		return
+	}
+
+	first, _ := utf8.DecodeRuneInString(s)
+	last, _ := utf8.DecodeLastRuneInString(s)
+
+	if unicode.IsSpace(first) {
+		w.space = true
+	}
+	w.write(strings.Join(words, " "))
+	w.space = unicode.IsSpace(last)
+}
+
+func (w *markdownWriter) write(s string) {
+	if w.space && !w.atLineStart() {
+		w.buf.WriteByte(' ')
+	}
+	w.buf.WriteString(s)
+	w.space = false
+}
+
+func (w *markdownWriter) atLineStart() bool {
+	out := w.buf.Bytes()
+	return len(out) == 0 || out[len(out)-1] == '\n' || out[len(out)-1] == ' '
+}
+
+// line ends the current line, if it isn't empty.
+func (w *markdownWriter) line() {
+	w.trimTrailingSpace()
+	if out := w.buf.Bytes(); len(out) > 0 && out[len(out)-1] != '\n' {
+		w.buf.WriteByte('\n')
+	}
+	w.space = false
+}
+
+// block separates the following content by an empty line.
+func (w *markdownWriter) block() {
+	w.line()
+	if out := w.buf.Bytes(); len(out) > 0 && !bytes.HasSuffix(out, []byte("\n\n")) {
+		w.buf.WriteByte('\n')
+	}
+}
+
+func (w *markdownWriter) trimTrailingSpace() {
+	out := w.buf.Bytes()
+	w.buf.Truncate(len(bytes.TrimRight(out, " \t")))
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+
+	return ""
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom == atom.Script || c.DataAtom == atom.Style {
+			continue
+		}
+		if c.DataAtom == atom.Br {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(textContent(c))
+	}
+
+	return sb.String()
+}
+
+// htmlTableFromNode renders a table with its attributes and formatting
+// stripped. Cells of nested tables end up in the cells containing them.
+func htmlTableFromNode(table *html.Node) string {
+	var (
+		rows   [][]string
+		header bool
+	)
+
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch c.DataAtom {
+			case atom.Tr:
+				var row []string
+				for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.DataAtom == atom.Td || cell.DataAtom == atom.Th {
+						row = append(row, textContent(cell))
+					}
+				}
+				if len(rows) == 0 && c.FirstChild != nil {
+					header = firstCellIsHeader(c)
+				}
+				rows = append(rows, row)
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				visit(c)
+			}
+		}
+	}
+	visit(table)
+
+	return htmlTable(rows, header)
+}
+
+func firstCellIsHeader(row *html.Node) bool {
+	for cell := row.FirstChild; cell != nil; cell = cell.NextSibling {
+		if cell.DataAtom == atom.Td {
+			return false
+		}
+		if cell.DataAtom == atom.Th {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,123 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// csvRowsPerTable limits the size of the tables a CSV file is split into, as
+// every table is transformed into text by the context LLM in one request.
+const csvRowsPerTable = 50
+
+var markdownTableDelimiterRegex = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+
+// textParser reads plain text and Markdown files as they are, converting
+// Markdown pipe tables to HTML.
+type textParser struct{}
+
+func (textParser) Parse(ctx context.Context, document []byte, fileName string) (string, error) {
+	return markdownTablesToHTML(decodeText(document)), nil
+}
+
+// decodeText strips the byte order mark and carriage returns, and replaces
+// invalid UTF-8.
+func decodeText(document []byte) string {
+	document = bytes.TrimPrefix(document, []byte("\xef\xbb\xbf"))
+	text := strings.ToValidUTF8(string(document), "\uFFFD")
+
+	return strings.ReplaceAll(text, "\r\n", "\n")
+}
+
+// markdownTablesToHTML replaces pipe tables, a header row followed by a
+// delimiter row like |---|---|, with HTML tables.
+func markdownTablesToHTML(text string) string {
+	lines := strings.Split(text, "\n")
+
+	var out []string
+	for i := 0; i < len(lines); i++ {
+		if i+1 >= len(lines) || !strings.Contains(lines[i], "|") || !markdownTableDelimiterRegex.MatchString(lines[i+1]) {
+			out = append(out, lines[i])
+			continue
+		}
+
+		rows := [][]string{splitMarkdownTableRow(lines[i])}
+		i += 2
+		for ; i < len(lines) && strings.Contains(lines[i], "|") && strings.TrimSpace(lines[i]) != ""; i++ {
+			rows = append(rows, splitMarkdownTableRow(lines[i]))
+		}
+		i--
+
+		out = append(out, htmlTable(rows, true))
+	}
+
+	return strings.Join(out, "\n")
+}
+
+func splitMarkdownTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+
+	cells := strings.Split(line, "|")
+	for i, cell := range cells {
+		cells[i] = strings.TrimSpace(cell)
+	}
+
+	return cells
+}
+
+// htmlTable renders the rows as an HTML table on a single line, the first row
+// as the header if header is set.
+func htmlTable(rows [][]string, header bool) string {
+	var sb strings.Builder
+
+	sb.WriteString("<table>")
+	for i, row := range rows {
+		cellTag := "td"
+		if header && i == 0 {
+			cellTag = "th"
+		}
+
+		sb.WriteString("<tr>")
+		for _, cell := range row {
+			cell = strings.Join(strings.Fields(cell), " ")
+			fmt.Fprintf(&sb, "<%s>%s</%s>", cellTag, html.EscapeString(cell), cellTag)
+		}
+		sb.WriteString("</tr>")
+	}
+	sb.WriteString("</table>")
+
+	return sb.String()
+}
+
+// csvParser converts CSV files to HTML tables of up to csvRowsPerTable rows,
+// each repeating the header row.
+type csvParser struct{}
+
+func (csvParser) Parse(ctx context.Context, document []byte, fileName string) (string, error) {
+	reader := csv.NewReader(strings.NewReader(decodeText(document)))
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("failed to parse CSV: %w", err)
+	}
+	if len(records) == 0 {
+		return "", nil
+	}
+
+	header, rows := records[0], records[1:]
+
+	var tables []string
+	for start := 0; start < len(rows) || start == 0; start += csvRowsPerTable {
+		end := min(start+csvRowsPerTable, len(rows))
+		tables = append(tables, htmlTable(append([][]string{header}, rows[start:end]...), true))
+	}
+
+	return strings.Join(tables, "\n\n"), nil
+}
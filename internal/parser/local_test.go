@@ -0,0 +1,65 @@
+package parser
+
+import "testing"
+
+func TestMarkdownTablesToHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "no table",
+			text: "# Title\n\nSome text | with a pipe.",
+			want: "# Title\n\nSome text | with a pipe.",
+		},
+		{
+			name: "table",
+			text: "| Name | Grade |\n|------|-------|\n| Ana | 5 |\n| Ivo | 4 |",
+			want: "<table><tr><th>Name</th><th>Grade</th></tr><tr><td>Ana</td><td>5</td></tr><tr><td>Ivo</td><td>4</td></tr></table>",
+		},
+		{
+			name: "table between paragraphs",
+			text: "Before.\n\n| a | b |\n| --- | --- |\n| 1 | 2 |\n\nAfter.",
+			want: "Before.\n\n<table><tr><th>a</th><th>b</th></tr><tr><td>1</td><td>2</td></tr></table>\n\nAfter.",
+		},
+		{
+			name: "table ended by a line without pipes",
+			text: "| a | b |\n|---|---|\n| 1 | 2 |\nAfter.",
+			want: "<table><tr><th>a</th><th>b</th></tr><tr><td>1</td><td>2</td></tr></table>\nAfter.",
+		},
+		{
+			name: "without outer pipes and with alignment",
+			text: "a | b\n:-- | --:\n1 | 2",
+			want: "<table><tr><th>a</th><th>b</th></tr><tr><td>1</td><td>2</td></tr></table>",
+		},
+		{
+			name: "header only",
+			text: "| a | b |\n|---|---|",
+			want: "<table><tr><th>a</th><th>b</th></tr></table>",
+		},
+		{
+			name: "cells are escaped and their whitespace collapsed",
+			text: "| <b>x</b> | a  &  b |\n|---|---|\n| 1 |  |",
+			want: "<table><tr><th>&lt;b&gt;x&lt;/b&gt;</th><th>a &amp; b</th></tr><tr><td>1</td><td></td></tr></table>",
+		},
+		{
+			name: "header without delimiter row",
+			text: "| a | b |\n| 1 | 2 |",
+			want: "| a | b |\n| 1 | 2 |",
+		},
+		{
+			name: "two tables",
+			text: "| a |\n|---|\n| 1 |\n\n| b |\n|---|\n| 2 |",
+			want: "<table><tr><th>a</th></tr><tr><td>1</td></tr></table>\n\n<table><tr><th>b</th></tr><tr><td>2</td></tr></table>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markdownTablesToHTML(tt.text); got != tt.want {
+				t.Errorf("markdownTablesToHTML() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
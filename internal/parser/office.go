@@ -0,0 +1,383 @@
+package parser
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var docxHeadingStyleRegex = regexp.MustCompile(`(?i)^heading ?(\d)$`)
+
+// docxParser extracts the text of Word documents from word/document.xml.
+// Page breaks, both explicit ones and the ones Word recorded when the
+// document was last laid out, separate pages.
+type docxParser struct{}
+
+func (docxParser) Parse(ctx context.Context, document []byte, fileName string) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(document), int64(len(document)))
+	if err != nil {
+		return "", fmt.Errorf("failed to open DOCX archive: %w", err)
+	}
+
+	headingLevels, err := docxHeadingLevels(archive)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := readZipFile(archive, "word/document.xml")
+	if err != nil {
+		return "", err
+	}
+
+	doc := new(officeDocument)
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+
+	inText := false
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse DOCX document: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				doc.startParagraph()
+			case "pStyle":
+				if level := headingLevels[xmlAttr(t, "val")]; level > 0 {
+					doc.prefix = strings.Repeat("#", level) + " "
+				}
+			case "outlineLvl":
+				if level, err := strconv.Atoi(xmlAttr(t, "val")); err == nil && level < 6 {
+					doc.prefix = strings.Repeat("#", level+1) + " "
+				}
+			case "numPr":
+				if doc.prefix == "" {
+					doc.prefix = "- "
+				}
+			case "t":
+				inText = true
+			case "tab":
+				doc.text(" ")
+			case "br":
+				if xmlAttr(t, "type") == "page" {
+					doc.pageBreak()
+				} else {
+					doc.text("\n")
+				}
+			case "lastRenderedPageBreak":
+				doc.pageBreak()
+			case "tbl":
+				doc.startTable()
+			case "tr":
+				doc.startRow()
+			case "tc":
+				doc.startCell()
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "p":
+				doc.endParagraph()
+			case "t":
+				inText = false
+			case "tc":
+				doc.endCell()
+			case "tr":
+				doc.endRow()
+			case "tbl":
+				doc.endTable()
+			}
+		case xml.CharData:
+			if inText {
+				doc.text(string(t))
+			}
+		}
+	}
+
+	return doc.String(), nil
+}
+
+// docxHeadingLevels maps the IDs of heading styles to their level. Style IDs
+// are localized, e.g. "Naslov1" in Croatian, while their names are not.
+func docxHeadingLevels(archive *zip.Reader) (map[string]int, error) {
+	levels := make(map[string]int)
+
+	content, err := readZipFile(archive, "word/styles.xml")
+	if err != nil {
+		return levels, nil
+	}
+
+	var styles struct {
+		Styles []struct {
+			ID   string `xml:"styleId,attr"`
+			Name struct {
+				Val string `xml:"val,attr"`
+			} `xml:"name"`
+		} `xml:"style"`
+	}
+	if err := xml.Unmarshal(content, &styles); err != nil {
+		return nil, fmt.Errorf("failed to parse DOCX styles: %w", err)
+	}
+
+	for _, style := range styles.Styles {
+		if strings.EqualFold(style.Name.Val, "title") {
+			levels[style.ID] = 1
+		} else if match := docxHeadingStyleRegex.FindStringSubmatch(style.Name.Val); match != nil {
+			levels[style.ID], _ = strconv.Atoi(match[1])
+		}
+	}
+
+	return levels, nil
+}
+
+// odtParser extracts the text of OpenDocument text documents from
+// content.xml. Soft page breaks, recorded when the document was last laid
+// out, separate pages.
+type odtParser struct{}
+
+func (odtParser) Parse(ctx context.Context, document []byte, fileName string) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(document), int64(len(document)))
+	if err != nil {
+		return "", fmt.Errorf("failed to open ODT archive: %w", err)
+	}
+
+	content, err := readZipFile(archive, "content.xml")
+	if err != nil {
+		return "", err
+	}
+
+	doc := new(officeDocument)
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+
+	var (
+		listDepth int
+		// listItem is set until the first paragraph of a list item starts.
+		listItem bool
+	)
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse ODT document: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p", "h":
+				doc.startParagraph()
+				if level, err := strconv.Atoi(xmlAttr(t, "outline-level")); err == nil && t.Name.Local == "h" {
+					doc.prefix = strings.Repeat("#", min(max(level, 1), 6)) + " "
+				} else if listItem {
+					doc.prefix = strings.Repeat("  ", max(listDepth-1, 0)) + "- "
+					listItem = false
+				}
+			case "list":
+				listDepth++
+			case "list-item":
+				listItem = true
+			case "s":
+				count, err := strconv.Atoi(xmlAttr(t, "c"))
+				if err != nil {
+					count = 1
+				}
+				doc.text(strings.Repeat(" ", count))
+			case "tab":
+				doc.text(" ")
+			case "line-break":
+				doc.text("\n")
+			case "soft-page-break":
+				doc.pageBreak()
+			case "table":
+				doc.startTable()
+			case "table-row":
+				doc.startRow()
+			case "table-cell":
+				doc.startCell()
+			case "note", "annotation", "tracked-changes":
+				if err := decoder.Skip(); err != nil {
+					return "", fmt.Errorf("failed to parse ODT document: %w", err)
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "p", "h":
+				doc.endParagraph()
+			case "list":
+				listDepth--
+			case "table-cell":
+				doc.endCell()
+			case "table-row":
+				doc.endRow()
+			case "table":
+				doc.endTable()
+			}
+		case xml.CharData:
+			doc.text(string(t))
+		}
+	}
+
+	return doc.String(), nil
+}
+
+// officeDocument collects the paragraphs and tables of a word processor
+// document as Markdown.
+type officeDocument struct {
+	out       strings.Builder
+	paragraph strings.Builder
+	// prefix marks the current paragraph as a heading or list item.
+	prefix string
+	// pendingPageBreak is set when a page break occurred within the current
+	// paragraph, which is kept on the page it started on.
+	pendingPageBreak bool
+
+	tableDepth int
+	rows       [][]string
+	row        []string
+	cell       strings.Builder
+}
+
+func (d *officeDocument) startParagraph() {
+	d.paragraph.Reset()
+	d.prefix = ""
+}
+
+func (d *officeDocument) text(s string) {
+	d.paragraph.WriteString(s)
+}
+
+func (d *officeDocument) endParagraph() {
+	text := strings.TrimSpace(d.paragraph.String())
+	d.paragraph.Reset()
+
+	if d.tableDepth > 0 {
+		if text != "" {
+			d.cell.WriteString(text + " ")
+		}
+		return
+	}
+
+	if text != "" {
+		d.block(d.prefix + text)
+	}
+
+	if d.pendingPageBreak {
+		d.pendingPageBreak = false
+		d.writePageSeparator()
+	}
+}
+
+func (d *officeDocument) pageBreak() {
+	if d.tableDepth > 0 || strings.TrimSpace(d.paragraph.String()) != "" {
+		d.pendingPageBreak = true
+		return
+	}
+
+	d.writePageSeparator()
+}
+
+func (d *officeDocument) writePageSeparator() {
+	current := strings.TrimRight(d.out.String(), "\n")
+	d.out.Reset()
+	d.out.WriteString(current)
+	d.out.WriteString(PARSING_PAGE_SEPARATOR)
+}
+
+func (d *officeDocument) block(text string) {
+	if out := d.out.String(); out != "" && !strings.HasSuffix(out, "\n") {
+		d.out.WriteString("\n\n")
+	}
+	d.out.WriteString(text)
+}
+
+func (d *officeDocument) startTable() {
+	d.tableDepth++
+	if d.tableDepth == 1 {
+		d.rows = nil
+	}
+}
+
+func (d *officeDocument) startRow() {
+	if d.tableDepth == 1 {
+		d.row = nil
+	}
+}
+
+func (d *officeDocument) startCell() {
+	if d.tableDepth == 1 {
+		d.cell.Reset()
+	}
+}
+
+// endCell adds the cell to the row. Cells of nested tables stay in the cell
+// containing them.
+func (d *officeDocument) endCell() {
+	if d.tableDepth == 1 {
+		d.row = append(d.row, d.cell.String())
+	}
+}
+
+func (d *officeDocument) endRow() {
+	if d.tableDepth == 1 {
+		d.rows = append(d.rows, d.row)
+	}
+}
+
+func (d *officeDocument) endTable() {
+	d.tableDepth--
+	if d.tableDepth > 0 {
+		return
+	}
+
+	if len(d.rows) > 0 {
+		d.block(htmlTable(d.rows, true))
+	}
+
+	if d.pendingPageBreak {
+		d.pendingPageBreak = false
+		d.writePageSeparator()
+	}
+}
+
+func (d *officeDocument) String() string {
+	return strings.TrimSpace(d.out.String())
+}
+
+func readZipFile(archive *zip.Reader, name string) ([]byte, error) {
+	file, err := archive.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s in archive: %w", name, err)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s in archive: %w", name, err)
+	}
+
+	return content, nil
+}
+
+func xmlAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+
+	return ""
+}
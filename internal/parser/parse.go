@@ -7,8 +7,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"mime/multipart"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	db "github.com/OptimusePrime/petagpt/internal/db"
@@ -35,14 +38,10 @@ type LlamaIndexParsingStatusResponse struct {
 	ErrorMessage string                  `json:"error_message"`
 }
 
-type LlamaIndexJobStatusRequest struct {
-	JobID string `json:"job_id"`
-}
-
 const PARSING_PAGE_SEPARATOR = "\n@@RieSDIh6U5htthJY@@\n"
 
 func ProcessDocument(ctx context.Context, document []byte, fileName string, dc *DocumentChunker, chunkSize int, requestDelay int) ([]Chunk, error) {
-	doc, err := parseDocument(ctx, document, fileName)
+	doc, err := ParseDocument(ctx, document, fileName)
 	if err != nil {
 		return nil, err
 	}
@@ -55,36 +54,155 @@ func ProcessDocument(ctx context.Context, document []byte, fileName string, dc *
 	return chunks, nil
 }
 
-func parseDocument(ctx context.Context, document []byte, fileName string) (string, error) {
-	resp, err := uploadDocumentLlamaIndex(ctx, document, fileName)
+// ParseDocument parses the document with the parser configured for its file
+// type.
+func ParseDocument(ctx context.Context, document []byte, fileName string) (string, error) {
+	documentParser, err := NewDocumentParser(fileName)
 	if err != nil {
 		return "", err
 	}
 
-	status, err := waitJobDoneLlamaIndex(ctx, resp.ID)
-	if err != nil || status != STATUS_SUCCESS {
+	return documentParser.Parse(ctx, document, fileName)
+}
+
+// llamaIndexParser parses documents with LlamaIndex Cloud.
+type llamaIndexParser struct{}
+
+func (p llamaIndexParser) Parse(ctx context.Context, document []byte, fileName string) (string, error) {
+	return p.parse(ctx, document, fileName, llamaIndexParsingFields())
+}
+
+// ParsePages parses only the given pages of a PDF, see pagesParser.
+func (p llamaIndexParser) ParsePages(ctx context.Context, document []byte, fileName string, pages []int) ([]string, error) {
+	targetPages := make([]string, len(pages))
+	for i, page := range pages {
+		targetPages[i] = strconv.Itoa(page - 1)
+	}
+
+	fields := llamaIndexParsingFields()
+	fields["target_pages"] = strings.Join(targetPages, ",")
+	// Tables can't continue across pages which aren't adjacent, and merging
+	// them would change the number of pages returned.
+	fields["merge_tables_across_pages_in_markdown"] = "false"
+
+	markdown, err := p.parse(ctx, document, fileName, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := strings.Split(markdown, PARSING_PAGE_SEPARATOR)
+	if len(parsed) != len(pages) {
+		return nil, fmt.Errorf("expected %d parsed pages, got %d", len(pages), len(parsed))
+	}
+
+	return parsed, nil
+}
+
+func (llamaIndexParser) parse(ctx context.Context, document []byte, fileName string, fields map[string]string) (string, error) {
+	checksum := fileSHA256(document)
+	settings := parseCacheSettings(SERVICE_LLAMA_INDEX, fields)
+
+	markdown, ok, err := lookupParseCache(ctx, checksum, settings)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return markdown, nil
+	}
+
+	resp, err := uploadDocumentLlamaIndex(ctx, document, fileName, fields)
+	if err != nil {
+		return "", err
+	}
+
+	err = waitJobDoneLlamaIndex(ctx, resp.ID)
+	if err != nil {
 		return "", fmt.Errorf("wait job failed: %w", err)
 	}
 
-	jobResult, err := getJobMarkdownResultLlamaIndex(resp.ID)
+	jobResult, err := getJobMarkdownResultLlamaIndex(ctx, resp.ID)
 	if err != nil {
 		return "", fmt.Errorf("markdown result failed: %w", err)
 	}
 
+	err = storeParseCache(ctx, checksum, settings, fileName, jobResult)
+	if err != nil {
+		return "", err
+	}
+
 	return jobResult.Markdown, nil
 }
 
-func uploadDocumentLlamaIndex(ctx context.Context, document []byte, fileName string) (*LlamaIndexParsingStatusResponse, error) {
-	reqBody := new(bytes.Buffer)
+// LlamaIndexJobError is returned for parsing jobs which ended with
+// STATUS_ERROR or STATUS_CANCELLED.
+type LlamaIndexJobError struct {
+	JobID        string
+	Status       LlamaIndexParsingStatus
+	ErrorCode    string
+	ErrorMessage string
+}
 
-	multipartWriter := multipart.NewWriter(reqBody)
+func (e *LlamaIndexJobError) Error() string {
+	return fmt.Sprintf("parsing job %s ended with status %s: %s (%s)", e.JobID, e.Status, e.ErrorMessage, e.ErrorCode)
+}
+
+func llamaIndexAPIBase() string {
+	if apiBase := viper.GetString("document_parser.api_base"); apiBase != "" {
+		return strings.TrimSuffix(apiBase, "/")
+	}
+
+	return LLAMA_INDEX_API_BASE
+}
+
+// doLlamaIndexRequest sends an authorized request to the LlamaIndex API and
+// decodes the JSON response into result.
+func doLlamaIndexRequest(client *http.Client, req *http.Request, result any) (err error) {
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", viper.GetString("document_parser.api_key")))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, resp.Body.Close())
+	}()
 
-	fields := map[string]string{
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response status %s: %s", resp.Status, respBytes)
+	}
+
+	return json.Unmarshal(respBytes, result)
+}
+
+// llamaIndexParsingFields are the parsing settings sent with every upload.
+func llamaIndexParsingFields() map[string]string {
+	return map[string]string{
 		"page_separator":                        PARSING_PAGE_SEPARATOR,
 		"output_tables_as_HTML":                 "true",
 		"merge_tables_across_pages_in_markdown": "true",
 		"tier":                                  "agentic",
 	}
+}
+
+func uploadDocumentLlamaIndex(ctx context.Context, document []byte, fileName string, fields map[string]string) (*LlamaIndexParsingStatusResponse, error) {
+	reqBody := new(bytes.Buffer)
+
+	multipartWriter := multipart.NewWriter(reqBody)
+
+	fields = maps.Clone(fields)
+
+	webhook, err := webhookURL()
+	if err != nil {
+		return nil, err
+	}
+	if webhook != "" {
+		fields["webhook_url"] = webhook
+	}
 
 	for field, value := range fields {
 		err := multipartWriter.WriteField(field, value)
@@ -107,102 +225,89 @@ func uploadDocumentLlamaIndex(ctx context.Context, document []byte, fileName str
 		return nil, err
 	}
 
-	fmt.Println(reqBody.Len())
-
 	client := &http.Client{}
 
-	apiPath := LLAMA_INDEX_API_BASE + "/parsing/upload"
+	apiPath := llamaIndexAPIBase() + "/parsing/upload"
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiPath, reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create HTTP request for document parsing: %w", err)
 	}
-	fmt.Println(viper.GetString("document_parser.api_key"))
 	req.Header.Set("Content-Type", multipartWriter.FormDataContentType())
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", viper.GetString("document_parser.api_key")))
-
-	resp, err := client.Do(req)
-
-	if err != nil || resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to upload file for document parsing: %w (%s)", err, resp.Status)
-	}
-	defer func() {
-		err = errors.Join(err, resp.Body.Close())
-	}()
-
-	respBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	fmt.Println(string(respBytes))
 
 	parsingStatus := new(LlamaIndexParsingStatusResponse)
-	err = json.Unmarshal(respBytes, parsingStatus)
+	err = doLlamaIndexRequest(client, req, parsingStatus)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to upload file for document parsing: %w", err)
 	}
 
 	return parsingStatus, nil
 }
 
-func checkJobStatusLlamaIndex(jobId string) (*LlamaIndexParsingStatusResponse, error) {
+func checkJobStatusLlamaIndex(ctx context.Context, jobId string) (*LlamaIndexParsingStatusResponse, error) {
 	client := &http.Client{
 		Timeout: 15 * time.Second,
 	}
 
-	getJobReq := LlamaIndexJobStatusRequest{
-		JobID: jobId,
-	}
-
-	jsonBytes, err := json.Marshal(getJobReq)
-	if err != nil {
-		return nil, err
-	}
-
-	apiPath := LLAMA_INDEX_API_BASE + fmt.Sprintf("/parsing/job/%s", jobId)
+	apiPath := llamaIndexAPIBase() + fmt.Sprintf("/parsing/job/%s", jobId)
 
-	req, err := http.NewRequest(http.MethodGet, apiPath, bytes.NewReader(jsonBytes))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiPath, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create HTTP request for checking parsing job status: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", viper.Get("document_parser.api_key")))
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	respBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
 
 	parsingStatus := new(LlamaIndexParsingStatusResponse)
-	err = json.Unmarshal(respBytes, parsingStatus)
+	err = doLlamaIndexRequest(client, req, parsingStatus)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to check parsing job status: %w", err)
 	}
 
 	return parsingStatus, nil
 }
 
-func waitJobDoneLlamaIndex(ctx context.Context, jobId string) (LlamaIndexParsingStatus, error) {
+// waitJobDoneLlamaIndex waits until the job is done, checking its status when
+// the webhook for it arrives, and otherwise polling with exponential backoff
+// from document_parser.poll_interval up to document_parser.max_poll_interval.
+func waitJobDoneLlamaIndex(ctx context.Context, jobId string) error {
+	done := jobDone(jobId)
+	defer forgetJob(jobId)
+
+	interval := max(viper.GetDuration("document_parser.poll_interval"), 100*time.Millisecond)
+	maxInterval := max(viper.GetDuration("document_parser.max_poll_interval"), interval)
+
 	for {
-		status, err := checkJobStatusLlamaIndex(jobId)
+		status, err := checkJobStatusLlamaIndex(ctx, jobId)
 		if err != nil {
-			return "", err
+			return err
 		}
 
-		if status.Status == STATUS_SUCCESS {
-			return STATUS_SUCCESS, nil
+		switch status.Status {
+		case STATUS_SUCCESS, STATUS_PARTIAL_SUCCESS:
+			return nil
+		case STATUS_ERROR, STATUS_CANCELLED:
+			return &LlamaIndexJobError{
+				JobID:        jobId,
+				Status:       status.Status,
+				ErrorCode:    status.ErrorCode,
+				ErrorMessage: status.ErrorMessage,
+			}
 		}
 
-		if deadline, ok := ctx.Deadline(); ok && time.Now().After(deadline) {
-			return status.Status, context.DeadlineExceeded
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-done:
+			timer.Stop()
+			// The job should be done now, but if it isn't, fall back to
+			// polling.
+			done = nil
+			continue
+		case <-timer.C:
 		}
 
-		time.Sleep(3 * time.Second)
+		interval = min(interval*2, maxInterval)
 	}
 }
 
@@ -217,50 +322,29 @@ type JobMarkdownResultLlamaIndex struct {
 	} `json:"job_metadata"`
 }
 
-func getJobMarkdownResultLlamaIndex(jobId string) (*JobMarkdownResultLlamaIndex, error) {
+func getJobMarkdownResultLlamaIndex(ctx context.Context, jobId string) (*JobMarkdownResultLlamaIndex, error) {
 	client := &http.Client{
 		Timeout: 15 * time.Second,
 	}
 
-	getJobReq := LlamaIndexJobStatusRequest{
-		JobID: jobId,
-	}
-
-	jsonBytes, err := json.Marshal(getJobReq)
-	if err != nil {
-		return nil, err
-	}
-
-	apiPath := LLAMA_INDEX_API_BASE + fmt.Sprintf("/parsing/job/%s/result/markdown", jobId)
+	apiPath := llamaIndexAPIBase() + fmt.Sprintf("/parsing/job/%s/result/markdown", jobId)
 
-	req, err := http.NewRequest(http.MethodGet, apiPath, bytes.NewReader(jsonBytes))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiPath, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create HTTP request for getting parsing job result: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", viper.Get("document_parser.api_key")))
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	respBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
 
 	jobResult := new(JobMarkdownResultLlamaIndex)
-	err = json.Unmarshal(respBytes, jobResult)
+	err = doLlamaIndexRequest(client, req, jobResult)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to get parsing job result: %w", err)
 	}
 
 	return jobResult, nil
 }
 
 func saveJobResultLlamaIndex(ctx context.Context, jobId string, indexId int, documentId int) error {
-	_, err := getJobMarkdownResultLlamaIndex(jobId)
+	_, err := getJobMarkdownResultLlamaIndex(ctx, jobId)
 	if err != nil {
 		return err
 	}
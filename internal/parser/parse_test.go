@@ -0,0 +1,217 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// fakeLlamaIndex serves the job status endpoint, answering with statuses in
+// order and repeating the last one.
+type fakeLlamaIndex struct {
+	mu       sync.Mutex
+	statuses []LlamaIndexParsingStatusResponse
+	requests []time.Time
+}
+
+func (f *fakeLlamaIndex) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path != "/parsing/job/job" || r.Header.Get("Authorization") != "Bearer key" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	status := f.statuses[min(len(f.requests), len(f.statuses)-1)]
+	f.requests = append(f.requests, time.Now())
+
+	if status.Status == "" {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+func (f *fakeLlamaIndex) requestTimes() []time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]time.Time(nil), f.requests...)
+}
+
+func newFakeLlamaIndex(t *testing.T, statuses ...LlamaIndexParsingStatusResponse) *fakeLlamaIndex {
+	t.Helper()
+
+	fake := &fakeLlamaIndex{statuses: statuses}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	viper.Set("document_parser.api_base", server.URL)
+	viper.Set("document_parser.api_key", "key")
+	t.Cleanup(func() {
+		viper.Set("document_parser.api_base", "")
+		viper.Set("document_parser.api_key", "")
+	})
+
+	return fake
+}
+
+func TestWaitJobDoneLlamaIndex(t *testing.T) {
+	pending := LlamaIndexParsingStatusResponse{ID: "job", Status: STATUS_PENDING}
+
+	tests := []struct {
+		name     string
+		statuses []LlamaIndexParsingStatusResponse
+		webhook  bool
+		requests int
+		jobErr   *LlamaIndexJobError
+		err      bool
+	}{
+		{
+			name:     "success",
+			statuses: []LlamaIndexParsingStatusResponse{{ID: "job", Status: STATUS_SUCCESS}},
+			requests: 1,
+		},
+		{
+			name:     "partial success after polling",
+			statuses: []LlamaIndexParsingStatusResponse{pending, pending, {ID: "job", Status: STATUS_PARTIAL_SUCCESS}},
+			requests: 3,
+		},
+		{
+			name: "error",
+			statuses: []LlamaIndexParsingStatusResponse{pending, {
+				ID:           "job",
+				Status:       STATUS_ERROR,
+				ErrorCode:    "PDF_IS_BROKEN",
+				ErrorMessage: "the PDF is broken",
+			}},
+			requests: 2,
+			jobErr: &LlamaIndexJobError{
+				JobID:        "job",
+				Status:       STATUS_ERROR,
+				ErrorCode:    "PDF_IS_BROKEN",
+				ErrorMessage: "the PDF is broken",
+			},
+		},
+		{
+			name:     "cancelled",
+			statuses: []LlamaIndexParsingStatusResponse{{ID: "job", Status: STATUS_CANCELLED, ErrorMessage: "cancelled by user"}},
+			requests: 1,
+			jobErr: &LlamaIndexJobError{
+				JobID:        "job",
+				Status:       STATUS_CANCELLED,
+				ErrorMessage: "cancelled by user",
+			},
+		},
+		{
+			name:     "status request fails",
+			statuses: []LlamaIndexParsingStatusResponse{pending, {}},
+			requests: 2,
+			err:      true,
+		},
+		{
+			name:     "webhook ends the wait",
+			statuses: []LlamaIndexParsingStatusResponse{pending, {ID: "job", Status: STATUS_SUCCESS}},
+			webhook:  true,
+			requests: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeLlamaIndex(t, tt.statuses...)
+
+			interval := 10 * time.Millisecond
+			if tt.webhook {
+				// Only the webhook can end the wait within the timeout.
+				interval = time.Minute
+			}
+			viper.Set("document_parser.poll_interval", interval)
+			viper.Set("document_parser.max_poll_interval", interval)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			if tt.webhook {
+				go func() {
+					for len(fake.requestTimes()) == 0 {
+						time.Sleep(time.Millisecond)
+					}
+					notifyJobDone("job")
+				}()
+			}
+
+			err := waitJobDoneLlamaIndex(ctx, "job")
+
+			var jobErr *LlamaIndexJobError
+			switch {
+			case tt.jobErr != nil:
+				if !errors.As(err, &jobErr) {
+					t.Fatalf("err = %v, want a LlamaIndexJobError", err)
+				}
+				if *jobErr != *tt.jobErr {
+					t.Errorf("err = %+v, want %+v", *jobErr, *tt.jobErr)
+				}
+			case tt.err:
+				if err == nil || errors.As(err, &jobErr) {
+					t.Errorf("err = %v, want a request error", err)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := len(fake.requestTimes()); got != tt.requests {
+				t.Errorf("requests = %d, want %d", got, tt.requests)
+			}
+		})
+	}
+}
+
+func TestWaitJobDoneLlamaIndexBackoff(t *testing.T) {
+	pending := LlamaIndexParsingStatusResponse{ID: "job", Status: STATUS_PENDING}
+	fake := newFakeLlamaIndex(t, pending, pending, pending, pending, LlamaIndexParsingStatusResponse{ID: "job", Status: STATUS_SUCCESS})
+
+	// Intervals below 100ms are raised to 100ms.
+	viper.Set("document_parser.poll_interval", 50*time.Millisecond)
+	viper.Set("document_parser.max_poll_interval", 400*time.Millisecond)
+
+	if err := waitJobDoneLlamaIndex(context.Background(), "job"); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := fake.requestTimes()
+	if len(requests) != 5 {
+		t.Fatalf("requests = %d, want 5", len(requests))
+	}
+
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 400 * time.Millisecond}
+	for i, interval := range want {
+		got := requests[i+1].Sub(requests[i])
+		if got < interval || got > 2*interval {
+			t.Errorf("interval %d = %s, want %s", i, got, interval)
+		}
+	}
+}
+
+func TestWaitJobDoneLlamaIndexCancelled(t *testing.T) {
+	newFakeLlamaIndex(t, LlamaIndexParsingStatusResponse{ID: "job", Status: STATUS_PENDING})
+
+	viper.Set("document_parser.poll_interval", time.Minute)
+	viper.Set("document_parser.max_poll_interval", time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := waitJobDoneLlamaIndex(ctx, "job"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
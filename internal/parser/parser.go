@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	SERVICE_LLAMA_INDEX = "llama_index"
+	SERVICE_LOCAL       = "local"
+)
+
+// DocumentParser converts a document to Markdown, with pages separated by
+// PARSING_PAGE_SEPARATOR and every table as HTML on a single line, which is
+// the format DocumentChunker.Chunk expects.
+type DocumentParser interface {
+	Parse(ctx context.Context, document []byte, fileName string) (string, error)
+}
+
+// localParsers are the parsers which run locally, by file extension.
+var localParsers = map[string]DocumentParser{
+	".txt":      textParser{},
+	".md":       textParser{},
+	".markdown": textParser{},
+	".html":     htmlParser{},
+	".htm":      htmlParser{},
+	".csv":      csvParser{},
+	".docx":     docxParser{},
+	".odt":      odtParser{},
+	".pdf":      pdfParser{},
+}
+
+// NewDocumentParser returns the parser for a file. The service is read from
+// document_parser.extensions.<extension without the dot>, and defaults to
+// the local parser for formats which have one, since they need no OCR, and
+// to document_parser.service for the others.
+func NewDocumentParser(fileName string) (DocumentParser, error) {
+	ext := strings.ToLower(filepath.Ext(fileName))
+
+	service := viper.GetString("document_parser.extensions." + strings.TrimPrefix(ext, "."))
+	if service == "" {
+		if _, ok := localParsers[ext]; ok {
+			service = SERVICE_LOCAL
+		} else {
+			service = viper.GetString("document_parser.service")
+		}
+	}
+
+	switch service {
+	case SERVICE_LOCAL:
+		parser, ok := localParsers[ext]
+		if !ok {
+			return nil, fmt.Errorf("no local parser for file type: %s", ext)
+		}
+		return parser, nil
+	default:
+		return newRemoteParser(service)
+	}
+}
+
+func newRemoteParser(service string) (DocumentParser, error) {
+	switch service {
+	case SERVICE_LLAMA_INDEX:
+		return llamaIndexParser{}, nil
+	default:
+		return nil, fmt.Errorf("unknown document parser service: %s", service)
+	}
+}
@@ -0,0 +1,390 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+	"github.com/spf13/viper"
+)
+
+// Layout thresholds, relative to the font size.
+const (
+	pdfLineTolerance = 0.5
+	pdfWordGap       = 0.2
+	pdfColumnGap     = 2.0
+	pdfParagraphGap  = 1.8
+	// pdfGlyphWidth estimates the width of glyphs whose width is unknown,
+	// which is the case for most fonts with two byte character codes.
+	pdfGlyphWidth = 0.5
+)
+
+// pdfParser extracts the text layer of PDFs page by page, detecting tables by
+// the alignment of text into columns. Pages which have images but no text,
+// like scanned ones, are parsed by document_parser.service instead. Only those
+// pages are sent if the service supports it, otherwise the whole PDF is.
+type pdfParser struct{}
+
+// pagesParser is implemented by remote parsers which can parse a subset of the
+// pages of a PDF.
+type pagesParser interface {
+	// ParsePages returns the Markdown of the given pages, numbered from 1, in
+	// the same order.
+	ParsePages(ctx context.Context, document []byte, fileName string, pages []int) ([]string, error)
+}
+
+func (pdfParser) Parse(ctx context.Context, document []byte, fileName string) (string, error) {
+	pages, scanned, err := extractPDFPages(document)
+	if err != nil {
+		return "", err
+	}
+
+	if len(scanned) > 0 {
+		fallback, err := newRemoteParser(viper.GetString("document_parser.service"))
+		if err != nil {
+			return "", fmt.Errorf("page %d has no text and no remote parser is available: %w", scanned[0], err)
+		}
+
+		remote, ok := fallback.(pagesParser)
+		if !ok {
+			return fallback.Parse(ctx, document, fileName)
+		}
+
+		parsed, err := remote.ParsePages(ctx, document, fileName, scanned)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse pages without text: %w", err)
+		}
+
+		for i, page := range scanned {
+			pages[page-1] = parsed[i]
+		}
+	}
+
+	return strings.Join(pages, PARSING_PAGE_SEPARATOR), nil
+}
+
+// extractPDFPages returns the text of every page, and the numbers of the pages
+// without text which need OCR.
+func extractPDFPages(document []byte) (pages []string, scanned []int, err error) {
+	// The pdf package panics on malformed documents.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to read PDF: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			// Kept empty, so pages stay at their number.
+			pages = append(pages, "")
+			continue
+		}
+
+		text := layoutPDFPage(withoutTJMarkers(page, page.Content().Text))
+		if text == "" && pdfPageHasImages(page) {
+			scanned = append(scanned, i)
+		}
+
+		pages = append(pages, text)
+	}
+
+	return pages, scanned, nil
+}
+
+// withoutTJMarkers removes the newline the pdf package shows after every TJ
+// operator, decoded by the font of the text, e.g. to Ω in TeX fonts.
+func withoutTJMarkers(page pdf.Page, glyphs []pdf.Text) []pdf.Text {
+	markers := make(map[string]string)
+	for _, name := range page.Fonts() {
+		font := page.Font(name)
+
+		baseFont := font.BaseFont()
+		if i := strings.Index(baseFont, "+"); i >= 0 {
+			baseFont = baseFont[i+1:]
+		}
+		markers[baseFont] = font.Encoder().Decode("\n")
+	}
+
+	var filtered []pdf.Text
+	for _, glyph := range glyphs {
+		if glyph.S == "\n" || glyph.S == markers[glyph.Font] {
+			continue
+		}
+		filtered = append(filtered, glyph)
+	}
+
+	return filtered
+}
+
+func pdfPageHasImages(page pdf.Page) bool {
+	return pdfResourcesHaveImages(page.Resources(), 0)
+}
+
+// pdfResourcesHaveImages reports whether the resources have an Image XObject,
+// directly or within the resources of a Form XObject. Forms without images,
+// like logos or page decorations drawn as vectors, don't count.
+func pdfResourcesHaveImages(resources pdf.Value, depth int) bool {
+	// Forms can nest, and malformed ones can even refer to themselves.
+	if depth > 4 {
+		return false
+	}
+
+	xObjects := resources.Key("XObject")
+	for _, key := range xObjects.Keys() {
+		xObject := xObjects.Key(key)
+
+		switch xObject.Key("Subtype").Name() {
+		case "Image":
+			return true
+		case "Form":
+			if pdfResourcesHaveImages(xObject.Key("Resources"), depth+1) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+type pdfCell struct {
+	x0, x1 float64
+	text   string
+}
+
+type pdfLine struct {
+	y, size float64
+	cells   []pdfCell
+}
+
+// layoutPDFPage groups the glyphs of a page into lines, and the glyphs of a
+// line into cells separated by wide gaps. Consecutive lines whose cells line
+// up in columns become tables.
+func layoutPDFPage(glyphs []pdf.Text) string {
+	lines := pdfLines(glyphs)
+
+	var (
+		blocks    []string
+		paragraph []string
+	)
+
+	flush := func() {
+		if len(paragraph) > 0 {
+			blocks = append(blocks, strings.Join(paragraph, "\n"))
+			paragraph = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		if rows, n := pdfTable(lines[i:]); n > 0 {
+			flush()
+			blocks = append(blocks, htmlTable(rows, true))
+			i += n - 1
+			continue
+		}
+
+		if i > 0 && lines[i-1].y-lines[i].y > pdfParagraphGap*lines[i].size {
+			flush()
+		}
+
+		var texts []string
+		for _, cell := range lines[i].cells {
+			texts = append(texts, cell.text)
+		}
+		paragraph = append(paragraph, strings.Join(texts, " "))
+	}
+	flush()
+
+	return strings.Join(blocks, "\n\n")
+}
+
+func pdfLines(glyphs []pdf.Text) []pdfLine {
+	glyphs = append([]pdf.Text(nil), glyphs...)
+	sort.SliceStable(glyphs, func(i, j int) bool {
+		return glyphs[i].Y > glyphs[j].Y
+	})
+
+	var (
+		lines []pdfLine
+		start int
+	)
+	for i := range glyphs {
+		size := pdfFontSize(glyphs[start])
+		if i > start && math.Abs(glyphs[i].Y-glyphs[start].Y) > pdfLineTolerance*size {
+			if line, ok := newPDFLine(glyphs[start:i]); ok {
+				lines = append(lines, line)
+			}
+			start = i
+		}
+	}
+	if start < len(glyphs) {
+		if line, ok := newPDFLine(glyphs[start:]); ok {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+func newPDFLine(glyphs []pdf.Text) (pdfLine, bool) {
+	sort.SliceStable(glyphs, func(i, j int) bool {
+		return glyphs[i].X < glyphs[j].X
+	})
+
+	line := pdfLine{y: glyphs[0].Y}
+
+	var (
+		cell    *pdfCell
+		text    strings.Builder
+		prevX   float64
+		prevEnd float64
+	)
+
+	endCell := func() {
+		if cell == nil {
+			return
+		}
+		cell.text = strings.Join(strings.Fields(text.String()), " ")
+		if cell.text != "" {
+			line.cells = append(line.cells, *cell)
+		}
+		text.Reset()
+	}
+
+	for i, glyph := range glyphs {
+		size := pdfFontSize(glyph)
+		line.size = max(line.size, size)
+
+		x, width := glyph.X, glyph.W
+		if width <= 0 {
+			width = pdfGlyphWidth * size
+			// Glyphs of unknown width are all placed at the start of the
+			// text they're part of.
+			if i > 0 && glyph.X == prevX {
+				x = prevEnd
+			}
+		}
+		prevX = glyph.X
+
+		gap := x - prevEnd
+		switch {
+		case cell == nil || gap > pdfColumnGap*size:
+			endCell()
+			cell = &pdfCell{x0: x}
+		case gap > pdfWordGap*size:
+			text.WriteString(" ")
+		}
+
+		text.WriteString(glyph.S)
+		prevEnd = max(prevEnd, x+width)
+		cell.x1 = prevEnd
+	}
+	endCell()
+
+	return line, len(line.cells) > 0
+}
+
+// pdfTable returns the rows of the table starting at the first line, and the
+// number of lines it spans, or 0 if there is no table. A table starts with a
+// line of at least two cells, followed by lines with cells in the same
+// columns. Lines with fewer cells, each in a single column, continue the cells
+// of the previous row, as they're usually wrapped text.
+func pdfTable(lines []pdfLine) ([][]string, int) {
+	if len(lines[0].cells) < 2 {
+		return nil, 0
+	}
+
+	columns := make([]pdfCell, len(lines[0].cells))
+	copy(columns, lines[0].cells)
+
+	rows := [][]string{cellTexts(lines[0].cells)}
+
+	n := 1
+	for ; n < len(lines); n++ {
+		line := lines[n]
+		if lines[n-1].y-line.y > 2*pdfParagraphGap*line.size {
+			break
+		}
+
+		indexes, ok := pdfColumnIndexes(line.cells, columns)
+		if !ok {
+			break
+		}
+
+		if len(line.cells) == len(columns) {
+			rows = append(rows, cellTexts(line.cells))
+			for i, cell := range line.cells {
+				columns[i].x0 = min(columns[i].x0, cell.x0)
+				columns[i].x1 = max(columns[i].x1, cell.x1)
+			}
+			continue
+		}
+
+		row := rows[len(rows)-1]
+		for i, cell := range line.cells {
+			row[indexes[i]] = strings.TrimSpace(row[indexes[i]] + " " + cell.text)
+		}
+	}
+
+	if len(rows) < 2 {
+		return nil, 0
+	}
+
+	return rows, n
+}
+
+// pdfColumnIndexes returns the column of every cell, if every cell overlaps
+// exactly one column and no two cells share one.
+func pdfColumnIndexes(cells []pdfCell, columns []pdfCell) ([]int, bool) {
+	if len(cells) > len(columns) {
+		return nil, false
+	}
+
+	indexes := make([]int, len(cells))
+	used := make(map[int]bool)
+	for i, cell := range cells {
+		indexes[i] = -1
+		for j, column := range columns {
+			if cell.x0 >= column.x1 || cell.x1 <= column.x0 {
+				continue
+			}
+			if indexes[i] != -1 {
+				return nil, false
+			}
+			indexes[i] = j
+		}
+
+		if indexes[i] == -1 || used[indexes[i]] {
+			return nil, false
+		}
+		used[indexes[i]] = true
+	}
+
+	return indexes, true
+}
+
+func cellTexts(cells []pdfCell) []string {
+	texts := make([]string, len(cells))
+	for i, cell := range cells {
+		texts[i] = cell.text
+	}
+
+	return texts
+}
+
+func pdfFontSize(glyph pdf.Text) float64 {
+	if size := math.Abs(glyph.FontSize); size >= 1 {
+		return size
+	}
+
+	return 10
+}
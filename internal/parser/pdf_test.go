@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"slices"
+	"testing"
+)
+
+// pdfRow is a line of cells at y, each spanning 50 points from the given x.
+func pdfRow(y float64, cells ...any) pdfLine {
+	line := pdfLine{y: y, size: 10}
+	for i := 0; i < len(cells); i += 2 {
+		x := cells[i].(float64)
+		line.cells = append(line.cells, pdfCell{x0: x, x1: x + 50, text: cells[i+1].(string)})
+	}
+
+	return line
+}
+
+func TestPDFTable(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []pdfLine
+		rows  [][]string
+		n     int
+	}{
+		{
+			name: "single cell",
+			lines: []pdfLine{
+				pdfRow(700, 0.0, "Heading"),
+				pdfRow(685, 0.0, "Text"),
+			},
+		},
+		{
+			name: "aligned rows",
+			lines: []pdfLine{
+				pdfRow(700, 0.0, "Name", 100.0, "Grade"),
+				pdfRow(685, 0.0, "Ana", 100.0, "5"),
+				pdfRow(670, 0.0, "Ivo", 100.0, "4"),
+			},
+			rows: [][]string{{"Name", "Grade"}, {"Ana", "5"}, {"Ivo", "4"}},
+			n:    3,
+		},
+		{
+			name: "wrapped cell continues the previous row",
+			lines: []pdfLine{
+				pdfRow(700, 0.0, "Name", 100.0, "Note"),
+				pdfRow(685, 0.0, "Ana", 100.0, "Passed with"),
+				pdfRow(670, 100.0, "distinction"),
+				pdfRow(655, 0.0, "Ivo", 100.0, "Passed"),
+			},
+			rows: [][]string{{"Name", "Note"}, {"Ana", "Passed with distinction"}, {"Ivo", "Passed"}},
+			n:    4,
+		},
+		{
+			name: "header without rows",
+			lines: []pdfLine{
+				pdfRow(700, 0.0, "Name", 100.0, "Grade"),
+				pdfRow(685, 0.0, "A paragraph spanning both columns"),
+			},
+		},
+		{
+			name: "ends at a cell spanning two columns",
+			lines: []pdfLine{
+				pdfRow(700, 0.0, "Name", 100.0, "Grade"),
+				pdfRow(685, 0.0, "Ana", 100.0, "5"),
+				{y: 670, size: 10, cells: []pdfCell{{x0: 0, x1: 150, text: "A paragraph"}}},
+			},
+			rows: [][]string{{"Name", "Grade"}, {"Ana", "5"}},
+			n:    2,
+		},
+		{
+			name: "ends at a large vertical gap",
+			lines: []pdfLine{
+				pdfRow(700, 0.0, "Name", 100.0, "Grade"),
+				pdfRow(685, 0.0, "Ana", 100.0, "5"),
+				pdfRow(600, 0.0, "Ivo", 100.0, "4"),
+			},
+			rows: [][]string{{"Name", "Grade"}, {"Ana", "5"}},
+			n:    2,
+		},
+		{
+			name: "ends at more cells than columns",
+			lines: []pdfLine{
+				pdfRow(700, 0.0, "Name", 100.0, "Grade"),
+				pdfRow(685, 0.0, "Ana", 100.0, "5"),
+				pdfRow(670, 0.0, "a", 100.0, "b", 200.0, "c"),
+			},
+			rows: [][]string{{"Name", "Grade"}, {"Ana", "5"}},
+			n:    2,
+		},
+		{
+			name: "rows widen their columns",
+			lines: []pdfLine{
+				pdfRow(700, 0.0, "Name", 100.0, "Grade"),
+				pdfRow(685, 20.0, "Ana", 120.0, "5"),
+				// Only overlaps the first column as widened by the row above.
+				{y: 670, size: 10, cells: []pdfCell{{x0: 55, x1: 95, text: "Ivo"}, {x0: 100, x1: 150, text: "4"}}},
+			},
+			rows: [][]string{{"Name", "Grade"}, {"Ana", "5"}, {"Ivo", "4"}},
+			n:    3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, n := pdfTable(tt.lines)
+			if n != tt.n {
+				t.Errorf("n = %d, want %d", n, tt.n)
+			}
+			if !slices.EqualFunc(rows, tt.rows, slices.Equal) {
+				t.Errorf("rows = %q, want %q", rows, tt.rows)
+			}
+		})
+	}
+}
@@ -12,9 +12,11 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/OptimusePrime/petagpt/configs"
 	"github.com/OptimusePrime/petagpt/internal/crypto_utils"
@@ -26,6 +28,16 @@ type Chunk struct {
 	ID      string
 	Content string
 	Context string
+	Page    int
+	// Ordinal is the position of the chunk within its document.
+	Ordinal int
+	// StartOffset and EndOffset are character offsets of the chunk's text
+	// within the parsed document. For tables they span the original table.
+	StartOffset int
+	EndOffset   int
+	// TableSHA256 is the checksum of the HTML of the table a table chunk
+	// summarises, so that the summary can be reused while it's unchanged.
+	TableSHA256 string
 }
 
 func (c Chunk) String() string {
@@ -218,19 +230,50 @@ func (dc *DocumentChunker) sentenceSegmentText(ctx context.Context, text string)
 	return resp.Sentences, nil
 }
 
-func (dc *DocumentChunker) extractTablesFromDocument(ctx context.Context, parsedDocument string, requestDelay int) ([]string, error) {
+type tableSummary struct {
+	Page    int
+	Summary string
+	SHA256  string
+	Start   int
+	End     int
+}
+
+func tableSHA256(table string) string {
+	sha := sha256.Sum256([]byte(table))
+
+	return base64.StdEncoding.EncodeToString(sha[:])
+}
+
+// extractTablesFromDocument summarises every table of the document. Tables in
+// summaries, keyed by their checksum, aren't summarised again.
+func (dc *DocumentChunker) extractTablesFromDocument(ctx context.Context, parsedDocument string, requestDelay int, summaries map[string]string) ([]tableSummary, error) {
 	tableRegexStr := "<table>.*?<\\/table>"
 	tableRegex, err := regexp.Compile(tableRegexStr)
 	if err != nil {
 		return nil, err
 	}
 
-	tables := tableRegex.FindAllString(parsedDocument, -1)
+	tableLocs := tableRegex.FindAllStringIndex(parsedDocument, -1)
+
+	ch := make(chan tableSummary, len(tableLocs))
+	errCh := make(chan error, len(tableLocs))
+
+	for _, loc := range tableLocs {
+		table := parsedDocument[loc[0]:loc[1]]
+		page := strings.Count(parsedDocument[:loc[0]], PARSING_PAGE_SEPARATOR) + 1
+		checksum := tableSHA256(table)
 
-	ch := make(chan string, len(tables))
-	errCh := make(chan error, len(tables))
+		if summary, ok := summaries[checksum]; ok {
+			ch <- tableSummary{
+				Page:    page,
+				Summary: summary,
+				SHA256:  checksum,
+				Start:   loc[0],
+				End:     loc[1],
+			}
+			continue
+		}
 
-	for _, table := range tables {
 		err = dc.llmSem.Acquire(ctx, 1)
 		if err != nil {
 			return nil, err
@@ -239,19 +282,26 @@ func (dc *DocumentChunker) extractTablesFromDocument(ctx context.Context, parsed
 		go func() {
 			defer dc.llmSem.Release(1)
 
-			tableSummary, err := TransformTable(ctx, table)
+			summary, err := TransformTable(ctx, table)
 			if err != nil {
 				errCh <- err
+				return
 			}
 
-			ch <- tableSummary
+			ch <- tableSummary{
+				Page:    page,
+				Summary: summary,
+				SHA256:  checksum,
+				Start:   loc[0],
+				End:     loc[1],
+			}
 		}()
 		//time.Sleep(5000 * time.Millisecond)
 	}
 
-	var tableSummaries []string
+	var tableSummaries []tableSummary
 
-	for range len(tables) {
+	for range len(tableLocs) {
 		select {
 		case summary := <-ch:
 			tableSummaries = append(tableSummaries, summary)
@@ -263,15 +313,65 @@ func (dc *DocumentChunker) extractTablesFromDocument(ctx context.Context, parsed
 	return tableSummaries, nil
 }
 
+// sentenceOffsets locates each sentence in document, searching from the end of
+// the previous one, and returns their byte offsets. Sentences which can't be
+// found, e.g. because a table was cut out of them, get an empty span.
+func sentenceOffsets(document string, sentences []string) (starts []int, ends []int) {
+	cursor := 0
+
+	for _, sentence := range sentences {
+		sentence = strings.TrimSpace(sentence)
+
+		start, end := cursor, cursor
+		if i := strings.Index(document[cursor:], sentence); i >= 0 && len(sentence) > 0 {
+			start = cursor + i
+			end = start + len(sentence)
+			cursor = end
+		}
+
+		starts = append(starts, start)
+		ends = append(ends, end)
+	}
+
+	return starts, ends
+}
+
+// Chunk splits the document into chunks and creates their contexts.
 func (dc *DocumentChunker) Chunk(ctx context.Context, document string, chunkSize int, requestDelay int) ([]Chunk, error) {
+	chunks, err := dc.Segment(ctx, document, chunkSize, requestDelay, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks, err = dc.Contextualise(ctx, document, chunks)
+	if err != nil {
+		return nil, err
+	}
+
+	return chunks, nil
+}
+
+// Segment splits the document into chunks of chunkSize sentences, and a chunk
+// for every table, without their contexts. Table summaries, keyed by the
+// checksum of the table's HTML, are reused for the tables they summarise.
+func (dc *DocumentChunker) Segment(ctx context.Context, document string, chunkSize int, requestDelay int, summaries map[string]string) ([]Chunk, error) {
 	var chunkContents []string
+	var chunkPages []int
+	var chunkStarts, chunkEnds []int
+	var chunkTables []string
 
-	tableSummaries, err := dc.extractTablesFromDocument(ctx, document, requestDelay)
+	tableSummaries, err := dc.extractTablesFromDocument(ctx, document, requestDelay, summaries)
 	if err != nil {
 		return nil, err
 	}
 
-	chunkContents = append(chunkContents, tableSummaries...)
+	for _, table := range tableSummaries {
+		chunkContents = append(chunkContents, table.Summary)
+		chunkPages = append(chunkPages, table.Page)
+		chunkStarts = append(chunkStarts, table.Start)
+		chunkEnds = append(chunkEnds, table.End)
+		chunkTables = append(chunkTables, table.SHA256)
+	}
 
 	tableRegexStr := "<table>.*?<\\/table>"
 	tableRegex, err := regexp.Compile(tableRegexStr)
@@ -284,16 +384,22 @@ func (dc *DocumentChunker) Chunk(ctx context.Context, document string, chunkSize
 	pages := strings.Split(documentNoTables, PARSING_PAGE_SEPARATOR)
 
 	var sentences []string
+	var sentencePages []int
 
-	for _, page := range pages {
+	for pageIdx, page := range pages {
 		pageSentences, err := dc.sentenceSegmentText(ctx, page)
 		if err != nil {
 			return nil, fmt.Errorf("sentence segmentation failed: %w", err)
 		}
 
 		sentences = append(sentences, pageSentences...)
+		for range pageSentences {
+			sentencePages = append(sentencePages, pageIdx+1)
+		}
 	}
 
+	sentenceStarts, sentenceEnds := sentenceOffsets(document, sentences)
+
 	currentSentence := 0
 	for {
 		cutoff := min(currentSentence+chunkSize, len(sentences))
@@ -301,6 +407,10 @@ func (dc *DocumentChunker) Chunk(ctx context.Context, document string, chunkSize
 		chunk := strings.TrimSpace(strings.Join(sentences[currentSentence:cutoff], " "))
 		if len(chunk) > 0 {
 			chunkContents = append(chunkContents, chunk)
+			chunkPages = append(chunkPages, sentencePages[currentSentence])
+			chunkStarts = append(chunkStarts, sentenceStarts[currentSentence])
+			chunkEnds = append(chunkEnds, max(sentenceEnds[cutoff-1], sentenceStarts[currentSentence]))
+			chunkTables = append(chunkTables, "")
 		}
 
 		if cutoff == len(sentences) {
@@ -310,49 +420,86 @@ func (dc *DocumentChunker) Chunk(ctx context.Context, document string, chunkSize
 		currentSentence += chunkSize
 	}
 
-	ch := make(chan Chunk, len(chunkContents))
-	errCh := make(chan error, len(chunkContents))
+	// Tables are chunked separately, so order all chunks by where they start.
+	order := make([]int, len(chunkContents))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return chunkStarts[a] - chunkStarts[b]
+	})
+
+	chunkOrdinals := make([]int, len(chunkContents))
+	for ordinal, i := range order {
+		chunkOrdinals[i] = ordinal
+	}
 
+	chunks := make([]Chunk, len(chunkContents))
 	for i, content := range chunkContents {
-		if err = dc.llmSem.Acquire(ctx, 1); err != nil {
-			return nil, err
+		chunkID, err := crypto_utils.RandomBytes(16)
+		if err != nil {
+			return nil, fmt.Errorf("failed generating chunk ID: %x: %w", i, err)
+		}
+
+		chunks[chunkOrdinals[i]] = Chunk{
+			ID:          base64.StdEncoding.EncodeToString(chunkID),
+			Content:     content,
+			Page:        chunkPages[i],
+			Ordinal:     chunkOrdinals[i],
+			StartOffset: utf8.RuneCountInString(document[:chunkStarts[i]]),
+			EndOffset:   utf8.RuneCountInString(document[:chunkEnds[i]]),
+			TableSHA256: chunkTables[i],
+		}
+	}
+
+	return chunks, nil
+}
+
+// Contextualise creates the context of every chunk which has none yet. On
+// failure, the chunks are returned with the contexts created so far, so they
+// don't have to be created again.
+func (dc *DocumentChunker) Contextualise(ctx context.Context, document string, chunks []Chunk) ([]Chunk, error) {
+	chunks = slices.Clone(chunks)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errCh := make(chan error, len(chunks))
+	var wg sync.WaitGroup
+
+	for i := range chunks {
+		if chunks[i].Context != "" {
+			continue
+		}
+
+		if err := dc.llmSem.Acquire(ctx, 1); err != nil {
+			break
 		}
 
+		wg.Add(1)
 		go func() {
+			defer wg.Done()
 			defer dc.llmSem.Release(1)
 
-			chunkContext, err := CreateChunkContext(ctx, document, content)
+			chunkContext, err := CreateChunkContext(ctx, document, chunks[i].Content)
 			if err != nil {
 				errCh <- fmt.Errorf("failed creating chunk context: %x: %w", i, err)
+				cancel()
 				return
 			}
 
-			chunkID, err := crypto_utils.RandomBytes(16)
-			if err != nil {
-				errCh <- fmt.Errorf("failed generating chunk ID: %x: %w", i, err)
-				return
-			}
-			chunkIDBase64 := base64.StdEncoding.EncodeToString(chunkID)
-
-			chunk := Chunk{
-				ID:      chunkIDBase64,
-				Content: content,
-				Context: chunkContext,
-			}
-
-			ch <- chunk
+			chunks[i].Context = chunkContext
 		}()
 	}
 
-	var chunks []Chunk
+	wg.Wait()
+	close(errCh)
 
-	for range len(chunkContents) {
-		select {
-		case chunk := <-ch:
-			chunks = append(chunks, chunk)
-		case err = <-errCh:
-			return nil, err
-		}
+	if err := <-errCh; err != nil {
+		return chunks, err
+	}
+	if err := ctx.Err(); err != nil {
+		return chunks, err
 	}
 
 	return chunks, nil
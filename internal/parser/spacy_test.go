@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSentenceOffsets(t *testing.T) {
+	tests := []struct {
+		name      string
+		document  string
+		sentences []string
+		starts    []int
+		ends      []int
+	}{
+		{
+			name:      "consecutive sentences",
+			document:  "One. Two. Three.",
+			sentences: []string{"One.", "Two.", "Three."},
+			starts:    []int{0, 5, 10},
+			ends:      []int{4, 9, 16},
+		},
+		{
+			name:      "surrounding whitespace",
+			document:  "One.\n\nTwo.",
+			sentences: []string{"One.\n", " Two. "},
+			starts:    []int{0, 6},
+			ends:      []int{4, 10},
+		},
+		{
+			name:      "repeated sentence",
+			document:  "Yes. Yes.",
+			sentences: []string{"Yes.", "Yes."},
+			starts:    []int{0, 5},
+			ends:      []int{4, 9},
+		},
+		{
+			name:      "missing sentence",
+			document:  "One. Two.",
+			sentences: []string{"One.", "Table.", "Two."},
+			starts:    []int{0, 4, 5},
+			ends:      []int{4, 4, 9},
+		},
+		{
+			name:      "empty sentence",
+			document:  "One. Two.",
+			sentences: []string{"One.", " ", "Two."},
+			starts:    []int{0, 4, 5},
+			ends:      []int{4, 4, 9},
+		},
+		{
+			name:      "multibyte text",
+			document:  "Čaj. Kava.",
+			sentences: []string{"Čaj.", "Kava."},
+			starts:    []int{0, 6},
+			ends:      []int{5, 11},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			starts, ends := sentenceOffsets(tt.document, tt.sentences)
+			if !slices.Equal(starts, tt.starts) || !slices.Equal(ends, tt.ends) {
+				t.Errorf("sentenceOffsets() = %v, %v, want %v, %v", starts, ends, tt.starts, tt.ends)
+			}
+		})
+	}
+}
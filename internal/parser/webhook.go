@@ -1 +1,224 @@
 package parser
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// WEBHOOK_PATH is where the server receives the LlamaIndex webhook.
+const WEBHOOK_PATH = "/webhooks/llama_index"
+
+// maxWebhookBodySize bounds the webhook payload, which can hold the whole
+// parsing result.
+const maxWebhookBodySize = 64 << 20
+
+// jobNotificationTTL is how long a notification for a job nobody waits for in
+// this process is kept, e.g. when it arrived before the upload returned.
+const jobNotificationTTL = time.Hour
+
+type jobNotification struct {
+	done      chan struct{}
+	closed    bool
+	createdAt time.Time
+}
+
+var (
+	jobNotificationsMu sync.Mutex
+	jobNotifications   = make(map[string]*jobNotification)
+)
+
+// jobDone returns a channel which is closed when the webhook for the job
+// arrives.
+func jobDone(jobID string) <-chan struct{} {
+	jobNotificationsMu.Lock()
+	defer jobNotificationsMu.Unlock()
+
+	return getJobNotification(jobID).done
+}
+
+func notifyJobDone(jobID string) {
+	jobNotificationsMu.Lock()
+	defer jobNotificationsMu.Unlock()
+
+	notification := getJobNotification(jobID)
+	if !notification.closed {
+		close(notification.done)
+		notification.closed = true
+	}
+}
+
+func forgetJob(jobID string) {
+	jobNotificationsMu.Lock()
+	defer jobNotificationsMu.Unlock()
+
+	delete(jobNotifications, jobID)
+}
+
+// getJobNotification must be called with jobNotificationsMu held.
+func getJobNotification(jobID string) *jobNotification {
+	for id, notification := range jobNotifications {
+		if time.Since(notification.createdAt) > jobNotificationTTL {
+			delete(jobNotifications, id)
+		}
+	}
+
+	notification, ok := jobNotifications[jobID]
+	if !ok {
+		notification = &jobNotification{done: make(chan struct{}), createdAt: time.Now()}
+		jobNotifications[jobID] = notification
+	}
+
+	return notification
+}
+
+// webhookURL returns the URL LlamaIndex should call when a parsing job is
+// done, or "" if the webhook isn't used. LlamaIndex doesn't sign its
+// requests, so the URL carries a nonce signed with
+// document_parser.webhook.secret instead.
+func webhookURL() (string, error) {
+	base := viper.GetString("document_parser.webhook.url")
+	if !viper.GetBool("document_parser.use_webhook") || base == "" {
+		return "", nil
+	}
+
+	secret := viper.GetString("document_parser.webhook.secret")
+	if secret == "" {
+		return "", errors.New("document_parser.webhook.secret must be set to use the webhook")
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse webhook URL: %w", err)
+	}
+
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return "", fmt.Errorf("failed to generate webhook nonce: %w", err)
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+
+	query := u.Query()
+	query.Set("nonce", nonce)
+	query.Set("signature", signWebhookNonce(secret, nonce))
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+func signWebhookNonce(secret, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(nonce))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func validWebhookSignature(query url.Values) bool {
+	secret := viper.GetString("document_parser.webhook.secret")
+	nonce := query.Get("nonce")
+	if secret == "" || nonce == "" {
+		return false
+	}
+
+	signature, err := hex.DecodeString(query.Get("signature"))
+	if err != nil {
+		return false
+	}
+	expected, _ := hex.DecodeString(signWebhookNonce(secret, nonce))
+
+	return hmac.Equal(signature, expected)
+}
+
+// webhookPayload covers both the payload of the legacy webhook_url, which
+// holds the job ID at the top level, and of webhook events, which nest it in
+// data.
+type webhookPayload struct {
+	JobID string `json:"job_id"`
+	ID    string `json:"id"`
+	Data  struct {
+		JobID string `json:"job_id"`
+	} `json:"data"`
+}
+
+func (p webhookPayload) jobID() string {
+	switch {
+	case p.Data.JobID != "":
+		return p.Data.JobID
+	case p.JobID != "":
+		return p.JobID
+	default:
+		return p.ID
+	}
+}
+
+// WebhookHandler receives the LlamaIndex webhook and wakes up whoever waits
+// for the job in this process. The payload isn't trusted beyond the job ID,
+// the waiter checks the job status with the API.
+func WebhookHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !validWebhookSignature(r.URL.Query()) {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		var payload webhookPayload
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookBodySize)).Decode(&payload)
+		if err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+
+		jobID := payload.jobID()
+		if jobID == "" {
+			http.Error(w, "missing job ID", http.StatusBadRequest)
+			return
+		}
+
+		notifyJobDone(jobID)
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// ServeWebhooks receives the LlamaIndex webhook on addr until ctx is done,
+// for processes parsing documents without running the server.
+func ServeWebhooks(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle(WEBHOOK_PATH, WebhookHandler())
+
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	err := srv.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve webhooks: %w", err)
+	}
+
+	return nil
+}
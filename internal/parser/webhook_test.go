@@ -0,0 +1,120 @@
+package parser
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	viper.Set("document_parser.webhook.secret", "secret")
+	t.Cleanup(func() { viper.Set("document_parser.webhook.secret", "") })
+
+	signed := url.Values{
+		"nonce":     {"nonce"},
+		"signature": {signWebhookNonce("secret", "nonce")},
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		query    url.Values
+		body     string
+		status   int
+		notified bool
+	}{
+		{
+			name:     "signed legacy payload",
+			method:   http.MethodPost,
+			query:    signed,
+			body:     `{"job_id": "job"}`,
+			status:   http.StatusNoContent,
+			notified: true,
+		},
+		{
+			name:     "signed event payload",
+			method:   http.MethodPost,
+			query:    signed,
+			body:     `{"event_type": "parse.success", "data": {"job_id": "job"}}`,
+			status:   http.StatusNoContent,
+			notified: true,
+		},
+		{
+			name:   "signature of another secret",
+			method: http.MethodPost,
+			query:  url.Values{"nonce": {"nonce"}, "signature": {signWebhookNonce("other", "nonce")}},
+			body:   `{"job_id": "job"}`,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "signature of another nonce",
+			method: http.MethodPost,
+			query:  url.Values{"nonce": {"other"}, "signature": {signWebhookNonce("secret", "nonce")}},
+			body:   `{"job_id": "job"}`,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "malformed signature",
+			method: http.MethodPost,
+			query:  url.Values{"nonce": {"nonce"}, "signature": {"not hex"}},
+			body:   `{"job_id": "job"}`,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "unsigned",
+			method: http.MethodPost,
+			body:   `{"job_id": "job"}`,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "wrong method",
+			method: http.MethodGet,
+			query:  signed,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "invalid payload",
+			method: http.MethodPost,
+			query:  signed,
+			body:   `{`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "missing job ID",
+			method: http.MethodPost,
+			query:  signed,
+			body:   `{}`,
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			done := jobDone("job")
+			t.Cleanup(func() { forgetJob("job") })
+
+			req := httptest.NewRequest(tt.method, WEBHOOK_PATH+"?"+tt.query.Encode(), strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			WebhookHandler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+
+			select {
+			case <-done:
+				if !tt.notified {
+					t.Error("job was notified")
+				}
+			default:
+				if tt.notified {
+					t.Error("job wasn't notified")
+				}
+			}
+		})
+	}
+}
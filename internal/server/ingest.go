@@ -0,0 +1,192 @@
+package server
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/OptimusePrime/petagpt/internal/db"
+	"github.com/OptimusePrime/petagpt/internal/ingest"
+	"github.com/OptimusePrime/petagpt/internal/sqlc"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+type JobResponse struct {
+	ID         int64  `json:"id"`
+	IndexID    int64  `json:"index_id"`
+	FilePath   string `json:"file_path"`
+	Status     string `json:"status"`
+	Stage      string `json:"stage"`
+	Attempts   int64  `json:"attempts"`
+	Error      string `json:"error,omitempty"`
+	DocumentID *int64 `json:"document_id,omitempty"`
+}
+
+func newJobResponse(job sqlc.IngestionJob) JobResponse {
+	resp := JobResponse{
+		ID:       job.ID,
+		IndexID:  job.IndexID,
+		FilePath: job.FilePath,
+		Status:   job.Status,
+		Stage:    job.Stage,
+		Attempts: job.Attempts,
+		Error:    job.Error.String,
+	}
+	if job.DocumentID.Valid {
+		resp.DocumentID = &job.DocumentID.Int64
+	}
+
+	return resp
+}
+
+// requireUploadToken only lets through requests with the bearer token
+// configured in server.upload_token.
+func requireUploadToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		given, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "invalid upload token",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// handleUploadDocument queues the uploaded document for ingestion. The form
+// holds the file, the name of the index, and optionally tags, the chunk size
+// and force, to process the file even if the index already has its content.
+// Uploads only update the document added before from the same path if the
+// form gives one, as different files can have the same name.
+func handleUploadDocument(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("failed to read uploaded file: %s", err.Error()),
+		})
+		return
+	}
+
+	chunkSize := viper.GetInt("ingestion.chunk_size")
+	if value := c.PostForm("chunk_size"); value != "" {
+		chunkSize, err = strconv.Atoi(value)
+		if err != nil || chunkSize <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("invalid chunk size: %s", value),
+			})
+			return
+		}
+	}
+
+	var force bool
+	if value := c.PostForm("force"); value != "" {
+		force, err = strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("invalid force: %s", value),
+			})
+			return
+		}
+	}
+
+	queries := sqlc.New(db.MainDB)
+
+	idx, err := queries.GetIndexByName(c.Request.Context(), c.PostForm("index"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("index not found: %s", c.PostForm("index")),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("failed to find index: %s", err.Error()),
+		})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("failed to read uploaded file: %s", err.Error()),
+		})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("failed to read uploaded file: %s", err.Error()),
+		})
+		return
+	}
+
+	path := c.PostForm("path")
+	addOnly := path == ""
+	if addOnly {
+		path = filepath.Base(fileHeader.Filename)
+	}
+
+	job, err := ingest.Enqueue(c.Request.Context(), ingest.JobParams{
+		IndexID:   idx.ID,
+		FilePath:  path,
+		Data:      data,
+		Tags:      c.PostFormArray("tag"),
+		ChunkSize: chunkSize,
+		Force:     force,
+		AddOnly:   addOnly,
+	})
+	var duplicate *ingest.DuplicateError
+	if errors.As(err, &duplicate) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": duplicate.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, newJobResponse(job))
+}
+
+func handleGetJob(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("invalid job ID: %s", c.Param("id")),
+		})
+		return
+	}
+
+	queries := sqlc.New(db.MainDB)
+
+	job, err := queries.GetIngestionJob(c.Request.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("job not found: %d", id),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("failed to get job: %s", err.Error()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, newJobResponse(job))
+}
@@ -3,20 +3,24 @@ package server
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/OptimusePrime/petagpt/internal/chat"
 	"github.com/OptimusePrime/petagpt/internal/db"
 	"github.com/OptimusePrime/petagpt/internal/index"
+	"github.com/OptimusePrime/petagpt/internal/ingest"
+	"github.com/OptimusePrime/petagpt/internal/parser"
 	"github.com/OptimusePrime/petagpt/internal/sqlc"
 	"github.com/charmbracelet/log"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/mattn/go-sqlite3"
-	"github.com/openai/openai-go/v2"
-	"github.com/openai/openai-go/v2/option"
 	"github.com/spf13/viper"
 )
 
@@ -25,7 +29,14 @@ type SendMessageRequest struct {
 	UserMessage string `json:"user_message"`
 }
 
+// StartServer serves the chat and search API. idxName is either an index or an
+// index group configured under retrieval.index_groups.
 func StartServer(idxName string, topN int) error {
+	refs, err := index.ResolveIndexRefs(idxName)
+	if err != nil {
+		return err
+	}
+
 	router := gin.Default()
 
 	router.Use(cors.Default())
@@ -35,30 +46,218 @@ func StartServer(idxName string, topN int) error {
 	})
 
 	router.POST("/chat/send", func(c *gin.Context) {
-		handleSendConversationMessage(c, idxName, topN)
+		handleSendConversationMessage(c, refs, topN)
+	})
+
+	router.POST("/search", func(c *gin.Context) {
+		handleSearch(c, refs, topN)
 	})
 
-	router.Run(":7030")
+	router.POST(parser.WEBHOOK_PATH, gin.WrapH(parser.WebhookHandler()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Uploads are disabled unless server.upload_token is set.
+	workerDone := make(chan struct{})
+	if token := viper.GetString("server.upload_token"); token != "" {
+		dc, err := parser.NewDocumentChunker(ctx, viper.GetInt("ingestion.num_workers"), viper.GetInt("context_llm.max_concurrent_requests"))
+		if err != nil {
+			return fmt.Errorf("failed to create a document chunker: %w", err)
+		}
+
+		uploads := router.Group("/", requireUploadToken(token))
+		uploads.POST("/documents", handleUploadDocument)
+		uploads.GET("/jobs/:id", handleGetJob)
+
+		go runIngestionWorker(ctx, ingest.NewWorker(dc), workerDone)
+	} else {
+		close(workerDone)
+	}
+
+	srv := &http.Server{
+		Addr:    ":7030",
+		Handler: router,
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
 
-	return nil
+	go watchIndexes(srv, signals)
+
+	err = srv.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	// Interrupted jobs are queued again when the worker stops.
+	cancel()
+	<-workerDone
+
+	return index.DefaultManager.Close()
 }
 
-func Retrieval(ctx context.Context, queries []string, idxName string, topN int) string {
-	var chunks string
+// runIngestionWorker processes uploaded documents until ctx is done, starting
+// over when the queue itself fails, e.g. when the database is locked.
+func runIngestionWorker(ctx context.Context, worker *ingest.Worker, done chan<- struct{}) {
+	defer close(done)
 
-	for _, q := range queries {
-		result, err := index.SearchIndex(ctx, idxName, q, topN)
+	if err := ingest.Recover(ctx); err != nil {
+		log.Errorf("failed to recover incomplete operations: %s", err.Error())
+	}
+
+	worker.OnJobDone = func(job sqlc.IngestionJob, err error) {
 		if err != nil {
-			return ""
+			log.Errorf("ingestion job %d failed: %s: %s", job.ID, job.FilePath, err.Error())
+		}
+	}
+
+	for {
+		err := worker.Run(ctx)
+		if err == nil || ctx.Err() != nil {
+			return
 		}
-		//fmt.Println(result)
 
-		for _, doc := range result.Documents {
-			chunks += fmt.Sprintf("<document>\n%s\n</document>\n", doc.Content)
+		log.Errorf("ingestion worker failed: %s", err.Error())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(viper.GetDuration("ingestion.poll_interval")):
 		}
 	}
+}
+
+// watchIndexes reloads the index handles on SIGHUP, so indexes added or
+// removed by the CLI are picked up. It also periodically drops handles of
+// rebuilt indexes and releases idle Bleve indexes so the CLI can write to
+// them. SIGINT and SIGTERM shut the server down.
+func watchIndexes(srv *http.Server, signals <-chan os.Signal) {
+	idleTimeout := viper.GetDuration("bm25.idle_timeout")
+
+	interval := 30 * time.Second
+	if idleTimeout > 0 {
+		interval = max(idleTimeout/2, time.Second)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				if err := index.DefaultManager.Reload(context.Background(), true); err != nil {
+					log.Errorf("failed to reload indexes: %s", err.Error())
+				}
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := srv.Shutdown(ctx); err != nil {
+				log.Errorf("failed to shut down server: %s", err.Error())
+			}
+			cancel()
+
+			return
+		case <-ticker.C:
+			if err := index.DefaultManager.Reload(context.Background(), false); err != nil {
+				log.Errorf("failed to reload indexes: %s", err.Error())
+			}
+
+			if idleTimeout <= 0 {
+				continue
+			}
+
+			if err := index.DefaultManager.ReleaseIdle(idleTimeout); err != nil {
+				log.Errorf("failed to release idle indexes: %s", err.Error())
+			}
+		}
+	}
+}
+
+type SearchRequest struct {
+	Query string `json:"query"`
+	TopN  int    `json:"top_n"`
+	// Indexes default to the ones the server was started with.
+	Indexes []index.IndexRef    `json:"indexes"`
+	Filter  *index.SearchFilter `json:"filter"`
+	// Neighbours defaults to retrieval.neighbours.
+	Neighbours *int `json:"neighbours"`
+	// Mode is either "match", the default, or "syntax" for the Bleve query
+	// string syntax.
+	Mode string `json:"mode"`
+	// Highlight is the style of the highlight markers, either "html" or
+	// "ansi". It defaults to highlight.style.
+	Highlight string `json:"highlight"`
+}
+
+func handleSearch(c *gin.Context, refs []index.IndexRef, topN int) {
+	req := new(SearchRequest)
+	err := c.Bind(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("failed to parse request body: %s", err.Error()),
+		})
+		return
+	}
+
+	if req.TopN <= 0 {
+		req.TopN = topN
+	}
+	if len(req.Indexes) == 0 {
+		req.Indexes = refs
+	}
+
+	mode, err := index.ParseQueryMode(req.Mode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	result, err := index.SearchIndexes(c.Request.Context(), req.Indexes, req.Query, req.TopN, req.Filter, mode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("failed to search index: %s", err.Error()),
+		})
+		return
+	}
+
+	if req.Highlight == "" {
+		req.Highlight = viper.GetString("highlight.style")
+	}
 
-	return chunks
+	documents := result.Documents[:min(req.TopN, len(result.Documents))]
+
+	err = index.Highlight(documents, req.Query, mode, req.Highlight)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if req.Neighbours == nil {
+		req.Neighbours = new(int)
+		*req.Neighbours = viper.GetInt("retrieval.neighbours")
+	}
+
+	documents, err = index.ExpandNeighbours(c.Request.Context(), documents, *req.Neighbours)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("failed to expand search results: %s", err.Error()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"documents":       documents,
+		"degraded":        result.Degraded,
+		"degraded_reason": result.DegradedReason,
+	})
 }
 
 type CreateConversationRequest struct {
@@ -88,12 +287,7 @@ func handleCreateConversation(c *gin.Context, idxName string, topN int) {
 	c.Status(http.StatusOK)
 }
 
-func handleSendConversationMessage(c *gin.Context, idxName string, topN int) {
-	client := openai.NewClient(
-		option.WithAPIKey(viper.GetString("main_llm.api_key")),
-		option.WithBaseURL(viper.GetString("main_llm.api_base")),
-	)
-
+func handleSendConversationMessage(c *gin.Context, refs []index.IndexRef, topN int) {
 	ctx := context.Background()
 
 	req := new(SendMessageRequest)
@@ -139,47 +333,6 @@ func handleSendConversationMessage(c *gin.Context, idxName string, topN int) {
 		}
 	}()
 
-	msgs := []openai.ChatCompletionMessageParamUnion{
-		openai.SystemMessage(viper.GetString("main_llm.system_prompt")),
-	}
-
-	// for _, msg := range req.Messages {
-	// 	if msg.Role == "assistant" {
-	// 		msgs = append(msgs, openai.AssistantMessage(msg.Content))
-	// 	} else {
-	// 		msgs = append(msgs, openai.UserMessage(msg.Content))
-	// 	}
-	// }
-
-	params := openai.ChatCompletionNewParams{
-		Messages:        msgs,
-		Model:           viper.GetString("main_llm.model"),
-		Temperature:     openai.Float(viper.GetFloat64("main_llm.temperature")),
-		TopP:            openai.Float(viper.GetFloat64("main_llm.top_p")),
-		ReasoningEffort: openai.ReasoningEffort(viper.GetString("main_llm.reasoning_effort")),
-		Tools: []openai.ChatCompletionToolUnionParam{
-			{
-				OfFunction: &openai.ChatCompletionFunctionToolParam{
-					Function: openai.FunctionDefinitionParam{
-						Name:        "retrieval",
-						Description: openai.String("Find information about V. gimnazija and related subjects. You may enter mulitple queries at once. Use the tool when you believe you need additional information to answer the question."),
-						Parameters: openai.FunctionParameters{
-							"type": "object",
-							"properties": map[string]any{
-								"queries": map[string]any{
-									"type": "array",
-									"items": map[string]any{
-										"type": "string",
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-		},
-	}
-
 	var assistantMsg string
 
 	defer func() {
@@ -196,64 +349,18 @@ func handleSendConversationMessage(c *gin.Context, idxName string, topN int) {
 		}()
 	}()
 
-	chatCompl, err := client.Chat.Completions.New(
-		ctx, params,
-	)
+	response, err := chat.Answer(ctx, req.UserMessage, refs, topN)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Errorf("failed to create the chat completer: %s", err.Error()),
+			"error": err.Error(),
 		})
 		return
 	}
 
-	//fmt.Println(chatCompl.Choices[0].RawJSON())
-	toolCalls := chatCompl.Choices[0].Message.ToolCalls
-	if len(toolCalls) == 0 {
-		assistantMsg = chatCompl.Choices[0].Message.Content
-		c.JSON(http.StatusOK, gin.H{
-			"response": assistantMsg,
-		})
-		return
-	}
-	fmt.Println(toolCalls)
-
-	params.Messages = append(params.Messages, chatCompl.Choices[0].Message.ToParam())
-	for _, toolCall := range toolCalls {
-		if toolCall.Function.Name == "retrieval" {
-			var args struct {
-				Queries []string `json:"queries"`
-			}
-			err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args)
-			if err != nil {
-				panic(err)
-			}
-			//fmt.Println(args)
-			queries := args.Queries
-
-			chunks := Retrieval(ctx, queries, idxName, topN)
-			fmt.Printf("%+v", chunks)
-
-			params.Messages = append(params.Messages, openai.ToolMessage(chunks, toolCall.ID))
-		}
-	}
-
-	//params.ToolChoice = openai.ChatCompletionToolChoiceOptionAutoNone
-
-	chatCompl, err = client.Chat.Completions.New(
-		ctx, params,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	if chatCompl == nil || len(chatCompl.Choices) == 0 {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Empty response from LLM"})
-		return
-	}
-
-	assistantMsg = chatCompl.Choices[0].Message.Content
+	assistantMsg = response.Content
 
 	c.JSON(http.StatusOK, gin.H{
 		"response": assistantMsg,
+		"degraded": response.Degraded,
 	})
 }
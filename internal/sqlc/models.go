@@ -19,6 +19,17 @@ type Chunk struct {
 	Content     string
 	Context     string
 	IndexingID  string
+	Page        int64
+	Ordinal     sql.NullInt64
+	TableSha256 sql.NullString
+}
+
+type ChunkRemoval struct {
+	ID          int64
+	CreatedAt   time.Time
+	IndexID     int64
+	ChunkIds    string
+	DocumentIds string
 }
 
 type Conversation struct {
@@ -39,6 +50,11 @@ type Document struct {
 	Filesha256 string
 }
 
+type DocumentTag struct {
+	DocumentID int64
+	Tag        string
+}
+
 type Index struct {
 	ID          int64
 	CreatedAt   time.Time
@@ -46,6 +62,30 @@ type Index struct {
 	Name        string
 	Description sql.NullString
 	Path        string
+	Collection  string
+}
+
+type IngestionJob struct {
+	ID                 int64
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	IndexID            int64
+	FilePath           string
+	FileSize           int64
+	FileSha256         string
+	FileData           []byte
+	Tags               string
+	ChunkSize          int64
+	RequestDelay       int64
+	Status             string
+	Stage              string
+	Attempts           int64
+	Error              sql.NullString
+	Markdown           sql.NullString
+	Chunks             sql.NullString
+	DocumentID         sql.NullInt64
+	ReplacesDocumentID sql.NullInt64
+	Force              bool
 }
 
 type Message struct {
@@ -58,3 +98,15 @@ type Message struct {
 	Content        string
 	Role           string
 }
+
+type ParseCache struct {
+	ID          int64
+	CreatedAt   time.Time
+	LastUsedAt  time.Time
+	FileSha256  string
+	Settings    string
+	FileName    string
+	Markdown    string
+	Pages       int64
+	CreditsUsed int64
+}
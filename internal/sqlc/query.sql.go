@@ -11,6 +11,100 @@ import (
 	"time"
 )
 
+const addDocumentTag = `-- name: AddDocumentTag :exec
+INSERT OR IGNORE INTO document_tags (document_id, tag) VALUES (?, ?)
+`
+
+type AddDocumentTagParams struct {
+	DocumentID int64
+	Tag        string
+}
+
+func (q *Queries) AddDocumentTag(ctx context.Context, arg AddDocumentTagParams) error {
+	_, err := q.db.ExecContext(ctx, addDocumentTag, arg.DocumentID, arg.Tag)
+	return err
+}
+
+const cancelIngestionJob = `-- name: CancelIngestionJob :execrows
+UPDATE ingestion_jobs
+SET
+    status = 'cancelled',
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = ? AND status IN ('pending', 'running', 'failed')
+`
+
+func (q *Queries) CancelIngestionJob(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelIngestionJob, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const claimIngestionJob = `-- name: ClaimIngestionJob :one
+UPDATE ingestion_jobs
+SET
+    status = 'running',
+    attempts = attempts + 1,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = (
+        SELECT id FROM ingestion_jobs
+        WHERE status = 'pending' OR (status = 'running' AND updated_at < ?)
+        ORDER BY id
+        LIMIT 1
+    )
+RETURNING id, created_at, updated_at, index_id, file_path, file_size, file_sha256, file_data, tags, chunk_size, request_delay, status, stage, attempts, error, markdown, chunks, document_id, replaces_document_id, force
+`
+
+func (q *Queries) ClaimIngestionJob(ctx context.Context, updatedAt time.Time) (IngestionJob, error) {
+	row := q.db.QueryRowContext(ctx, claimIngestionJob, updatedAt)
+	var i IngestionJob
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.IndexID,
+		&i.FilePath,
+		&i.FileSize,
+		&i.FileSha256,
+		&i.FileData,
+		&i.Tags,
+		&i.ChunkSize,
+		&i.RequestDelay,
+		&i.Status,
+		&i.Stage,
+		&i.Attempts,
+		&i.Error,
+		&i.Markdown,
+		&i.Chunks,
+		&i.DocumentID,
+		&i.ReplacesDocumentID,
+		&i.Force,
+	)
+	return i, err
+}
+
+const completeIngestionJob = `-- name: CompleteIngestionJob :exec
+UPDATE ingestion_jobs
+SET
+    status = 'completed',
+    stage = 'committed',
+    error = NULL,
+    file_data = NULL,
+    markdown = NULL,
+    chunks = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = ?
+`
+
+func (q *Queries) CompleteIngestionJob(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, completeIngestionJob, id)
+	return err
+}
+
 const createChunk = `-- name: CreateChunk :one
 INSERT INTO
     chunks (
@@ -19,9 +113,12 @@ INSERT INTO
         end_offset,
         content,
         context,
-        indexing_id
+        indexing_id,
+        page,
+        ordinal,
+        table_sha256
     )
-VALUES (?, ?, ?, ?, ?, ?) RETURNING id, created_at, updated_at, document_id, start_offset, end_offset, content, context, indexing_id
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id, created_at, updated_at, document_id, start_offset, end_offset, content, context, indexing_id, page, ordinal, table_sha256
 `
 
 type CreateChunkParams struct {
@@ -31,6 +128,9 @@ type CreateChunkParams struct {
 	Content     string
 	Context     string
 	IndexingID  string
+	Page        int64
+	Ordinal     sql.NullInt64
+	TableSha256 sql.NullString
 }
 
 func (q *Queries) CreateChunk(ctx context.Context, arg CreateChunkParams) (Chunk, error) {
@@ -41,6 +141,9 @@ func (q *Queries) CreateChunk(ctx context.Context, arg CreateChunkParams) (Chunk
 		arg.Content,
 		arg.Context,
 		arg.IndexingID,
+		arg.Page,
+		arg.Ordinal,
+		arg.TableSha256,
 	)
 	var i Chunk
 	err := row.Scan(
@@ -53,6 +156,38 @@ func (q *Queries) CreateChunk(ctx context.Context, arg CreateChunkParams) (Chunk
 		&i.Content,
 		&i.Context,
 		&i.IndexingID,
+		&i.Page,
+		&i.Ordinal,
+		&i.TableSha256,
+	)
+	return i, err
+}
+
+const createChunkRemoval = `-- name: CreateChunkRemoval :one
+INSERT INTO
+    chunk_removals (
+        index_id,
+        chunk_ids,
+        document_ids
+    )
+VALUES (?, ?, ?) RETURNING id, created_at, index_id, chunk_ids, document_ids
+`
+
+type CreateChunkRemovalParams struct {
+	IndexID     int64
+	ChunkIds    string
+	DocumentIds string
+}
+
+func (q *Queries) CreateChunkRemoval(ctx context.Context, arg CreateChunkRemovalParams) (ChunkRemoval, error) {
+	row := q.db.QueryRowContext(ctx, createChunkRemoval, arg.IndexID, arg.ChunkIds, arg.DocumentIds)
+	var i ChunkRemoval
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.IndexID,
+		&i.ChunkIds,
+		&i.DocumentIds,
 	)
 	return i, err
 }
@@ -117,18 +252,24 @@ func (q *Queries) CreateDocument(ctx context.Context, arg CreateDocumentParams)
 
 const createIndex = `-- name: CreateIndex :one
 INSERT INTO
-    indexes (name, description, path)
-VALUES (?, ?, ?) RETURNING id, created_at, updated_at, name, description, path
+    indexes (name, description, path, collection)
+VALUES (?, ?, ?, ?) RETURNING id, created_at, updated_at, name, description, path, collection
 `
 
 type CreateIndexParams struct {
 	Name        string
 	Description sql.NullString
 	Path        string
+	Collection  string
 }
 
 func (q *Queries) CreateIndex(ctx context.Context, arg CreateIndexParams) (Index, error) {
-	row := q.db.QueryRowContext(ctx, createIndex, arg.Name, arg.Description, arg.Path)
+	row := q.db.QueryRowContext(ctx, createIndex,
+		arg.Name,
+		arg.Description,
+		arg.Path,
+		arg.Collection,
+	)
 	var i Index
 	err := row.Scan(
 		&i.ID,
@@ -137,6 +278,76 @@ func (q *Queries) CreateIndex(ctx context.Context, arg CreateIndexParams) (Index
 		&i.Name,
 		&i.Description,
 		&i.Path,
+		&i.Collection,
+	)
+	return i, err
+}
+
+const createIngestionJob = `-- name: CreateIngestionJob :one
+INSERT INTO
+    ingestion_jobs (
+        index_id,
+        file_path,
+        file_size,
+        file_sha256,
+        file_data,
+        tags,
+        chunk_size,
+        request_delay,
+        replaces_document_id,
+        force
+    )
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id, created_at, updated_at, index_id, file_path, file_size, file_sha256, file_data, tags, chunk_size, request_delay, status, stage, attempts, error, markdown, chunks, document_id, replaces_document_id, force
+`
+
+type CreateIngestionJobParams struct {
+	IndexID            int64
+	FilePath           string
+	FileSize           int64
+	FileSha256         string
+	FileData           []byte
+	Tags               string
+	ChunkSize          int64
+	RequestDelay       int64
+	ReplacesDocumentID sql.NullInt64
+	Force              bool
+}
+
+func (q *Queries) CreateIngestionJob(ctx context.Context, arg CreateIngestionJobParams) (IngestionJob, error) {
+	row := q.db.QueryRowContext(ctx, createIngestionJob,
+		arg.IndexID,
+		arg.FilePath,
+		arg.FileSize,
+		arg.FileSha256,
+		arg.FileData,
+		arg.Tags,
+		arg.ChunkSize,
+		arg.RequestDelay,
+		arg.ReplacesDocumentID,
+		arg.Force,
+	)
+	var i IngestionJob
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.IndexID,
+		&i.FilePath,
+		&i.FileSize,
+		&i.FileSha256,
+		&i.FileData,
+		&i.Tags,
+		&i.ChunkSize,
+		&i.RequestDelay,
+		&i.Status,
+		&i.Stage,
+		&i.Attempts,
+		&i.Error,
+		&i.Markdown,
+		&i.Chunks,
+		&i.DocumentID,
+		&i.ReplacesDocumentID,
+		&i.Force,
 	)
 	return i, err
 }
@@ -192,6 +403,24 @@ func (q *Queries) DeleteChunk(ctx context.Context, id int64) error {
 	return err
 }
 
+const deleteChunkRemoval = `-- name: DeleteChunkRemoval :exec
+DELETE FROM chunk_removals WHERE id = ?
+`
+
+func (q *Queries) DeleteChunkRemoval(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, deleteChunkRemoval, id)
+	return err
+}
+
+const deleteChunksByDocumentID = `-- name: DeleteChunksByDocumentID :exec
+DELETE FROM chunks WHERE document_id = ?
+`
+
+func (q *Queries) DeleteChunksByDocumentID(ctx context.Context, documentID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteChunksByDocumentID, documentID)
+	return err
+}
+
 const deleteConversation = `-- name: DeleteConversation :exec
 DELETE FROM conversations WHERE id = ?
 `
@@ -210,6 +439,15 @@ func (q *Queries) DeleteDocument(ctx context.Context, id int64) error {
 	return err
 }
 
+const deleteDocumentTags = `-- name: DeleteDocumentTags :exec
+DELETE FROM document_tags WHERE document_id = ?
+`
+
+func (q *Queries) DeleteDocumentTags(ctx context.Context, documentID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteDocumentTags, documentID)
+	return err
+}
+
 const deleteIndex = `-- name: DeleteIndex :exec
 DELETE FROM indexes WHERE id = ?
 `
@@ -228,9 +466,145 @@ func (q *Queries) DeleteMessage(ctx context.Context, id int64) error {
 	return err
 }
 
+const deleteOrphanedParseCacheEntries = `-- name: DeleteOrphanedParseCacheEntries :execrows
+DELETE FROM parse_cache
+WHERE file_sha256 NOT IN (SELECT fileSha256 FROM documents)
+`
+
+func (q *Queries) DeleteOrphanedParseCacheEntries(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteOrphanedParseCacheEntries)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteParseCacheEntriesUsedBefore = `-- name: DeleteParseCacheEntriesUsedBefore :execrows
+DELETE FROM parse_cache WHERE last_used_at < ?
+`
+
+func (q *Queries) DeleteParseCacheEntriesUsedBefore(ctx context.Context, lastUsedAt time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteParseCacheEntriesUsedBefore, lastUsedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const detachIngestionJobsFromDocument = `-- name: DetachIngestionJobsFromDocument :exec
+UPDATE ingestion_jobs
+SET
+    document_id = NULLIF(document_id, ?1),
+    replaces_document_id = NULLIF(replaces_document_id, ?1)
+WHERE
+    document_id = ?1 OR replaces_document_id = ?1
+`
+
+func (q *Queries) DetachIngestionJobsFromDocument(ctx context.Context, id sql.NullInt64) error {
+	_, err := q.db.ExecContext(ctx, detachIngestionJobsFromDocument, id)
+	return err
+}
+
+const failIngestionJob = `-- name: FailIngestionJob :exec
+UPDATE ingestion_jobs
+SET
+    status = 'failed',
+    error = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = ? AND status = 'running'
+`
+
+type FailIngestionJobParams struct {
+	Error sql.NullString
+	ID    int64
+}
+
+func (q *Queries) FailIngestionJob(ctx context.Context, arg FailIngestionJobParams) error {
+	_, err := q.db.ExecContext(ctx, failIngestionJob, arg.Error, arg.ID)
+	return err
+}
+
+const getActiveIngestionJobByDocumentID = `-- name: GetActiveIngestionJobByDocumentID :one
+SELECT id, created_at, updated_at, index_id, file_path, file_size, file_sha256, file_data, tags, chunk_size, request_delay, status, stage, attempts, error, markdown, chunks, document_id, replaces_document_id, force FROM ingestion_jobs
+WHERE
+    (document_id = ?1 OR replaces_document_id = ?1)
+    AND status IN ('pending', 'running')
+ORDER BY id
+LIMIT 1
+`
+
+func (q *Queries) GetActiveIngestionJobByDocumentID(ctx context.Context, documentID sql.NullInt64) (IngestionJob, error) {
+	row := q.db.QueryRowContext(ctx, getActiveIngestionJobByDocumentID, documentID)
+	var i IngestionJob
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.IndexID,
+		&i.FilePath,
+		&i.FileSize,
+		&i.FileSha256,
+		&i.FileData,
+		&i.Tags,
+		&i.ChunkSize,
+		&i.RequestDelay,
+		&i.Status,
+		&i.Stage,
+		&i.Attempts,
+		&i.Error,
+		&i.Markdown,
+		&i.Chunks,
+		&i.DocumentID,
+		&i.ReplacesDocumentID,
+		&i.Force,
+	)
+	return i, err
+}
+
+const getActiveIngestionJobBySHA256 = `-- name: GetActiveIngestionJobBySHA256 :one
+SELECT id, created_at, updated_at, index_id, file_path, file_size, file_sha256, file_data, tags, chunk_size, request_delay, status, stage, attempts, error, markdown, chunks, document_id, replaces_document_id, force FROM ingestion_jobs
+WHERE index_id = ? AND file_sha256 = ? AND status IN ('pending', 'running')
+ORDER BY id
+LIMIT 1
+`
+
+type GetActiveIngestionJobBySHA256Params struct {
+	IndexID    int64
+	FileSha256 string
+}
+
+func (q *Queries) GetActiveIngestionJobBySHA256(ctx context.Context, arg GetActiveIngestionJobBySHA256Params) (IngestionJob, error) {
+	row := q.db.QueryRowContext(ctx, getActiveIngestionJobBySHA256, arg.IndexID, arg.FileSha256)
+	var i IngestionJob
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.IndexID,
+		&i.FilePath,
+		&i.FileSize,
+		&i.FileSha256,
+		&i.FileData,
+		&i.Tags,
+		&i.ChunkSize,
+		&i.RequestDelay,
+		&i.Status,
+		&i.Stage,
+		&i.Attempts,
+		&i.Error,
+		&i.Markdown,
+		&i.Chunks,
+		&i.DocumentID,
+		&i.ReplacesDocumentID,
+		&i.Force,
+	)
+	return i, err
+}
+
 const getChunk = `-- name: GetChunk :one
 
-SELECT id, created_at, updated_at, document_id, start_offset, end_offset, content, context, indexing_id FROM chunks WHERE id = ? LIMIT 1
+SELECT id, created_at, updated_at, document_id, start_offset, end_offset, content, context, indexing_id, page, ordinal, table_sha256 FROM chunks WHERE id = ? LIMIT 1
 `
 
 // ------
@@ -249,12 +623,39 @@ func (q *Queries) GetChunk(ctx context.Context, id int64) (Chunk, error) {
 		&i.Content,
 		&i.Context,
 		&i.IndexingID,
+		&i.Page,
+		&i.Ordinal,
+		&i.TableSha256,
+	)
+	return i, err
+}
+
+const getChunkByIndexingID = `-- name: GetChunkByIndexingID :one
+SELECT id, created_at, updated_at, document_id, start_offset, end_offset, content, context, indexing_id, page, ordinal, table_sha256 FROM chunks WHERE indexing_id = ? LIMIT 1
+`
+
+func (q *Queries) GetChunkByIndexingID(ctx context.Context, indexingID string) (Chunk, error) {
+	row := q.db.QueryRowContext(ctx, getChunkByIndexingID, indexingID)
+	var i Chunk
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DocumentID,
+		&i.StartOffset,
+		&i.EndOffset,
+		&i.Content,
+		&i.Context,
+		&i.IndexingID,
+		&i.Page,
+		&i.Ordinal,
+		&i.TableSha256,
 	)
 	return i, err
 }
 
 const getChunksByDocumentID = `-- name: GetChunksByDocumentID :many
-SELECT id, created_at, updated_at, document_id, start_offset, end_offset, content, context, indexing_id FROM chunks WHERE document_id = ?
+SELECT id, created_at, updated_at, document_id, start_offset, end_offset, content, context, indexing_id, page, ordinal, table_sha256 FROM chunks WHERE document_id = ?
 `
 
 func (q *Queries) GetChunksByDocumentID(ctx context.Context, documentID int64) ([]Chunk, error) {
@@ -276,6 +677,9 @@ func (q *Queries) GetChunksByDocumentID(ctx context.Context, documentID int64) (
 			&i.Content,
 			&i.Context,
 			&i.IndexingID,
+			&i.Page,
+			&i.Ordinal,
+			&i.TableSha256,
 		); err != nil {
 			return nil, err
 		}
@@ -350,29 +754,9 @@ func (q *Queries) GetDocument(ctx context.Context, id int64) (Document, error) {
 	return i, err
 }
 
-const getDocumentBySHA256 = `-- name: GetDocumentBySHA256 :one
-SELECT id, created_at, updated_at, index_id, filepath, filetype, filesize, filesha256 FROM documents WHERE fileSha256 = ? LIMIT 1
-`
-
-func (q *Queries) GetDocumentBySHA256(ctx context.Context, filesha256 string) (Document, error) {
-	row := q.db.QueryRowContext(ctx, getDocumentBySHA256, filesha256)
-	var i Document
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.IndexID,
-		&i.Filepath,
-		&i.Filetype,
-		&i.Filesize,
-		&i.Filesha256,
-	)
-	return i, err
-}
-
 const getIndex = `-- name: GetIndex :one
 
-SELECT id, created_at, updated_at, name, description, path FROM indexes WHERE id = ? LIMIT 1
+SELECT id, created_at, updated_at, name, description, path, collection FROM indexes WHERE id = ? LIMIT 1
 `
 
 // ------
@@ -388,12 +772,13 @@ func (q *Queries) GetIndex(ctx context.Context, id int64) (Index, error) {
 		&i.Name,
 		&i.Description,
 		&i.Path,
+		&i.Collection,
 	)
 	return i, err
 }
 
 const getIndexByName = `-- name: GetIndexByName :one
-SELECT id, created_at, updated_at, name, description, path FROM indexes WHERE name = ? LIMIT 1
+SELECT id, created_at, updated_at, name, description, path, collection FROM indexes WHERE name = ? LIMIT 1
 `
 
 func (q *Queries) GetIndexByName(ctx context.Context, name string) (Index, error) {
@@ -406,6 +791,61 @@ func (q *Queries) GetIndexByName(ctx context.Context, name string) (Index, error
 		&i.Name,
 		&i.Description,
 		&i.Path,
+		&i.Collection,
+	)
+	return i, err
+}
+
+const getIndexStats = `-- name: GetIndexStats :one
+SELECT
+    (SELECT count(*) FROM documents WHERE documents.index_id = ?1) AS document_count,
+    (SELECT count(*) FROM chunks
+        JOIN documents ON documents.id = chunks.document_id
+    WHERE documents.index_id = ?1) AS chunk_count,
+    CAST((SELECT coalesce(sum(fileSize), 0) FROM documents WHERE documents.index_id = ?1) AS INTEGER) AS total_bytes
+`
+
+type GetIndexStatsRow struct {
+	DocumentCount int64
+	ChunkCount    int64
+	TotalBytes    int64
+}
+
+func (q *Queries) GetIndexStats(ctx context.Context, indexID int64) (GetIndexStatsRow, error) {
+	row := q.db.QueryRowContext(ctx, getIndexStats, indexID)
+	var i GetIndexStatsRow
+	err := row.Scan(&i.DocumentCount, &i.ChunkCount, &i.TotalBytes)
+	return i, err
+}
+
+const getIngestionJob = `-- name: GetIngestionJob :one
+SELECT id, created_at, updated_at, index_id, file_path, file_size, file_sha256, file_data, tags, chunk_size, request_delay, status, stage, attempts, error, markdown, chunks, document_id, replaces_document_id, force FROM ingestion_jobs WHERE id = ? LIMIT 1
+`
+
+func (q *Queries) GetIngestionJob(ctx context.Context, id int64) (IngestionJob, error) {
+	row := q.db.QueryRowContext(ctx, getIngestionJob, id)
+	var i IngestionJob
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.IndexID,
+		&i.FilePath,
+		&i.FileSize,
+		&i.FileSha256,
+		&i.FileData,
+		&i.Tags,
+		&i.ChunkSize,
+		&i.RequestDelay,
+		&i.Status,
+		&i.Stage,
+		&i.Attempts,
+		&i.Error,
+		&i.Markdown,
+		&i.Chunks,
+		&i.DocumentID,
+		&i.ReplacesDocumentID,
+		&i.Force,
 	)
 	return i, err
 }
@@ -434,65 +874,49 @@ func (q *Queries) GetMessage(ctx context.Context, id int64) (Message, error) {
 	return i, err
 }
 
-const listChunks = `-- name: ListChunks :many
-SELECT id, created_at, updated_at, document_id, start_offset, end_offset, content, context, indexing_id FROM chunks ORDER BY start_offset
+const getParseCacheEntry = `-- name: GetParseCacheEntry :one
+SELECT id, created_at, last_used_at, file_sha256, settings, file_name, markdown, pages, credits_used FROM parse_cache WHERE file_sha256 = ? AND settings = ? LIMIT 1
 `
 
-func (q *Queries) ListChunks(ctx context.Context) ([]Chunk, error) {
-	rows, err := q.db.QueryContext(ctx, listChunks)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []Chunk
-	for rows.Next() {
-		var i Chunk
-		if err := rows.Scan(
-			&i.ID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.DocumentID,
-			&i.StartOffset,
-			&i.EndOffset,
-			&i.Content,
-			&i.Context,
-			&i.IndexingID,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
+type GetParseCacheEntryParams struct {
+	FileSha256 string
+	Settings   string
 }
 
-const listConversations = `-- name: ListConversations :many
-SELECT id, session_id, created_at, updated_at FROM conversations ORDER BY created_at
+func (q *Queries) GetParseCacheEntry(ctx context.Context, arg GetParseCacheEntryParams) (ParseCache, error) {
+	row := q.db.QueryRowContext(ctx, getParseCacheEntry, arg.FileSha256, arg.Settings)
+	var i ParseCache
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+		&i.FileSha256,
+		&i.Settings,
+		&i.FileName,
+		&i.Markdown,
+		&i.Pages,
+		&i.CreditsUsed,
+	)
+	return i, err
+}
+
+const getTagsByDocumentID = `-- name: GetTagsByDocumentID :many
+SELECT tag FROM document_tags WHERE document_id = ? ORDER BY tag
 `
 
-func (q *Queries) ListConversations(ctx context.Context) ([]Conversation, error) {
-	rows, err := q.db.QueryContext(ctx, listConversations)
+func (q *Queries) GetTagsByDocumentID(ctx context.Context, documentID int64) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, getTagsByDocumentID, documentID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Conversation
+	var items []string
 	for rows.Next() {
-		var i Conversation
-		if err := rows.Scan(
-			&i.ID,
-			&i.SessionID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-		); err != nil {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
 			return nil, err
 		}
-		items = append(items, i)
+		items = append(items, tag)
 	}
 	if err := rows.Close(); err != nil {
 		return nil, err
@@ -503,14 +927,542 @@ func (q *Queries) ListConversations(ctx context.Context) ([]Conversation, error)
 	return items, nil
 }
 
-const listDocuments = `-- name: ListDocuments :many
-SELECT id, created_at, updated_at, index_id, filepath, filetype, filesize, filesha256 FROM documents ORDER BY created_at
-`
-
-func (q *Queries) ListDocuments(ctx context.Context) ([]Document, error) {
-	rows, err := q.db.QueryContext(ctx, listDocuments)
-	if err != nil {
-		return nil, err
+const importDocument = `-- name: ImportDocument :one
+INSERT INTO
+    documents (
+        id,
+        created_at,
+        index_id,
+        filePath,
+        fileType,
+        fileSize,
+        fileSha256
+    )
+VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7) RETURNING id, created_at, updated_at, index_id, filepath, filetype, filesize, filesha256
+`
+
+type ImportDocumentParams struct {
+	ID         sql.NullInt64
+	CreatedAt  time.Time
+	IndexID    int64
+	Filepath   string
+	Filetype   string
+	Filesize   int64
+	Filesha256 string
+}
+
+func (q *Queries) ImportDocument(ctx context.Context, arg ImportDocumentParams) (Document, error) {
+	row := q.db.QueryRowContext(ctx, importDocument,
+		arg.ID,
+		arg.CreatedAt,
+		arg.IndexID,
+		arg.Filepath,
+		arg.Filetype,
+		arg.Filesize,
+		arg.Filesha256,
+	)
+	var i Document
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.IndexID,
+		&i.Filepath,
+		&i.Filetype,
+		&i.Filesize,
+		&i.Filesha256,
+	)
+	return i, err
+}
+
+const listActiveIngestionJobChunksByIndexID = `-- name: ListActiveIngestionJobChunksByIndexID :many
+SELECT
+    chunks
+FROM
+    ingestion_jobs
+WHERE
+    index_id = ? AND status IN ('pending', 'running') AND chunks IS NOT NULL
+`
+
+func (q *Queries) ListActiveIngestionJobChunksByIndexID(ctx context.Context, indexID int64) ([]sql.NullString, error) {
+	rows, err := q.db.QueryContext(ctx, listActiveIngestionJobChunksByIndexID, indexID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []sql.NullString
+	for rows.Next() {
+		var chunks sql.NullString
+		if err := rows.Scan(&chunks); err != nil {
+			return nil, err
+		}
+		items = append(items, chunks)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listActiveIngestionJobsByIndexID = `-- name: ListActiveIngestionJobsByIndexID :many
+SELECT
+    file_path,
+    file_sha256
+FROM
+    ingestion_jobs
+WHERE
+    index_id = ? AND status IN ('pending', 'running')
+`
+
+type ListActiveIngestionJobsByIndexIDRow struct {
+	FilePath   string
+	FileSha256 string
+}
+
+func (q *Queries) ListActiveIngestionJobsByIndexID(ctx context.Context, indexID int64) ([]ListActiveIngestionJobsByIndexIDRow, error) {
+	rows, err := q.db.QueryContext(ctx, listActiveIngestionJobsByIndexID, indexID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListActiveIngestionJobsByIndexIDRow
+	for rows.Next() {
+		var i ListActiveIngestionJobsByIndexIDRow
+		if err := rows.Scan(
+			&i.FilePath,
+			&i.FileSha256,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChunkRemovals = `-- name: ListChunkRemovals :many
+SELECT id, created_at, index_id, chunk_ids, document_ids FROM chunk_removals ORDER BY id
+`
+
+func (q *Queries) ListChunkRemovals(ctx context.Context) ([]ChunkRemoval, error) {
+	rows, err := q.db.QueryContext(ctx, listChunkRemovals)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChunkRemoval
+	for rows.Next() {
+		var i ChunkRemoval
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.IndexID,
+			&i.ChunkIds,
+			&i.DocumentIds,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChunks = `-- name: ListChunks :many
+SELECT id, created_at, updated_at, document_id, start_offset, end_offset, content, context, indexing_id, page, ordinal, table_sha256 FROM chunks ORDER BY start_offset
+`
+
+func (q *Queries) ListChunks(ctx context.Context) ([]Chunk, error) {
+	rows, err := q.db.QueryContext(ctx, listChunks)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chunk
+	for rows.Next() {
+		var i Chunk
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DocumentID,
+			&i.StartOffset,
+			&i.EndOffset,
+			&i.Content,
+			&i.Context,
+			&i.IndexingID,
+			&i.Page,
+			&i.Ordinal,
+			&i.TableSha256,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChunksByIndexID = `-- name: ListChunksByIndexID :many
+SELECT chunks.id, chunks.created_at, chunks.updated_at, chunks.document_id, chunks.start_offset, chunks.end_offset, chunks.content, chunks.context, chunks.indexing_id, chunks.page, chunks.ordinal, chunks.table_sha256 FROM chunks
+    JOIN documents ON documents.id = chunks.document_id
+WHERE documents.index_id = ?
+ORDER BY chunks.document_id, chunks.ordinal, chunks.id
+`
+
+func (q *Queries) ListChunksByIndexID(ctx context.Context, indexID int64) ([]Chunk, error) {
+	rows, err := q.db.QueryContext(ctx, listChunksByIndexID, indexID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chunk
+	for rows.Next() {
+		var i Chunk
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DocumentID,
+			&i.StartOffset,
+			&i.EndOffset,
+			&i.Content,
+			&i.Context,
+			&i.IndexingID,
+			&i.Page,
+			&i.Ordinal,
+			&i.TableSha256,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChunksByOrdinalRange = `-- name: ListChunksByOrdinalRange :many
+SELECT id, created_at, updated_at, document_id, start_offset, end_offset, content, context, indexing_id, page, ordinal, table_sha256 FROM chunks
+WHERE document_id = ?1 AND ordinal BETWEEN ?2 AND ?3
+ORDER BY ordinal
+`
+
+type ListChunksByOrdinalRangeParams struct {
+	DocumentID   int64
+	FirstOrdinal sql.NullInt64
+	LastOrdinal  sql.NullInt64
+}
+
+func (q *Queries) ListChunksByOrdinalRange(ctx context.Context, arg ListChunksByOrdinalRangeParams) ([]Chunk, error) {
+	rows, err := q.db.QueryContext(ctx, listChunksByOrdinalRange, arg.DocumentID, arg.FirstOrdinal, arg.LastOrdinal)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chunk
+	for rows.Next() {
+		var i Chunk
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DocumentID,
+			&i.StartOffset,
+			&i.EndOffset,
+			&i.Content,
+			&i.Context,
+			&i.IndexingID,
+			&i.Page,
+			&i.Ordinal,
+			&i.TableSha256,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listConversations = `-- name: ListConversations :many
+SELECT id, session_id, created_at, updated_at FROM conversations ORDER BY created_at
+`
+
+func (q *Queries) ListConversations(ctx context.Context) ([]Conversation, error) {
+	rows, err := q.db.QueryContext(ctx, listConversations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Conversation
+	for rows.Next() {
+		var i Conversation
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDocuments = `-- name: ListDocuments :many
+SELECT id, created_at, updated_at, index_id, filepath, filetype, filesize, filesha256 FROM documents ORDER BY created_at
+`
+
+func (q *Queries) ListDocuments(ctx context.Context) ([]Document, error) {
+	rows, err := q.db.QueryContext(ctx, listDocuments)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Document
+	for rows.Next() {
+		var i Document
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.IndexID,
+			&i.Filepath,
+			&i.Filetype,
+			&i.Filesize,
+			&i.Filesha256,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDocumentsByIndexID = `-- name: ListDocumentsByIndexID :many
+SELECT id, created_at, updated_at, index_id, filepath, filetype, filesize, filesha256 FROM documents WHERE index_id = ? ORDER BY id
+`
+
+func (q *Queries) ListDocumentsByIndexID(ctx context.Context, indexID int64) ([]Document, error) {
+	rows, err := q.db.QueryContext(ctx, listDocumentsByIndexID, indexID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Document
+	for rows.Next() {
+		var i Document
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.IndexID,
+			&i.Filepath,
+			&i.Filetype,
+			&i.Filesize,
+			&i.Filesha256,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDocumentsByPath = `-- name: ListDocumentsByPath :many
+SELECT id, created_at, updated_at, index_id, filepath, filetype, filesize, filesha256 FROM documents WHERE index_id = ? AND filePath = ? ORDER BY id
+`
+
+type ListDocumentsByPathParams struct {
+	IndexID  int64
+	Filepath string
+}
+
+func (q *Queries) ListDocumentsByPath(ctx context.Context, arg ListDocumentsByPathParams) ([]Document, error) {
+	rows, err := q.db.QueryContext(ctx, listDocumentsByPath, arg.IndexID, arg.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Document
+	for rows.Next() {
+		var i Document
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.IndexID,
+			&i.Filepath,
+			&i.Filetype,
+			&i.Filesize,
+			&i.Filesha256,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDocumentsBySHA256 = `-- name: ListDocumentsBySHA256 :many
+SELECT id, created_at, updated_at, index_id, filepath, filetype, filesize, filesha256 FROM documents WHERE index_id = ? AND fileSha256 = ? ORDER BY id
+`
+
+type ListDocumentsBySHA256Params struct {
+	IndexID    int64
+	Filesha256 string
+}
+
+func (q *Queries) ListDocumentsBySHA256(ctx context.Context, arg ListDocumentsBySHA256Params) ([]Document, error) {
+	rows, err := q.db.QueryContext(ctx, listDocumentsBySHA256, arg.IndexID, arg.Filesha256)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Document
+	for rows.Next() {
+		var i Document
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.IndexID,
+			&i.Filepath,
+			&i.Filetype,
+			&i.Filesize,
+			&i.Filesha256,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDocumentSummariesByIndexID = `-- name: ListDocumentSummariesByIndexID :many
+SELECT
+    documents.id, documents.created_at, documents.updated_at, documents.index_id, documents.filepath, documents.filetype, documents.filesize, documents.filesha256,
+    (SELECT count(*) FROM chunks WHERE chunks.document_id = documents.id) AS chunk_count
+FROM
+    documents
+WHERE
+    index_id = ?
+ORDER BY
+    filePath
+`
+
+type ListDocumentSummariesByIndexIDRow struct {
+	ID         int64
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	IndexID    int64
+	Filepath   string
+	Filetype   string
+	Filesize   int64
+	Filesha256 string
+	ChunkCount int64
+}
+
+func (q *Queries) ListDocumentSummariesByIndexID(ctx context.Context, indexID int64) ([]ListDocumentSummariesByIndexIDRow, error) {
+	rows, err := q.db.QueryContext(ctx, listDocumentSummariesByIndexID, indexID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListDocumentSummariesByIndexIDRow
+	for rows.Next() {
+		var i ListDocumentSummariesByIndexIDRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.IndexID,
+			&i.Filepath,
+			&i.Filetype,
+			&i.Filesize,
+			&i.Filesha256,
+			&i.ChunkCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDocumentsWithRelativePath = `-- name: ListDocumentsWithRelativePath :many
+SELECT id, created_at, updated_at, index_id, filepath, filetype, filesize, filesha256 FROM documents WHERE index_id = ? AND filePath NOT LIKE '/%' ORDER BY id
+`
+
+func (q *Queries) ListDocumentsWithRelativePath(ctx context.Context, indexID int64) ([]Document, error) {
+	rows, err := q.db.QueryContext(ctx, listDocumentsWithRelativePath, indexID)
+	if err != nil {
+		return nil, err
 	}
 	defer rows.Close()
 	var items []Document
@@ -540,7 +1492,7 @@ func (q *Queries) ListDocuments(ctx context.Context) ([]Document, error) {
 }
 
 const listIndexes = `-- name: ListIndexes :many
-SELECT id, created_at, updated_at, name, description, path FROM indexes ORDER BY name
+SELECT id, created_at, updated_at, name, description, path, collection FROM indexes ORDER BY name
 `
 
 func (q *Queries) ListIndexes(ctx context.Context) ([]Index, error) {
@@ -559,6 +1511,124 @@ func (q *Queries) ListIndexes(ctx context.Context) ([]Index, error) {
 			&i.Name,
 			&i.Description,
 			&i.Path,
+			&i.Collection,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listIngestionJobs = `-- name: ListIngestionJobs :many
+SELECT
+    ingestion_jobs.id,
+    ingestion_jobs.created_at,
+    ingestion_jobs.updated_at,
+    indexes.name AS index_name,
+    ingestion_jobs.file_path,
+    ingestion_jobs.file_size,
+    ingestion_jobs.status,
+    ingestion_jobs.stage,
+    ingestion_jobs.attempts,
+    ingestion_jobs.error
+FROM ingestion_jobs
+    JOIN indexes ON indexes.id = ingestion_jobs.index_id
+ORDER BY ingestion_jobs.id DESC
+`
+
+type ListIngestionJobsRow struct {
+	ID        int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	IndexName string
+	FilePath  string
+	FileSize  int64
+	Status    string
+	Stage     string
+	Attempts  int64
+	Error     sql.NullString
+}
+
+func (q *Queries) ListIngestionJobs(ctx context.Context) ([]ListIngestionJobsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listIngestionJobs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListIngestionJobsRow
+	for rows.Next() {
+		var i ListIngestionJobsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.IndexName,
+			&i.FilePath,
+			&i.FileSize,
+			&i.Status,
+			&i.Stage,
+			&i.Attempts,
+			&i.Error,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listIngestionJobsToRecover = `-- name: ListIngestionJobsToRecover :many
+SELECT id, created_at, updated_at, index_id, file_path, file_size, file_sha256, file_data, tags, chunk_size, request_delay, status, stage, attempts, error, markdown, chunks, document_id, replaces_document_id, force FROM ingestion_jobs
+WHERE
+    document_id IS NOT NULL
+    AND stage != 'committed'
+    AND (status IN ('pending', 'failed', 'cancelled') OR (status = 'running' AND updated_at < ?))
+ORDER BY id
+`
+
+func (q *Queries) ListIngestionJobsToRecover(ctx context.Context, updatedAt time.Time) ([]IngestionJob, error) {
+	rows, err := q.db.QueryContext(ctx, listIngestionJobsToRecover, updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []IngestionJob
+	for rows.Next() {
+		var i IngestionJob
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.IndexID,
+			&i.FilePath,
+			&i.FileSize,
+			&i.FileSha256,
+			&i.FileData,
+			&i.Tags,
+			&i.ChunkSize,
+			&i.RequestDelay,
+			&i.Status,
+			&i.Stage,
+			&i.Attempts,
+			&i.Error,
+			&i.Markdown,
+			&i.Chunks,
+			&i.DocumentID,
+			&i.ReplacesDocumentID,
+			&i.Force,
 		); err != nil {
 			return nil, err
 		}
@@ -609,6 +1679,219 @@ func (q *Queries) ListMessages(ctx context.Context) ([]Message, error) {
 	return items, nil
 }
 
+const listParseCacheEntries = `-- name: ListParseCacheEntries :many
+SELECT
+    id,
+    created_at,
+    last_used_at,
+    file_sha256,
+    settings,
+    file_name,
+    pages,
+    credits_used,
+    length(markdown) AS size
+FROM parse_cache
+ORDER BY last_used_at DESC
+`
+
+type ListParseCacheEntriesRow struct {
+	ID          int64
+	CreatedAt   time.Time
+	LastUsedAt  time.Time
+	FileSha256  string
+	Settings    string
+	FileName    string
+	Pages       int64
+	CreditsUsed int64
+	Size        int64
+}
+
+func (q *Queries) ListParseCacheEntries(ctx context.Context) ([]ListParseCacheEntriesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listParseCacheEntries)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListParseCacheEntriesRow
+	for rows.Next() {
+		var i ListParseCacheEntriesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+			&i.FileSha256,
+			&i.Settings,
+			&i.FileName,
+			&i.Pages,
+			&i.CreditsUsed,
+			&i.Size,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockIngestionJob = `-- name: LockIngestionJob :execrows
+UPDATE ingestion_jobs
+SET
+    status = 'running',
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = ? AND status = ? AND (status != 'running' OR updated_at < ?)
+`
+
+type LockIngestionJobParams struct {
+	ID        int64
+	Status    string
+	UpdatedAt time.Time
+}
+
+func (q *Queries) LockIngestionJob(ctx context.Context, arg LockIngestionJobParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, lockIngestionJob, arg.ID, arg.Status, arg.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const releaseIngestionJob = `-- name: ReleaseIngestionJob :exec
+UPDATE ingestion_jobs
+SET
+    status = 'pending',
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = ? AND status = 'running'
+`
+
+func (q *Queries) ReleaseIngestionJob(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, releaseIngestionJob, id)
+	return err
+}
+
+const retryIngestionJob = `-- name: RetryIngestionJob :execrows
+UPDATE ingestion_jobs
+SET
+    status = 'pending',
+    error = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = ? AND status IN ('failed', 'cancelled')
+`
+
+func (q *Queries) RetryIngestionJob(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, retryIngestionJob, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const sampleChunkIDsByIndexID = `-- name: SampleChunkIDsByIndexID :many
+SELECT chunks.id FROM chunks
+    JOIN documents ON documents.id = chunks.document_id
+WHERE documents.index_id = ?
+ORDER BY random()
+`
+
+func (q *Queries) SampleChunkIDsByIndexID(ctx context.Context, indexID int64) ([]int64, error) {
+	rows, err := q.db.QueryContext(ctx, sampleChunkIDsByIndexID, indexID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const saveIngestionJobProgress = `-- name: SaveIngestionJobProgress :exec
+UPDATE ingestion_jobs
+SET
+    stage = ?,
+    markdown = ?,
+    chunks = ?,
+    document_id = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = ?
+`
+
+type SaveIngestionJobProgressParams struct {
+	Stage      string
+	Markdown   sql.NullString
+	Chunks     sql.NullString
+	DocumentID sql.NullInt64
+	ID         int64
+}
+
+func (q *Queries) SaveIngestionJobProgress(ctx context.Context, arg SaveIngestionJobProgressParams) error {
+	_, err := q.db.ExecContext(ctx, saveIngestionJobProgress,
+		arg.Stage,
+		arg.Markdown,
+		arg.Chunks,
+		arg.DocumentID,
+		arg.ID,
+	)
+	return err
+}
+
+const setIngestionJobStatus = `-- name: SetIngestionJobStatus :exec
+UPDATE ingestion_jobs
+SET
+    status = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = ?
+`
+
+type SetIngestionJobStatusParams struct {
+	Status string
+	ID     int64
+}
+
+func (q *Queries) SetIngestionJobStatus(ctx context.Context, arg SetIngestionJobStatusParams) error {
+	_, err := q.db.ExecContext(ctx, setIngestionJobStatus, arg.Status, arg.ID)
+	return err
+}
+
+const touchIngestionJob = `-- name: TouchIngestionJob :exec
+UPDATE ingestion_jobs SET updated_at = CURRENT_TIMESTAMP WHERE id = ?
+`
+
+func (q *Queries) TouchIngestionJob(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, touchIngestionJob, id)
+	return err
+}
+
+const touchParseCacheEntry = `-- name: TouchParseCacheEntry :exec
+UPDATE parse_cache SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?
+`
+
+func (q *Queries) TouchParseCacheEntry(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, touchParseCacheEntry, id)
+	return err
+}
+
 const updateChunk = `-- name: UpdateChunk :exec
 UPDATE chunks
 SET
@@ -683,6 +1966,27 @@ func (q *Queries) UpdateDocument(ctx context.Context, arg UpdateDocumentParams)
 	return err
 }
 
+const updateDocumentContent = `-- name: UpdateDocumentContent :exec
+UPDATE documents
+SET
+    fileSize = ?,
+    fileSha256 = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = ?
+`
+
+type UpdateDocumentContentParams struct {
+	Filesize   int64
+	Filesha256 string
+	ID         int64
+}
+
+func (q *Queries) UpdateDocumentContent(ctx context.Context, arg UpdateDocumentContentParams) error {
+	_, err := q.db.ExecContext(ctx, updateDocumentContent, arg.Filesize, arg.Filesha256, arg.ID)
+	return err
+}
+
 const updateIndex = `-- name: UpdateIndex :exec
 UPDATE indexes SET name = ?, description = ? WHERE id = ?
 `
@@ -698,6 +2002,34 @@ func (q *Queries) UpdateIndex(ctx context.Context, arg UpdateIndexParams) error
 	return err
 }
 
+const updateIndexCollection = `-- name: UpdateIndexCollection :exec
+UPDATE indexes SET collection = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+`
+
+type UpdateIndexCollectionParams struct {
+	Collection string
+	ID         int64
+}
+
+func (q *Queries) UpdateIndexCollection(ctx context.Context, arg UpdateIndexCollectionParams) error {
+	_, err := q.db.ExecContext(ctx, updateIndexCollection, arg.Collection, arg.ID)
+	return err
+}
+
+const updateIndexPath = `-- name: UpdateIndexPath :exec
+UPDATE indexes SET path = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+`
+
+type UpdateIndexPathParams struct {
+	Path string
+	ID   int64
+}
+
+func (q *Queries) UpdateIndexPath(ctx context.Context, arg UpdateIndexPathParams) error {
+	_, err := q.db.ExecContext(ctx, updateIndexPath, arg.Path, arg.ID)
+	return err
+}
+
 const updateMessage = `-- name: UpdateMessage :exec
 UPDATE messages
 SET
@@ -730,3 +2062,44 @@ func (q *Queries) UpdateMessage(ctx context.Context, arg UpdateMessageParams) er
 	)
 	return err
 }
+
+const upsertParseCacheEntry = `-- name: UpsertParseCacheEntry :exec
+INSERT INTO
+    parse_cache (
+        file_sha256,
+        settings,
+        file_name,
+        markdown,
+        pages,
+        credits_used
+    )
+VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT (file_sha256, settings) DO UPDATE
+SET
+    file_name = excluded.file_name,
+    markdown = excluded.markdown,
+    pages = excluded.pages,
+    credits_used = excluded.credits_used,
+    last_used_at = CURRENT_TIMESTAMP
+`
+
+type UpsertParseCacheEntryParams struct {
+	FileSha256  string
+	Settings    string
+	FileName    string
+	Markdown    string
+	Pages       int64
+	CreditsUsed int64
+}
+
+func (q *Queries) UpsertParseCacheEntry(ctx context.Context, arg UpsertParseCacheEntryParams) error {
+	_, err := q.db.ExecContext(ctx, upsertParseCacheEntry,
+		arg.FileSha256,
+		arg.Settings,
+		arg.FileName,
+		arg.Markdown,
+		arg.Pages,
+		arg.CreditsUsed,
+	)
+	return err
+}
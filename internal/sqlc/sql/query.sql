@@ -11,14 +11,28 @@ SELECT * FROM indexes WHERE name = ? LIMIT 1;
 -- name: ListIndexes :many
 SELECT * FROM indexes ORDER BY name;
 
+-- name: GetIndexStats :one
+SELECT
+    (SELECT count(*) FROM documents WHERE documents.index_id = ?1) AS document_count,
+    (SELECT count(*) FROM chunks
+        JOIN documents ON documents.id = chunks.document_id
+    WHERE documents.index_id = ?1) AS chunk_count,
+    CAST((SELECT coalesce(sum(fileSize), 0) FROM documents WHERE documents.index_id = ?1) AS INTEGER) AS total_bytes;
+
 -- name: CreateIndex :one
 INSERT INTO
-    indexes (name, description, path)
-VALUES (?, ?, ?) RETURNING *;
+    indexes (name, description, path, collection)
+VALUES (?, ?, ?, ?) RETURNING *;
 
 -- name: UpdateIndex :exec
 UPDATE indexes SET name = ?, description = ? WHERE id = ?;
 
+-- name: UpdateIndexPath :exec
+UPDATE indexes SET path = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?;
+
+-- name: UpdateIndexCollection :exec
+UPDATE indexes SET collection = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?;
+
 -- name: DeleteIndex :exec
 DELETE FROM indexes WHERE id = ?;
 
@@ -29,12 +43,32 @@ DELETE FROM indexes WHERE id = ?;
 -- name: GetDocument :one
 SELECT * FROM documents WHERE id = ? LIMIT 1;
 
--- name: GetDocumentBySHA256 :one
-SELECT * FROM documents WHERE fileSha256 = ? LIMIT 1;
-
 -- name: ListDocuments :many
 SELECT * FROM documents ORDER BY created_at;
 
+-- name: ListDocumentsByIndexID :many
+SELECT * FROM documents WHERE index_id = ? ORDER BY id;
+
+-- name: ListDocumentsBySHA256 :many
+SELECT * FROM documents WHERE index_id = ? AND fileSha256 = ? ORDER BY id;
+
+-- name: ListDocumentsByPath :many
+SELECT * FROM documents WHERE index_id = ? AND filePath = ? ORDER BY id;
+
+-- name: ListDocumentsWithRelativePath :many
+SELECT * FROM documents WHERE index_id = ? AND filePath NOT LIKE '/%' ORDER BY id;
+
+-- name: ListDocumentSummariesByIndexID :many
+SELECT
+    documents.*,
+    (SELECT count(*) FROM chunks WHERE chunks.document_id = documents.id) AS chunk_count
+FROM
+    documents
+WHERE
+    index_id = ?
+ORDER BY
+    filePath;
+
 -- name: CreateDocument :one
 INSERT INTO
     documents (
@@ -46,6 +80,19 @@ INSERT INTO
     )
 VALUES (?, ?, ?, ?, ?) RETURNING *;
 
+-- name: ImportDocument :one
+INSERT INTO
+    documents (
+        id,
+        created_at,
+        index_id,
+        filePath,
+        fileType,
+        fileSize,
+        fileSha256
+    )
+VALUES (sqlc.narg('id'), ?, ?, ?, ?, ?, ?) RETURNING *;
+
 -- name: UpdateDocument :exec
 UPDATE documents
 SET
@@ -55,9 +102,31 @@ SET
 WHERE
     id = ?;
 
+-- name: UpdateDocumentContent :exec
+UPDATE documents
+SET
+    fileSize = ?,
+    fileSha256 = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = ?;
+
 -- name: DeleteDocument :exec
 DELETE FROM documents WHERE id = ?;
 
+--------
+-- document_tags
+--------
+
+-- name: AddDocumentTag :exec
+INSERT OR IGNORE INTO document_tags (document_id, tag) VALUES (?, ?);
+
+-- name: DeleteDocumentTags :exec
+DELETE FROM document_tags WHERE document_id = ?;
+
+-- name: GetTagsByDocumentID :many
+SELECT tag FROM document_tags WHERE document_id = ? ORDER BY tag;
+
 --------
 -- chunks
 --------
@@ -65,9 +134,29 @@ DELETE FROM documents WHERE id = ?;
 -- name: GetChunk :one
 SELECT * FROM chunks WHERE id = ? LIMIT 1;
 
+-- name: GetChunkByIndexingID :one
+SELECT * FROM chunks WHERE indexing_id = ? LIMIT 1;
+
 -- name: GetChunksByDocumentID :many
 SELECT * FROM chunks WHERE document_id = ?;
 
+-- name: ListChunksByIndexID :many
+SELECT chunks.* FROM chunks
+    JOIN documents ON documents.id = chunks.document_id
+WHERE documents.index_id = ?
+ORDER BY chunks.document_id, chunks.ordinal, chunks.id;
+
+-- name: ListChunksByOrdinalRange :many
+SELECT * FROM chunks
+WHERE document_id = sqlc.arg('document_id') AND ordinal BETWEEN sqlc.arg('first_ordinal') AND sqlc.arg('last_ordinal')
+ORDER BY ordinal;
+
+-- name: SampleChunkIDsByIndexID :many
+SELECT chunks.id FROM chunks
+    JOIN documents ON documents.id = chunks.document_id
+WHERE documents.index_id = ?
+ORDER BY random();
+
 -- name: ListChunks :many
 SELECT * FROM chunks ORDER BY start_offset;
 
@@ -79,9 +168,12 @@ INSERT INTO
         end_offset,
         content,
         context,
-        indexing_id
+        indexing_id,
+        page,
+        ordinal,
+        table_sha256
     )
-VALUES (?, ?, ?, ?, ?, ?) RETURNING *;
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING *;
 
 -- name: UpdateChunk :exec
 UPDATE chunks
@@ -97,6 +189,28 @@ WHERE
 -- name: DeleteChunk :exec
 DELETE FROM chunks WHERE id = ?;
 
+-- name: DeleteChunksByDocumentID :exec
+DELETE FROM chunks WHERE document_id = ?;
+
+--------
+-- chunk_removals
+--------
+
+-- name: ListChunkRemovals :many
+SELECT * FROM chunk_removals ORDER BY id;
+
+-- name: CreateChunkRemoval :one
+INSERT INTO
+    chunk_removals (
+        index_id,
+        chunk_ids,
+        document_ids
+    )
+VALUES (?, ?, ?) RETURNING *;
+
+-- name: DeleteChunkRemoval :exec
+DELETE FROM chunk_removals WHERE id = ?;
+
 --------
 -- conversations
 --------
@@ -152,4 +266,232 @@ WHERE
     id = ?;
 
 -- name: DeleteMessage :exec
-DELETE FROM messages WHERE id = ?;
\ No newline at end of file
+DELETE FROM messages WHERE id = ?;
+
+--------
+-- parse_cache
+--------
+
+-- name: GetParseCacheEntry :one
+SELECT * FROM parse_cache WHERE file_sha256 = ? AND settings = ? LIMIT 1;
+
+-- name: ListParseCacheEntries :many
+SELECT
+    id,
+    created_at,
+    last_used_at,
+    file_sha256,
+    settings,
+    file_name,
+    pages,
+    credits_used,
+    length(markdown) AS size
+FROM parse_cache
+ORDER BY last_used_at DESC;
+
+-- name: UpsertParseCacheEntry :exec
+INSERT INTO
+    parse_cache (
+        file_sha256,
+        settings,
+        file_name,
+        markdown,
+        pages,
+        credits_used
+    )
+VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT (file_sha256, settings) DO UPDATE
+SET
+    file_name = excluded.file_name,
+    markdown = excluded.markdown,
+    pages = excluded.pages,
+    credits_used = excluded.credits_used,
+    last_used_at = CURRENT_TIMESTAMP;
+
+-- name: TouchParseCacheEntry :exec
+UPDATE parse_cache SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?;
+
+-- name: DeleteParseCacheEntriesUsedBefore :execrows
+DELETE FROM parse_cache WHERE last_used_at < ?;
+
+-- name: DeleteOrphanedParseCacheEntries :execrows
+DELETE FROM parse_cache
+WHERE file_sha256 NOT IN (SELECT fileSha256 FROM documents);
+
+--------
+-- ingestion_jobs
+--------
+
+-- name: GetIngestionJob :one
+SELECT * FROM ingestion_jobs WHERE id = ? LIMIT 1;
+
+-- name: ListIngestionJobs :many
+SELECT
+    ingestion_jobs.id,
+    ingestion_jobs.created_at,
+    ingestion_jobs.updated_at,
+    indexes.name AS index_name,
+    ingestion_jobs.file_path,
+    ingestion_jobs.file_size,
+    ingestion_jobs.status,
+    ingestion_jobs.stage,
+    ingestion_jobs.attempts,
+    ingestion_jobs.error
+FROM ingestion_jobs
+    JOIN indexes ON indexes.id = ingestion_jobs.index_id
+ORDER BY ingestion_jobs.id DESC;
+
+-- name: GetActiveIngestionJobByDocumentID :one
+SELECT * FROM ingestion_jobs
+WHERE
+    (document_id = sqlc.arg('document_id') OR replaces_document_id = sqlc.arg('document_id'))
+    AND status IN ('pending', 'running')
+ORDER BY id
+LIMIT 1;
+
+-- name: GetActiveIngestionJobBySHA256 :one
+SELECT * FROM ingestion_jobs
+WHERE index_id = ? AND file_sha256 = ? AND status IN ('pending', 'running')
+ORDER BY id
+LIMIT 1;
+
+-- name: ListActiveIngestionJobChunksByIndexID :many
+SELECT
+    chunks
+FROM
+    ingestion_jobs
+WHERE
+    index_id = ? AND status IN ('pending', 'running') AND chunks IS NOT NULL;
+
+-- name: ListActiveIngestionJobsByIndexID :many
+SELECT
+    file_path,
+    file_sha256
+FROM
+    ingestion_jobs
+WHERE
+    index_id = ? AND status IN ('pending', 'running');
+
+-- name: ListIngestionJobsToRecover :many
+SELECT * FROM ingestion_jobs
+WHERE
+    document_id IS NOT NULL
+    AND stage != 'committed'
+    AND (status IN ('pending', 'failed', 'cancelled') OR (status = 'running' AND updated_at < ?))
+ORDER BY id;
+
+-- name: CreateIngestionJob :one
+INSERT INTO
+    ingestion_jobs (
+        index_id,
+        file_path,
+        file_size,
+        file_sha256,
+        file_data,
+        tags,
+        chunk_size,
+        request_delay,
+        replaces_document_id,
+        force
+    )
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING *;
+
+-- name: ClaimIngestionJob :one
+UPDATE ingestion_jobs
+SET
+    status = 'running',
+    attempts = attempts + 1,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = (
+        SELECT id FROM ingestion_jobs
+        WHERE status = 'pending' OR (status = 'running' AND updated_at < ?)
+        ORDER BY id
+        LIMIT 1
+    )
+RETURNING *;
+
+-- name: TouchIngestionJob :exec
+UPDATE ingestion_jobs SET updated_at = CURRENT_TIMESTAMP WHERE id = ?;
+
+-- name: SaveIngestionJobProgress :exec
+UPDATE ingestion_jobs
+SET
+    stage = ?,
+    markdown = ?,
+    chunks = ?,
+    document_id = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = ?;
+
+-- name: CompleteIngestionJob :exec
+UPDATE ingestion_jobs
+SET
+    status = 'completed',
+    stage = 'committed',
+    error = NULL,
+    file_data = NULL,
+    markdown = NULL,
+    chunks = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = ?;
+
+-- name: FailIngestionJob :exec
+UPDATE ingestion_jobs
+SET
+    status = 'failed',
+    error = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = ? AND status = 'running';
+
+-- name: ReleaseIngestionJob :exec
+UPDATE ingestion_jobs
+SET
+    status = 'pending',
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = ? AND status = 'running';
+
+-- name: RetryIngestionJob :execrows
+UPDATE ingestion_jobs
+SET
+    status = 'pending',
+    error = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = ? AND status IN ('failed', 'cancelled');
+
+-- name: CancelIngestionJob :execrows
+UPDATE ingestion_jobs
+SET
+    status = 'cancelled',
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = ? AND status IN ('pending', 'running', 'failed');
+
+-- name: LockIngestionJob :execrows
+UPDATE ingestion_jobs
+SET
+    status = 'running',
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = ? AND status = ? AND (status != 'running' OR updated_at < ?);
+
+-- name: SetIngestionJobStatus :exec
+UPDATE ingestion_jobs
+SET
+    status = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = ?;
+
+-- name: DetachIngestionJobsFromDocument :exec
+UPDATE ingestion_jobs
+SET
+    document_id = NULLIF(document_id, sqlc.arg('id')),
+    replaces_document_id = NULLIF(replaces_document_id, sqlc.arg('id'))
+WHERE
+    document_id = sqlc.arg('id') OR replaces_document_id = sqlc.arg('id');
@@ -6,7 +6,8 @@ CREATE TABLE indexes (
     updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
     name TEXT UNIQUE NOT NULL,
     description TEXT,
-    path TEXT NOT NULL
+    path TEXT NOT NULL,
+    collection TEXT NOT NULL
 );
 
 CREATE TABLE documents (
@@ -20,6 +21,15 @@ CREATE TABLE documents (
     fileSha256 VARCHAR(50) NOT NULL
 );
 
+CREATE INDEX documents_index_path ON documents (index_id, filePath);
+CREATE INDEX documents_index_sha256 ON documents (index_id, fileSha256);
+
+CREATE TABLE document_tags (
+    document_id INTEGER NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (document_id, tag)
+);
+
 CREATE TABLE chunks (
     id INTEGER PRIMARY KEY,
     created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
@@ -29,7 +39,22 @@ CREATE TABLE chunks (
     end_offset INTEGER,
     content TEXT NOT NULL,
     context TEXT NOT NULL,
-    indexing_id TEXT NOT NULL
+    indexing_id TEXT NOT NULL,
+    page INTEGER NOT NULL DEFAULT 0,
+    ordinal INTEGER,
+    table_sha256 TEXT
+);
+
+CREATE INDEX chunks_indexing_id ON chunks (indexing_id);
+
+CREATE INDEX chunks_document_ordinal ON chunks (document_id, ordinal);
+
+CREATE TABLE chunk_removals (
+    id INTEGER PRIMARY KEY,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    index_id INTEGER NOT NULL REFERENCES indexes (id) ON DELETE CASCADE,
+    chunk_ids TEXT NOT NULL,
+    document_ids TEXT NOT NULL DEFAULT '[]'
 );
 
 CREATE TABLE conversations (
@@ -48,4 +73,42 @@ CREATE TABLE messages (
     user_agent VARCHAR(255),
     content TEXT NOT NULL,
     role VARCHAR(50) NOT NULL
-);
\ No newline at end of file
+);
+
+CREATE TABLE parse_cache (
+    id INTEGER PRIMARY KEY,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    file_sha256 TEXT NOT NULL,
+    settings TEXT NOT NULL,
+    file_name TEXT NOT NULL,
+    markdown TEXT NOT NULL,
+    pages INTEGER NOT NULL DEFAULT 0,
+    credits_used INTEGER NOT NULL DEFAULT 0,
+    UNIQUE (file_sha256, settings)
+);
+
+CREATE TABLE ingestion_jobs (
+    id INTEGER PRIMARY KEY,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    index_id INTEGER NOT NULL REFERENCES indexes (id) ON DELETE CASCADE,
+    file_path TEXT NOT NULL,
+    file_size INTEGER NOT NULL,
+    file_sha256 TEXT NOT NULL,
+    file_data BLOB,
+    tags TEXT NOT NULL DEFAULT '[]',
+    chunk_size INTEGER NOT NULL,
+    request_delay INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'pending',
+    stage TEXT NOT NULL DEFAULT 'queued',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    markdown TEXT,
+    chunks TEXT,
+    document_id INTEGER REFERENCES documents (id) ON DELETE SET NULL,
+    replaces_document_id INTEGER REFERENCES documents (id) ON DELETE SET NULL,
+    force BOOLEAN NOT NULL DEFAULT 0
+);
+
+CREATE INDEX ingestion_jobs_status ON ingestion_jobs (status);
\ No newline at end of file